@@ -0,0 +1,364 @@
+package admin_api
+
+import (
+	"ActQABot/api/base_api"
+	"ActQABot/internal/logging"
+	"ActQABot/pkg/leader"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/secrets"
+	"ActQABot/pkg/webhooks"
+	"ActQABot/pkg/worker_report"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+	"log/slog"
+	"net/http"
+)
+
+func returnOutboxError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, outbox.NotFoundError) {
+		base_api.APIReturnErrorStatus(w, http.StatusNotFound, err)
+		return
+	}
+	slog.ErrorContext(r.Context(), "admin outbox error", "error", err)
+	base_api.APIReturnErrorStatus(w, http.StatusInternalServerError, err)
+}
+
+// listOutboxDead lists dead-lettered GitHub writes.
+// @Summary List outbox dead letters
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} OutboxDeadList
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/outbox/dead/ [get]
+func listOutboxDead(w http.ResponseWriter, r *http.Request) {
+	items, err := outbox.ListDead(r.Context())
+	if err != nil {
+		returnOutboxError(w, r, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(OutboxDeadList{Items: items})
+}
+
+// getOutboxDead returns a dead-lettered GitHub write with its attempt history.
+// @Summary Inspect an outbox dead letter
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "Outbox item ID"
+// @Success 200 {object} outbox.Item
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/outbox/dead/{id} [get]
+func getOutboxDead(w http.ResponseWriter, r *http.Request) {
+	item, err := outbox.GetDead(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		returnOutboxError(w, r, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+// replayOutboxDead re-enqueues a dead-lettered GitHub write at its original position in the issue queue.
+// @Summary Replay an outbox dead letter
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "Outbox item ID"
+// @Success 202 {object} outbox.Item
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/outbox/dead/{id}/replay [post]
+func replayOutboxDead(w http.ResponseWriter, r *http.Request) {
+	item, err := outbox.ReplayDead(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		returnOutboxError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+// purgeOutboxDead drops a dead-lettered GitHub write.
+// @Summary Purge an outbox dead letter
+// @Tags admin
+// @Security AdminToken
+// @Param id path string true "Outbox item ID"
+// @Success 204
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/outbox/dead/{id} [delete]
+func purgeOutboxDead(w http.ResponseWriter, r *http.Request) {
+	if err := outbox.PurgeDead(r.Context(), mux.Vars(r)["id"]); err != nil {
+		returnOutboxError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func returnReportError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, worker_report.NotFoundError):
+		base_api.APIReturnErrorStatus(w, http.StatusNotFound, err)
+	case errors.Is(err, worker_report.ConflictError):
+		base_api.APIReturnErrorStatus(w, http.StatusConflict, err)
+	default:
+		slog.ErrorContext(r.Context(), "admin report error", "error", err)
+		base_api.APIReturnErrorStatus(w, http.StatusInternalServerError, err)
+	}
+}
+
+// listReportsDead lists dead-lettered worker reports.
+// @Summary List worker report dead letters
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} ReportDeadList
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/reports/dead/ [get]
+func listReportsDead(w http.ResponseWriter, r *http.Request) {
+	reports, err := worker_report.ListDead(r.Context())
+	if err != nil {
+		returnReportError(w, r, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(ReportDeadList{Reports: reports})
+}
+
+// getReportDead returns a dead-lettered worker report with its failure reason and attempt history.
+// @Summary Inspect a worker report dead letter
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "Dead letter ID"
+// @Success 200 {object} worker_report.DeadReport
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/reports/dead/{id} [get]
+func getReportDead(w http.ResponseWriter, r *http.Request) {
+	dead, err := worker_report.GetDead(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		returnReportError(w, r, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(dead)
+}
+
+// replayReportDead puts a dead-lettered worker report back on the queue.
+// @Summary Replay a worker report dead letter
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param id path string true "Dead letter ID"
+// @Success 202 {object} worker_report.JobReport
+// @Failure 404 {object} base_api.APIError
+// @Failure 409 {object} base_api.APIError
+// @Router /admin/reports/dead/{id}/replay [post]
+func replayReportDead(w http.ResponseWriter, r *http.Request) {
+	report, err := worker_report.ReplayDead(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		returnReportError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// purgeReportDead drops a dead-lettered worker report.
+// @Summary Purge a worker report dead letter
+// @Tags admin
+// @Security AdminToken
+// @Param id path string true "Dead letter ID"
+// @Success 204
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/reports/dead/{id} [delete]
+func purgeReportDead(w http.ResponseWriter, r *http.Request) {
+	if err := worker_report.PurgeDead(r.Context(), mux.Vars(r)["id"]); err != nil {
+		returnReportError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries returns the outbound webhook delivery log.
+// @Summary List webhook deliveries
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param WebhookDeliveriesQuery query admin_api.WebhookDeliveriesQuery false "Filters"
+// @Success 200 {object} WebhookDeliveryList
+// @Failure 400 {object} base_api.APIError
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/webhooks/deliveries/ [get]
+func listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	var q WebhookDeliveriesQuery
+	if err := schema.NewDecoder().Decode(&q, r.URL.Query()); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(WebhookDeliveryList{Deliveries: webhooks.Deliveries(q.Endpoint, q.EventId)})
+}
+
+// getLogLevel returns the current log level.
+// @Summary Get log level
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} LogLevel
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/log/level [get]
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(LogLevel{Level: logging.LevelName(logging.Level())})
+}
+
+// setLogLevel changes the log level of this replica until restart.
+// @Summary Set log level
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param level body LogLevel true "New level"
+// @Success 200 {object} LogLevel
+// @Failure 400 {object} base_api.APIError
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/log/level [put]
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	level, err := logging.ParseLevel(body.Level)
+	if err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	previous := logging.Level()
+	logging.SetLevel(level)
+	slog.InfoContext(
+		r.Context(), "log level changed",
+		"from", logging.LevelName(previous), "to", logging.LevelName(level),
+	)
+	_ = json.NewEncoder(w).Encode(LogLevel{Level: logging.LevelName(level)})
+}
+
+// getLeader tells which replica processes worker reports and forge writes.
+// @Summary HA leader status
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} leader.Status
+// @Failure 401 {object} base_api.APIError
+// @Failure 500 {object} base_api.APIError
+// @Router /admin/leader [get]
+func getLeader(w http.ResponseWriter, r *http.Request) {
+	status, err := leader.CurrentStatus(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "unable to look the leader up", "error", err)
+		base_api.APIReturnErrorStatus(w, http.StatusInternalServerError, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func returnSecretError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *secrets.InvalidError
+	switch {
+	case errors.As(err, &invalid):
+		base_api.APIReturnError(w, err)
+	case errors.Is(err, secrets.NotFoundError):
+		base_api.APIReturnErrorStatus(w, http.StatusNotFound, err)
+	case errors.Is(err, secrets.DisabledError):
+		base_api.APIReturnErrorStatus(w, http.StatusServiceUnavailable, err)
+	default:
+		slog.ErrorContext(r.Context(), "admin secrets error", "error", err)
+		base_api.APIReturnErrorStatus(w, http.StatusInternalServerError, err)
+	}
+}
+
+// listSecrets lists the secrets given to act jobs, without their values.
+// @Summary List repository secrets
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param SecretScopeQuery query admin_api.SecretScopeQuery false "Filters"
+// @Success 200 {object} SecretList
+// @Failure 400 {object} base_api.APIError
+// @Failure 401 {object} base_api.APIError
+// @Router /admin/secrets/ [get]
+func listSecrets(w http.ResponseWriter, r *http.Request) {
+	var q SecretScopeQuery
+	if err := schema.NewDecoder().Decode(&q, r.URL.Query()); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	list, err := secrets.List(r.Context(), q.scope())
+	if err != nil {
+		returnSecretError(w, r, err)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(SecretList{Secrets: list})
+}
+
+// putSecret encrypts and stores a secret, act jobs of the repository get it with -s.
+// @Summary Set a repository secret
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Secret name"
+// @Param SecretScopeQuery query admin_api.SecretScopeQuery true "Scope"
+// @Param value body SecretValue true "Secret value"
+// @Success 200 {object} secrets.Secret
+// @Failure 400 {object} base_api.APIError
+// @Failure 401 {object} base_api.APIError
+// @Failure 503 {object} base_api.APIError
+// @Router /admin/secrets/{name} [put]
+func putSecret(w http.ResponseWriter, r *http.Request) {
+	var q SecretScopeQuery
+	if err := schema.NewDecoder().Decode(&q, r.URL.Query()); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	var body SecretValue
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	secret, err := secrets.Put(r.Context(), q.scope(), mux.Vars(r)["name"], body.Value)
+	if err != nil {
+		returnSecretError(w, r, err)
+		return
+	}
+	slog.InfoContext(
+		r.Context(), "secret stored",
+		"name", secret.Name, "forge", secret.Forge, logging.KeyRepo, secret.Repository, logging.KeyHost, secret.Host,
+	)
+	_ = json.NewEncoder(w).Encode(secret)
+}
+
+// deleteSecret removes a secret from the scope.
+// @Summary Delete a repository secret
+// @Tags admin
+// @Security AdminToken
+// @Param name path string true "Secret name"
+// @Param SecretScopeQuery query admin_api.SecretScopeQuery true "Scope"
+// @Success 204
+// @Failure 400 {object} base_api.APIError
+// @Failure 404 {object} base_api.APIError
+// @Router /admin/secrets/{name} [delete]
+func deleteSecret(w http.ResponseWriter, r *http.Request) {
+	var q SecretScopeQuery
+	if err := schema.NewDecoder().Decode(&q, r.URL.Query()); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := secrets.Delete(r.Context(), q.scope(), name); err != nil {
+		returnSecretError(w, r, err)
+		return
+	}
+	slog.InfoContext(
+		r.Context(), "secret deleted",
+		"name", name, "forge", q.Forge, logging.KeyRepo, q.Repository, logging.KeyHost, q.Host,
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package admin_api
+
+import (
+	"ActQABot/api/base_api"
+	"ActQABot/conf"
+	"crypto/subtle"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+func requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if conf.AdminEnv.Token == "" {
+				base_api.APIReturnErrorStatus(w, http.StatusForbidden, errors.New("admin API is disabled"))
+				return
+			}
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(conf.AdminEnv.Token)) != 1 {
+				base_api.APIReturnErrorStatus(w, http.StatusUnauthorized, errors.New("invalid admin token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+func Router() *mux.Router {
+	r := mux.NewRouter().StrictSlash(false)
+	r.Use(requireAdminToken)
+	r.HandleFunc("/outbox/dead/", listOutboxDead).Methods("GET")
+	r.HandleFunc("/outbox/dead/{id}", getOutboxDead).Methods("GET")
+	r.HandleFunc("/outbox/dead/{id}/replay", replayOutboxDead).Methods("POST")
+	r.HandleFunc("/outbox/dead/{id}", purgeOutboxDead).Methods("DELETE")
+	r.HandleFunc("/reports/dead/", listReportsDead).Methods("GET")
+	r.HandleFunc("/reports/dead/{id}", getReportDead).Methods("GET")
+	r.HandleFunc("/reports/dead/{id}/replay", replayReportDead).Methods("POST")
+	r.HandleFunc("/reports/dead/{id}", purgeReportDead).Methods("DELETE")
+	r.HandleFunc("/webhooks/deliveries/", listWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/log/level", getLogLevel).Methods("GET")
+	r.HandleFunc("/log/level", setLogLevel).Methods("PUT")
+	r.HandleFunc("/leader", getLeader).Methods("GET")
+	r.HandleFunc("/secrets/", listSecrets).Methods("GET")
+	r.HandleFunc("/secrets/{name}", putSecret).Methods("PUT")
+	r.HandleFunc("/secrets/{name}", deleteSecret).Methods("DELETE")
+	return r
+}
@@ -0,0 +1,69 @@
+package admin_api
+
+import (
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/secrets"
+	"ActQABot/pkg/webhooks"
+	"ActQABot/pkg/worker_report"
+)
+
+// OutboxDeadList lists GitHub writes that exhausted their retries
+// @Description dead-lettered outbox items
+type OutboxDeadList struct {
+	Items []*outbox.Item `json:"items"`
+}
+
+// ReportDeadList lists worker reports that exhausted their retries
+// @Description dead-lettered worker reports
+type ReportDeadList struct {
+	Reports []*worker_report.DeadReport `json:"reports"`
+}
+
+// WebhookDeliveriesQuery filters the delivery log
+// @Description delivery log filters
+type WebhookDeliveriesQuery struct {
+	// Endpoint name from the webhooks configuration
+	Endpoint string `schema:"endpoint" json:"endpoint" example:"dashboard"`
+	// Event ID (X-QABot-Delivery)
+	EventId string `schema:"event_id" json:"event_id" example:"6f1c1d2e-0000-0000-0000-000000000000"`
+}
+
+// WebhookDeliveryList lists outbound webhook delivery attempts, newest first
+// @Description webhook delivery log
+type WebhookDeliveryList struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+// LogLevel is the level of the process logger
+// @Description runtime log level
+type LogLevel struct {
+	// trace, debug, info, warn or error
+	Level string `json:"level" example:"debug"`
+}
+
+// SecretScopeQuery selects the secrets of a repository, of all its hosts when Host is empty
+// @Description secret scope
+type SecretScopeQuery struct {
+	// github or gitlab, github when empty
+	Forge string `schema:"forge" json:"forge" example:"github"`
+	// owner/repo, the GitLab project path
+	Repository string `schema:"repository" json:"repository" example:"owner/repo"`
+	// host from the hosts configuration
+	Host string `schema:"host" json:"host" example:"h200"`
+}
+
+func (q SecretScopeQuery) scope() secrets.Scope {
+	return secrets.Scope{Forge: q.Forge, Repository: q.Repository, Host: q.Host}
+}
+
+// SecretValue is the value of a secret, write only
+// @Description secret value
+type SecretValue struct {
+	Value string `json:"value" example:"hf_xxx"`
+}
+
+// SecretList lists secrets without their values
+// @Description repository secrets
+type SecretList struct {
+	Secrets []secrets.Secret `json:"secrets"`
+}
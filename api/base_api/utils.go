@@ -1,6 +1,8 @@
 package base_api
 
 import (
+	"ActQABot/internal/shutdown"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -10,6 +12,22 @@ type APIError struct {
 }
 
 func APIReturnError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusBadRequest)
+	APIReturnErrorStatus(w, http.StatusBadRequest, err)
+}
+
+func APIReturnErrorStatus(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
 	_, _ = w.Write([]byte(fmt.Sprintf(`{"error": "%s!"}`, err.Error())))
 }
+
+// RejectWhileDraining answers 503 once the replica is shutting down so the sender retries elsewhere
+func RejectWhileDraining(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if shutdown.IsDraining() {
+			w.Header().Set("Retry-After", "5")
+			APIReturnErrorStatus(w, http.StatusServiceUnavailable, errors.New("server is shutting down"))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -4,17 +4,24 @@ import (
 	"ActQABot/api/base_api"
 	"ActQABot/conf"
 	"ActQABot/internal/grpc_utils"
-	"ActQABot/pkg/github/gh_api"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/internal/shutdown"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/forge"
 	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/redact"
 	"ActQABot/pkg/worker_report"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	actservice "github.com/D1-3105/ActService/api/gen/ActService"
-	"github.com/golang/glog"
 	"github.com/gorilla/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -23,6 +30,15 @@ func returnErrorEvent(w http.ResponseWriter, err error) {
 	_, _ = w.Write([]byte(fmt.Sprintf(`data: {"error": "%s!"}`, err.Error())))
 }
 
+// eventLabel keeps the metric label set bounded, whatever GitHub sends
+func eventLabel(eventType string) string {
+	switch eventType {
+	case "ping", "issue_comment", "pull_request":
+		return eventType
+	}
+	return "other"
+}
+
 // webhookHandler handles incoming GitHub webhook events.
 // @Summary GitHub webhook
 // @Description GitHub Webhooks: issue_comment, ping etc.
@@ -34,9 +50,21 @@ func returnErrorEvent(w http.ResponseWriter, err error) {
 // @Param payload body github_api.IssueCommentEvent true "Webhook payload"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 503 {object} base_api.APIError "Shutting down, retry later"
 // @Router /github/events/ [post]
 func webhookHandler(w http.ResponseWriter, r *http.Request) {
 	eventType := r.Header.Get("X-GitHub-Event")
+	deliveryId := r.Header.Get("X-GitHub-Delivery")
+	// GitHub doesn't wait for long, the job must not be cancelled with the request
+	ctx, span := tracing.Start(
+		logging.With(context.WithoutCancel(r.Context()), logging.KeyDelivery, deliveryId),
+		"github.webhook",
+		trace.WithAttributes(
+			attribute.String("github.event", eventType),
+			attribute.String("github.delivery", deliveryId),
+		),
+	)
+	defer span.End()
 	decoderSchema := schema.NewDecoder()
 	q := WebhookQuery{
 		PostBack: true,
@@ -57,10 +85,14 @@ func webhookHandler(w http.ResponseWriter, r *http.Request) {
 	case "issue_comment":
 		var issue IssueCommentEvent
 		if err := decoder.Decode(&issue); err != nil {
+			metrics.WebhookEvents.WithLabelValues(forge.GitHub, eventType, metrics.OutcomeError).Inc()
+			tracing.Fail(span, err)
 			base_api.APIReturnError(w, err)
 			return
 		}
-		if err := issueHandler(&issue, q.PostBack); err != nil {
+		if err := issueHandler(ctx, &issue, q.PostBack); err != nil {
+			metrics.WebhookEvents.WithLabelValues(forge.GitHub, eventType, metrics.OutcomeError).Inc()
+			tracing.Fail(span, err)
 			base_api.APIReturnError(w, err)
 			return
 		}
@@ -69,84 +101,54 @@ func webhookHandler(w http.ResponseWriter, r *http.Request) {
 	case "pull_request":
 		break
 	}
+	metrics.WebhookEvents.WithLabelValues(forge.GitHub, eventLabel(eventType), metrics.OutcomeOK).Inc()
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write([]byte(fmt.Sprintf(`{"event_type": "%s"}`, eventType) + "\n"))
 }
 
-func issueHandler(issueComment *IssueCommentEvent, postBack bool) error {
-	var resp *gh_api.BotResponse
-	var err error
-	githubIssueMeta := worker_report.GithubIssueMeta{
-		IssueId:    issueComment.Issue.Number,
-		Body:       issueComment.Comment.Body,
-		Sender:     issueComment.Comment.User.Login,
-		Repository: issueComment.Repository.Name,
-		Owner:      issueComment.Repository.Owner.Login,
+func issueHandler(ctx context.Context, issueComment *IssueCommentEvent, postBack bool) error {
+	return issues.HandleComment(ctx, &issueComment.IssueComment, postBack)
+}
+
+var unknownJobLogError = errors.New("unknown job, its log can't be served without masking its secrets")
+
+// logRedactor masks the secrets the job got. They are scoped by its spec, or by its meta when the spec is gone;
+// a job known by neither gets no log at all, the secrets it may print couldn't be masked.
+func logRedactor(ctx context.Context, jobId string) (*redact.Redactor, error) {
+	spec, err := worker_report.GetJobSpec(ctx, jobId)
+	if err == nil {
+		return redact.ForJob(ctx, redact.SourceLogStream, spec.Forge, spec.Owner+"/"+spec.Repository, spec.Host), nil
 	}
-	if issueComment.Action == "created" {
-		issueCommand, err := issues.NewIssuePRCommand(issueComment.IssueComment, []string{})
-		if err != nil && !errors.Is(err, issues.NotMyCommentError) && !errors.Is(err, issues.CommentDataEmptyError) {
-			glog.Infof("NewIssuePRCommand: %v", err)
-			glog.Errorf("NewIssuePRCommand error: %v", err)
-			resp = issues.ErrorToBotResponse(err, &issueComment.IssueComment)
-		} else if err == nil {
-			resp, err = issueCommand.Exec(&githubIssueMeta)
-			if githubIssueMeta.JobId != nil {
-				err = githubIssueMeta.Store(context.Background(), *githubIssueMeta.JobId, 5)
-				if err != nil {
-					glog.Errorf("githubIssueMeta.Store error: %v", err)
-				}
-			}
-			if err != nil {
-				glog.Errorf("issueCommand.Exec error: %v", err)
-				resp = issues.ErrorToBotResponse(err, &issueComment.IssueComment)
-			}
-		}
+	if !errors.Is(err, worker_report.JobSpecNotFoundError) {
+		return nil, err
 	}
-	if resp != nil {
-		if postBack {
-			go func() {
-				tok, err := gh_api.Authorize(
-					conf.GithubEnvironment, issueComment.Repository.Owner.Login, issueComment.Repository.Name,
-				)
-				if err != nil {
-					glog.Errorf("github Authorize: %v", err)
-					return
-				}
-				err = gh_api.PostIssueCommentFunc(resp, *tok.Token)
-				if err != nil {
-					glog.Errorf("PostIssueCommentFunc error: %v", err)
-				}
-				if githubIssueMeta.JobId != nil {
-					githubIssueMeta.AnswerCommentBody = new(string)
-					*githubIssueMeta.AnswerCommentBody = resp.Text
-					err = githubIssueMeta.Store(context.Background(), *githubIssueMeta.JobId, 5)
-					if err != nil {
-						glog.Errorf("githubIssueMeta.Store error: %v", err)
-					}
-				}
-			}()
-		} else {
-			glog.Infof("IssuePR response \n\n%s\n", resp.Text)
-		}
+	meta, err := worker_report.RetrieveGithubJobMetaFunc(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, unknownJobLogError
 	}
-	return err
+	slog.WarnContext(ctx, "no spec for the job, its secrets are scoped by the job meta")
+	return redact.ForJob(ctx, redact.SourceLogStream, meta.Forge, meta.Owner+"/"+meta.Repository, meta.Host), nil
 }
 
 // logStreamer streams logs over Server-Sent Events (SSE).
 // @Summary Stream job logs
-// @Description Stream logs from a remote job using gRPC and send via SSE
+// @Description Stream logs from a remote job using gRPC and send via SSE.
+// @Description A `reconnect` event with `{"reconnect": true}` data is sent before the server shuts down.
 // @Tags logs
 // @Produce text/event-stream
 // @Param LogStreamQuery query github_api.LogStreamQuery true "Query parameters"
 // @Success 200 {string} string "data: ..."
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "unknown job"
 // @Router /job/logs/ [get]
 func logStreamer(w http.ResponseWriter, r *http.Request) {
 	// return option
 	if r.Method == http.MethodOptions {
-		glog.Info("Options OK")
+		slog.DebugContext(r.Context(), "options OK", "url", r.URL.String())
 		w.WriteHeader(http.StatusOK)
 		return
 	}
@@ -158,6 +160,7 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 		base_api.APIReturnError(w, err)
 		return
 	}
+	ctx := logging.With(r.Context(), logging.KeyHost, q.Host, logging.KeyJob, q.JobId)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -172,13 +175,22 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 	}
 	grpcConn, err := grpc_utils.NewGRPCConn(host)
 	if err != nil {
-		glog.Errorf("grpc_utils.NewGRPCConn error: %v; %v", err, q)
+		slog.ErrorContext(ctx, "grpc_utils.NewGRPCConn failed", "error", err)
 		base_api.APIReturnError(w, errors.New("this host is inaccessible! can't listen to his jobs"))
 		return
 	}
+	redactor, err := logRedactor(ctx, q.JobId)
+	if errors.Is(err, unknownJobLogError) {
+		base_api.APIReturnErrorStatus(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "unable to look the job up", "error", err)
+		base_api.APIReturnErrorStatus(w, http.StatusInternalServerError, errors.New("unable to look the job up"))
+		return
+	}
 	grpcClient := actservice.NewActServiceClient(grpcConn)
 	streamLogRequest := actservice.JobLogRequest{JobId: q.JobId, LastOffset: 0}
-	stream, err := grpcClient.JobLogStream(r.Context(), &streamLogRequest)
+	stream, err := grpcClient.JobLogStream(ctx, &streamLogRequest)
 	streamQ := make(chan *actservice.JobLogMessage)
 	streamErrChan := make(chan error)
 
@@ -191,7 +203,7 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 		nilCnt := 0
 		for {
 			if stream == nil {
-				glog.Errorf("stream %v: nil", q)
+				slog.ErrorContext(ctx, "log stream is nil")
 				nilCnt++
 				if nilCnt > 10 {
 					streamErrChan <- errors.New("stream is nil")
@@ -201,17 +213,19 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 			}
 			msg, err := stream.Recv()
 			if err == io.EOF {
-				glog.Infof("stream %v: EOF", q)
+				slog.InfoContext(ctx, "log stream EOF")
 				return
 			} else if err != nil {
-				glog.Errorf("ERROR stream %v: %v", q, err)
+				slog.ErrorContext(ctx, "log stream failed", "error", err)
 				streamErrChan <- err
 			} else {
-				glog.V(2).Infof("stream %v: recv: %v", q, msg)
+				slog.Log(ctx, logging.LevelTrace, "log stream message received", "timestamp", msg.GetTimestamp())
 				streamQ <- msg
 			}
 		}
 	}()
+	metrics.ActiveLogStreams.Inc()
+	defer metrics.ActiveLogStreams.Dec()
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -222,30 +236,37 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 		select {
 		case err = <-streamErrChan:
 			if err != nil {
-				glog.Errorf("ERROR <sse> stream %v: %v", q, err)
+				slog.ErrorContext(ctx, "log stream aborted", "error", err)
 				returnErrorEvent(w, err)
 				return
 			}
+		case <-shutdown.Draining():
+			// the stream restarts from the beginning on another replica
+			slog.InfoContext(ctx, "log stream asked to reconnect, shutting down")
+			_, _ = fmt.Fprint(w, "event: reconnect\ndata: {\"reconnect\": true}\n\n")
+			flusher.Flush()
+			return
 		case <-streamContext.Done():
-			glog.Infof("stream %v: context done", q)
+			slog.InfoContext(ctx, "log stream done")
 			return
 		case msg := <-streamQ:
 			if msg == nil {
 				break
 			}
+			msg.Line = redactor.Text(msg.Line)
 			jsonedData, err := json.Marshal(msg)
 			if err != nil {
-				glog.Errorf("json.Marshal error: %v; %v", err, q)
+				slog.ErrorContext(ctx, "json.Marshal failed", "error", err)
 				returnErrorEvent(w, errors.New("failed to unmarshal upstream message"))
 				return
 			}
 			if _, err = fmt.Fprintf(w, "data: %s\n", jsonedData); err != nil {
-				glog.Errorf("write error: %v; %v", err, q)
+				slog.ErrorContext(ctx, "log stream write failed", "error", err)
 				return
 			}
 			flusher.Flush()
 		case <-r.Context().Done():
-			glog.Errorf("stream %v: client disconnected", q)
+			slog.InfoContext(ctx, "log stream client disconnected")
 			return
 		case <-ticker.C:
 			_, err := fmt.Fprintf(w, ": ping %d\n\n", time.Now().UnixMilli())
@@ -254,7 +275,7 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 			}
 			flusher.Flush()
 		case <-time.After(time.Minute * 10):
-			glog.Errorf("streaming timeout for %v", q)
+			slog.ErrorContext(ctx, "log stream timed out")
 			return
 		}
 	}
@@ -268,7 +289,7 @@ func logStreamer(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} HelpCommandResponse
 // @Failure 400 {object} map[string]string
 // @Router /help [get]
-func helpCommand(w http.ResponseWriter, _ *http.Request) {
+func helpCommand(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	issueComment := IssueCommentEvent{
@@ -290,7 +311,7 @@ func helpCommand(w http.ResponseWriter, _ *http.Request) {
 		base_api.APIReturnError(w, err)
 		return
 	}
-	execed, err := command.Exec(nil)
+	execed, err := command.Exec(r.Context(), nil)
 	if err != nil {
 		base_api.APIReturnError(w, err)
 		return
@@ -315,7 +336,7 @@ func helpCommand(w http.ResponseWriter, _ *http.Request) {
 // @Router /job/cancel/ [patch]
 func cancelWorkflow(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodOptions {
-		glog.Infof("Options OK %s", r.URL)
+		slog.DebugContext(r.Context(), "options OK", "url", r.URL.String())
 		w.WriteHeader(http.StatusOK)
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -330,17 +351,22 @@ func cancelWorkflow(w http.ResponseWriter, r *http.Request) {
 		base_api.APIReturnError(w, fmt.Errorf("host %s not found", q.Host))
 		return
 	}
+	ctx := logging.With(r.Context(), logging.KeyHost, q.Host, logging.KeyJob, q.JobId)
 	jobCancel := actservice.CancelJob{JobId: q.JobId}
 	grpcConn, err := grpc_utils.NewGRPCConn(hostConf)
 	if err != nil {
-		glog.Errorf("grpc_utils.NewGRPCConn error: %v; %v", err, q)
+		slog.ErrorContext(ctx, "grpc_utils.NewGRPCConn failed", "error", err)
 	}
 	client := actservice.NewActServiceClient(grpcConn)
 	job, err := client.CancelActJob(context.Background(), &jobCancel)
-	glog.Infof("Job q=%v cancelled: job=%v", q, job)
+	slog.InfoContext(ctx, "job cancelled", "result", job)
 	if err != nil {
 		base_api.APIReturnError(w, err)
 		return
 	}
+	if err = worker_report.DeleteJobDeadline(ctx, q.JobId); err != nil {
+		slog.ErrorContext(ctx, "unable to stop the job watchdog", "error", err)
+	}
+	worker_report.PublishJobCancelled(ctx, q.JobId, q.Host, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,10 +1,13 @@
 package github_api
 
-import "github.com/gorilla/mux"
+import (
+	"ActQABot/api/base_api"
+	"github.com/gorilla/mux"
+)
 
 func Router() *mux.Router {
 	r := mux.NewRouter().StrictSlash(false)
-	r.HandleFunc("/github/events/", webhookHandler).Methods("POST")
+	r.HandleFunc("/github/events/", base_api.RejectWhileDraining(webhookHandler)).Methods("POST")
 	r.HandleFunc("/job/logs/", logStreamer).Methods("GET", "OPTIONS")
 	r.HandleFunc("/help", helpCommand).Methods("GET", "OPTIONS")
 	r.HandleFunc("/job/cancel/", cancelWorkflow).Methods("PATCH", "OPTIONS")
@@ -0,0 +1,105 @@
+package gitlab_api
+
+import (
+	"ActQABot/api/base_api"
+	"ActQABot/conf"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/issues"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// webhookHandler handles incoming GitLab webhook events.
+// @Summary GitLab webhook
+// @Description GitLab Webhooks: merge request notes (Note Hook)
+// @Tags gitlab
+// @Accept json
+// @Produce json
+// @Param X-Gitlab-Event header string true "GitLab Event Type (e.g. 'Note Hook')"
+// @Param X-Gitlab-Token header string true "Secret token configured on the webhook"
+// @Param WebhookQuery query gitlab_api.WebhookQuery true "Query parameters"
+// @Param payload body gitlab_api.NoteEvent true "Webhook payload"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} base_api.APIError
+// @Failure 401 {object} base_api.APIError
+// @Failure 403 {object} base_api.APIError
+// @Failure 503 {object} base_api.APIError "Shutting down, retry later"
+// @Router /gitlab/events/ [post]
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if conf.GitlabEnvironment.WebhookToken == "" {
+		metrics.WebhookEvents.WithLabelValues(forge.GitLab, "unknown", "disabled").Inc()
+		base_api.APIReturnErrorStatus(w, http.StatusForbidden, errors.New("GitLab webhook is disabled"))
+		return
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(conf.GitlabEnvironment.WebhookToken)) != 1 {
+		metrics.WebhookEvents.WithLabelValues(forge.GitLab, "unknown", "unauthorized").Inc()
+		base_api.APIReturnErrorStatus(w, http.StatusUnauthorized, errors.New("invalid webhook token"))
+		return
+	}
+	q := WebhookQuery{
+		PostBack: true,
+	}
+	if err := schema.NewDecoder().Decode(&q, r.URL.Query()); err != nil {
+		base_api.APIReturnError(w, err)
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(r.Body)
+
+	eventType := r.Header.Get("X-Gitlab-Event")
+	deliveryId := r.Header.Get("X-Gitlab-Event-UUID")
+	ctx, span := tracing.Start(
+		logging.With(context.WithoutCancel(r.Context()), logging.KeyDelivery, deliveryId),
+		"gitlab.webhook",
+		trace.WithAttributes(
+			attribute.String("gitlab.event", eventType),
+			attribute.String("gitlab.event_uuid", deliveryId),
+		),
+	)
+	defer span.End()
+	eventLabel := "other"
+	switch eventType {
+	case "Note Hook":
+		eventLabel = eventType
+		var note NoteEvent
+		if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+			metrics.WebhookEvents.WithLabelValues(forge.GitLab, eventLabel, metrics.OutcomeError).Inc()
+			tracing.Fail(span, err)
+			base_api.APIReturnError(w, err)
+			return
+		}
+		if note.ObjectAttributes.NoteableType != "MergeRequest" || note.MergeRequest == nil {
+			slog.DebugContext(
+				ctx, "ignoring note",
+				"noteable_type", note.ObjectAttributes.NoteableType,
+				logging.KeyRepo, note.Project.PathWithNamespace,
+			)
+			break
+		}
+		comment := note.IssueComment()
+		if err := issues.HandleComment(ctx, &comment, q.PostBack); err != nil {
+			metrics.WebhookEvents.WithLabelValues(forge.GitLab, eventLabel, metrics.OutcomeError).Inc()
+			tracing.Fail(span, err)
+			base_api.APIReturnError(w, err)
+			return
+		}
+	}
+	metrics.WebhookEvents.WithLabelValues(forge.GitLab, eventLabel, metrics.OutcomeOK).Inc()
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(fmt.Sprintf(`{"event_type": "%s"}`, eventType) + "\n"))
+}
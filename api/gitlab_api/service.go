@@ -0,0 +1,12 @@
+package gitlab_api
+
+import (
+	"ActQABot/api/base_api"
+	"github.com/gorilla/mux"
+)
+
+func Router() *mux.Router {
+	r := mux.NewRouter().StrictSlash(false)
+	r.HandleFunc("/events/", base_api.RejectWhileDraining(webhookHandler)).Methods("POST")
+	return r
+}
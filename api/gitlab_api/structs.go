@@ -0,0 +1,66 @@
+package gitlab_api
+
+import (
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/issues"
+	"strings"
+)
+
+// NoteEvent represents the GitLab "Note Hook" payload, only the fields the bot reads.
+// @Description GitLab note (comment) webhook payload
+type NoteEvent struct {
+	ObjectKind string `json:"object_kind" example:"note"`
+	User       struct {
+		Username string `json:"username" example:"jdoe"`
+	} `json:"user"`
+	Project struct {
+		// "group/subgroup/project"
+		PathWithNamespace string `json:"path_with_namespace" example:"group/project"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		ID   int    `json:"id" example:"1244"`
+		Note string `json:"note" example:"@bot /help"`
+		// Commit, MergeRequest, Issue or Snippet
+		NoteableType string `json:"noteable_type" example:"MergeRequest"`
+		// create or update, absent on older GitLab versions
+		Action string `json:"action" example:"create"`
+	} `json:"object_attributes"`
+	MergeRequest *struct {
+		IID int `json:"iid" example:"1"`
+	} `json:"merge_request"`
+}
+
+// IssueComment maps a merge request note onto the comment the command pipeline understands
+func (e *NoteEvent) IssueComment() issues.IssueComment {
+	var comment issues.IssueComment
+	comment.Forge = forge.GitLab
+	if e.ObjectAttributes.Action == "" || e.ObjectAttributes.Action == "create" {
+		comment.Action = "created"
+	} else {
+		comment.Action = e.ObjectAttributes.Action
+	}
+	if e.MergeRequest != nil {
+		comment.Issue.Number = e.MergeRequest.IID
+	}
+	comment.Issue.PullRequest = map[string]interface{}{"noteable_type": e.ObjectAttributes.NoteableType}
+	comment.Comment.Body = e.ObjectAttributes.Note
+	comment.Comment.User.Login = e.User.Username
+	comment.Sender.Login = e.User.Username
+
+	fullName := e.Project.PathWithNamespace
+	comment.Repository.FullName = fullName
+	if i := strings.LastIndex(fullName, "/"); i >= 0 {
+		comment.Repository.Owner.Login = fullName[:i]
+		comment.Repository.Name = fullName[i+1:]
+	} else {
+		comment.Repository.Name = fullName
+	}
+	return comment
+}
+
+// WebhookQuery represents optional query string.
+// @Description options
+type WebhookQuery struct {
+	// If true, server will respond back to GitLab after processing
+	PostBack bool `schema:"post_back" json:"post_back" example:"false"`
+}
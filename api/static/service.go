@@ -1,8 +1,8 @@
 package static
 
 import (
-	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"log/slog"
 	"net/http"
 	"path/filepath"
 )
@@ -14,7 +14,7 @@ func Router(staticDir string) *mux.Router {
 	frontendRouter.PathPrefix("").Handler(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			filePath := filepath.Join(staticDir, r.URL.Path)
-			glog.V(1).Infof("Serving static file: %s\n", filePath)
+			slog.DebugContext(r.Context(), "serving static file", "path", filePath)
 			fs.ServeHTTP(w, r)
 		}),
 	)
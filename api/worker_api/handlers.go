@@ -2,15 +2,19 @@ package worker_api
 
 import (
 	"ActQABot/api/base_api"
+	"ActQABot/internal/logging"
+	"ActQABot/pkg/worker_report"
 	"context"
 	"encoding/json"
-	"github.com/golang/glog"
+	"log/slog"
 	"net/http"
 )
 
 // reportCreate handles the creation of a job worker report.
 // @Summary Create a worker report
 // @Description Decodes worker report data, sends a business event, and returns a success response.
+// @Description A report without status is progress. The last report of a job must carry its status:
+// @Description the job finished notification and event and the matrix summary wait for it.
 // @Tags reports
 // @Accept json
 // @Produce json
@@ -24,7 +28,13 @@ func reportCreate(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
 		base_api.APIReturnError(w, err)
-		glog.Errorf("report validation error (decoding): %v", err)
+		slog.ErrorContext(r.Context(), "report validation error (decoding)", "error", err)
+		return
+	}
+	ctx := logging.With(r.Context(), logging.KeyJob, report.JobId)
+	if !worker_report.ValidStatus(report.Status) {
+		base_api.APIReturnError(w, worker_report.UnknownStatusError)
+		slog.ErrorContext(ctx, "report validation error (status)", "status", report.Status)
 		return
 	}
 	report.Retried = new(int32)
@@ -32,14 +42,14 @@ func reportCreate(w http.ResponseWriter, r *http.Request) {
 
 	if err := report.SendEvent(context.Background()); err != nil {
 		base_api.APIReturnError(w, err)
-		glog.Errorf("report validation error (SendEvent): %v", err)
+		slog.ErrorContext(ctx, "report validation error (SendEvent)", "error", err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 
 	if err := json.NewEncoder(w).Encode(JobReportResponse{}); err != nil {
-		glog.Errorf("report validation error (Encode result): %v", err)
+		slog.ErrorContext(ctx, "report validation error (Encode result)", "error", err)
 		return
 	}
 	return
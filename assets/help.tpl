@@ -1,4 +1,20 @@
 {{define "content"}}
+{{- with .Workflow }}
+#### BeepBoop: inputs of `{{ .Path }}` at `{{ .Ref }}`
+{{ if .Inputs }}
+| Input | Type | Required | Default | Description |
+|-------|------|----------|---------|-------------|
+{{- range .Inputs }}
+| `{{ .Name }}` | {{ .Type }} | {{ if .Required }}yes{{ else }}no{{ end }} | {{ .Default }} | {{ .Description }} |
+{{- end }}
+
+#### Ex: `@my_tag {{ $.StartHelp.StartCommand }} HOST SOME_SHA {{ .Path }}{{ range .Inputs }} --input {{ .Name }}=value{{ end }}`
+{{- else if .Dispatch }}
+The workflow_dispatch trigger declares no inputs.
+{{- else }}
+The workflow has no workflow_dispatch trigger, it takes no inputs.
+{{- end }}
+{{- else }}
 #### BeepBoop: you called {{.HelpCommand}}
 ##### Supported commands:
 {{- range .SupportedCommands }}
@@ -6,15 +22,36 @@
 {{- end }}
 
 {{ with .StartHelp }}
-@my_tag {{ .StartCommand }} HOST COMMIT_ID WORKFLOW_PATH [-e ENV=value]
+@my_tag {{ .StartCommand }} HOST COMMIT_ID WORKFLOW_PATH [-e ENV=value] [--input name=value] [--timeout DURATION]
 
 OPTIONAL PARAMS:
 - WORKFLOW_PATH
 - `-e ENV=value`
+- `--input name=value` (repeatable): workflow_dispatch input, checked against the inputs the workflow declares. The job then runs on the workflow_dispatch event.
+Call `@my_tag {{ $.HelpCommand }} WORKFLOW_PATH [REF]` to see them.
+- `--timeout DURATION` such as `2h` or `90m`: the job is cancelled once it runs longer.
+It can't exceed the maximum duration of the host and the workflow, which applies when omitted.
 
 #### Ex: `@my_tag {{ .StartCommand }} h200 SOME_SHA .github/workflows/dynamic-gpu-test.yml -e TEST_CASE=kandinsky5`
 
 #### Ex: `@my_tag {{ .StartCommand }} h200 SOME_SHA .github/workflows/global-gpu-test.yml`
+
+MATRIX: `--matrix AXIS=value1,value2` (repeatable) runs a job per combination and posts a single summary.
+The `host` axis replaces HOST, any other axis is passed as `-e AXIS=value`.
+
+#### Ex: `@my_tag {{ .StartCommand }} SOME_SHA .github/workflows/dynamic-gpu-test.yml --matrix host=h100,h200 --matrix TEST_CASE=a,b`
+
+@my_tag {{ .RerunCommand }} [JOB_ID] [--host HOST] [--ref COMMIT_ID] [--input name=value] [--timeout DURATION]
+
+Schedules a previous job again with the same parameters, by default the last job of this issue.
+`--host`, `--ref`, `--input` and `--timeout` override the stored ones.
+
+#### Ex: `@my_tag {{ .RerunCommand }} --host h100`
+
+@my_tag {{ .ListCommand }} [REF]
+
+Lists the workflows at REF, the default branch when omitted. Workflows are also checked before every start:
+the file must exist and parse, `needs` must name existing jobs and `runs-on` must match a platform of the host.
 {{ end -}}
 
 #### Supported hosts:
@@ -23,4 +60,5 @@ OPTIONAL PARAMS:
 #### {{ $key }}
 ===================
 {{- end }}
-{{- end }}
\ No newline at end of file
+{{- end }}
+{{- end }}
@@ -0,0 +1,22 @@
+{{define "content"}}
+## BeepBoop: Matrix group `{{ .GroupId }}` finished
+
+| Host | Matrix | Job | Status |
+|------|--------|-----|--------|
+{{- range .Jobs }}
+| {{ .Host }} | {{ .Axes }} | {{ if .JobId }}`{{ .JobId }}`{{ end }} | {{ if .Error }}:warning: not scheduled{{ else if eq .Status "success" }}:white_check_mark: success{{ else if eq .Status "failure" }}:x: failure{{ else if eq .Status "timeout" }}:hourglass: timeout{{ else }}{{ .Status }}{{ end }} |
+{{- end }}
+{{ range .Jobs }}{{ if .JobId }}
+<details><summary>{{ .Host }} {{ .Axes }}</summary>
+
+{{ .ReportText }}
+{{ if .LogExcerpt }}
+Failure log excerpt ({{ .LogExcerptKind }}):
+
+````text
+{{ .LogExcerpt }}
+````
+{{ end }}
+</details>
+{{ end }}{{ end }}
+{{- end }}
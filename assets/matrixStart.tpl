@@ -0,0 +1,9 @@
+{{define "content" -}}
+BeepBoop: {{ len .Jobs }} matrix jobs started (group `{{ .GroupId }}`)
+
+| Host | Matrix | Job | Logs |
+|------|--------|-----|------|
+{{- range .Jobs }}
+| {{ .Host }} | {{ .Axes }} | {{ if .Error }}:warning: not scheduled: {{ .Error }}{{ else }}`{{ .JobId }}`{{ end }} | {{ if not .Error }}[logs]({{ $.MyDSN }}/job/logs?host={{ .Host }}&job_id={{ .JobId }}){{ end }} |
+{{- end }}
+{{- end}}
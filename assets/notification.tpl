@@ -0,0 +1,8 @@
+{{define "content" -}}
+{{ if eq .Event "started" -}}
+:rocket: Job `{{ .JobId }}` started on *{{ .Host }}* for {{ .Repository }}#{{ .IssueNumber }} by {{ .Sender }}
+Logs: {{ .MyDSN }}/job/logs?host={{ .Host }}&job_id={{ .JobId }}
+{{- else -}}
+{{ if eq .Status "success" }}:white_check_mark:{{ else if eq .Status "failure" }}:x:{{ else if eq .Status "timeout" }}:hourglass:{{ else }}:checkered_flag:{{ end }} Job `{{ .JobId }}` on *{{ .Host }}* reported{{ if .Status }} {{ .Status }}{{ end }} for {{ .Repository }}#{{ .IssueNumber }} (requested by {{ .Sender }})
+{{- end }}
+{{- end }}
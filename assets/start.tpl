@@ -1,6 +1,21 @@
 {{define "content" -}}
 BeepBoop: new job started
+{{- if .Schedule }}
+Scheduled run of {{ .Schedule }}
+{{- end }}
+{{- if .RerunOf }}
+Re-run of job {{ .RerunOf }}
+{{- end }}
 Log tracking url: {{.MyDSN}}/job/logs?host={{.JobHost}}&job_id={{.JobResponse.JobId}}
+{{- if .Timeout }}
+Time limit: {{ .Timeout }}
+{{- end }}
+{{- if .Inputs }}
+Inputs:{{ range .Inputs }} `{{ . }}`{{ end }}
+{{- end }}
+{{- range .Warnings }}
+:warning: {{ . }}
+{{- end }}
 {{ if gt (len .CustomFlags) 0 }}
 Detected Docker Environment:
 {{ "\n" -}}
@@ -2,5 +2,13 @@
 ## BeepBoop: Worker has sent a report
 
 {{ .ReportText }}
+{{ if .LogExcerpt }}
+<details><summary>Failure log excerpt ({{ .LogExcerptKind }})</summary>
 
+````text
+{{ .LogExcerpt }}
+````
+
+</details>
+{{ end }}
 {{- end }}
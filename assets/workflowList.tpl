@@ -0,0 +1,19 @@
+{{define "content" -}}
+BeepBoop: workflows at `{{ .Ref }}`
+{{ if .Workflows }}
+| Workflow | Name | Jobs |
+|----------|------|------|
+{{- range .Workflows }}
+| `{{ .Path }}` | {{ .Name }} | {{ .Jobs }} |
+{{- end }}
+{{- else }}
+No valid workflow found.
+{{- end }}
+{{- if .Problems }}
+
+Invalid workflows:
+{{- range .Problems }}
+- :warning: {{ . }}
+{{- end }}
+{{- end }}
+{{- end}}
@@ -1,15 +1,31 @@
 package conf
 
 import (
+	"fmt"
 	"github.com/caarlos0/env/v11"
-	"github.com/golang/glog"
 	"gopkg.in/yaml.v2"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 )
 
 var GeneralEnvironments GeneralEnvironment
 var GithubEnvironment GithubAPIEnvironment
+var GitlabEnvironment GitlabAPIEnvironment
 var Hosts *HostsEnvironment
+var Notifications *NotificationsEnvironment
+var Webhooks *WebhooksEnvironment
+var LogExcerptEnv LogExcerptEnvironment
+var OutboxEnv OutboxEnvironment
+var AdminEnv AdminEnvironment
+var TracingEnv TracingEnvironment
+var LoggingEnv LoggingEnvironment
+var HAEnv HAEnvironment
+var StorageEnv StorageEnvironment
+var SecretsEnv SecretsEnvironment
+var RedactEnv RedactEnvironment
+var Schedules *SchedulesEnvironment
 
 //
 
@@ -18,10 +34,141 @@ type Host struct {
 	MaxConcurrency int      `yaml:"max_concurrent_jobs"`
 	TlsCert        *string  `yaml:"tls_cert"`
 	CustomFlags    []string `yaml:"custom_flags"`
+	// schedules may target a label instead of a host
+	Labels []string `yaml:"labels"`
+	// docker options users may pass, the default policy applies when unset
+	ContainerPolicy *ContainerPolicy `yaml:"container_policy"`
+	// jobs running longer are cancelled, replaces the max_job_duration of the hosts file
+	MaxJobDuration time.Duration `yaml:"max_job_duration"`
+	// repository secrets are only sent over TLS unless set, e.g. for a host reached through a private network.
+	// Either way they end up in the act command line on the host, see Flags in pkg/secrets.
+	AllowPlaintextSecrets bool `yaml:"allow_plaintext_secrets"`
+}
+
+// ContainerPolicy restricts the docker options given after the workflow path of /wf_start.
+// Flags are compared in their long form, -e and --env are the same flag.
+type ContainerPolicy struct {
+	// only these flags are accepted when set
+	AllowedFlags []string `yaml:"allowed_flags"`
+	DeniedFlags  []string `yaml:"denied_flags"`
+	// bind mount sources must be one of these directories or under one when set
+	AllowedMounts []string `yaml:"allowed_mounts"`
+	DeniedMounts  []string `yaml:"denied_mounts"`
+	// env variable name globs, e.g. TEST_*
+	AllowedEnv []string        `yaml:"allowed_env"`
+	DeniedEnv  []string        `yaml:"denied_env"`
+	Limits     ContainerLimits `yaml:"limits"`
+}
+
+// ContainerLimits caps the resources users may ask for, zero values don't cap
+type ContainerLimits struct {
+	// docker sizes such as 64g
+	Memory  string  `yaml:"memory"`
+	ShmSize string  `yaml:"shm_size"`
+	Cpus    float64 `yaml:"cpus"`
+	Gpus    int     `yaml:"gpus"`
+	Pids    int64   `yaml:"pids"`
 }
 
 type HostsEnvironment struct {
 	Hosts map[string]Host
+	// policy of the hosts without their own, the built-in one denying privileges, mounts and networking when unset
+	DefaultContainerPolicy *ContainerPolicy `yaml:"default_container_policy"`
+	// limit of the hosts without their own, jobs aren't limited when 0
+	MaxJobDuration time.Duration `yaml:"max_job_duration"`
+	// limits per workflow path glob, e.g. .github/workflows/gpu-*.yml, the host limit still applies
+	WorkflowMaxJobDuration map[string]time.Duration `yaml:"workflow_max_job_duration"`
+}
+
+//
+
+// NotificationSink is a Slack compatible incoming webhook (Mattermost accepts the same payload)
+type NotificationSink struct {
+	URL string `yaml:"url"`
+	// optional overrides, ignored by Slack apps bound to a channel
+	Channel  string `yaml:"channel"`
+	Username string `yaml:"username"`
+	IconURL  string `yaml:"icon_url"`
+}
+
+// NotificationRoute sends the matching events to its sinks, empty filters match everything
+type NotificationRoute struct {
+	Sinks        []string `yaml:"sinks"`
+	Events       []string `yaml:"events"`
+	Repositories []string `yaml:"repositories"` // "owner/repo"
+	Hosts        []string `yaml:"hosts"`
+	Users        []string `yaml:"users"`
+}
+
+type NotificationsEnvironment struct {
+	Timeout time.Duration               `yaml:"timeout"`
+	Sinks   map[string]NotificationSink `yaml:"sinks"`
+	Routes  []NotificationRoute         `yaml:"routes"`
+}
+
+//
+
+// WebhookEndpoint receives job lifecycle events signed with HMAC-SHA256 of Secret
+type WebhookEndpoint struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+	// name of an environment variable holding the secret, keeps it out of the file
+	SecretEnv string `yaml:"secret_env"`
+	// event types to deliver, all when empty
+	Events []string `yaml:"events"`
+}
+
+type WebhooksEnvironment struct {
+	Timeout     time.Duration              `yaml:"timeout"`
+	MaxAttempts int                        `yaml:"max_attempts"`
+	BaseBackoff time.Duration              `yaml:"base_backoff"`
+	MaxBackoff  time.Duration              `yaml:"max_backoff"`
+	LogSize     int                        `yaml:"delivery_log_size"`
+	Endpoints   map[string]WebhookEndpoint `yaml:"endpoints"`
+}
+
+//
+
+// Catch-up policies of schedules missed while no replica was leading
+const (
+	CatchUpSkip   = "skip"
+	CatchUpLatest = "latest"
+	CatchUpAll    = "all"
+)
+
+// Schedule starts a workflow at the times of a cron expression and reports to a tracking issue
+type Schedule struct {
+	// minute hour day-of-month month day-of-week, or @hourly, @daily, @weekly, @monthly, @yearly
+	Cron string `yaml:"cron"`
+	// github when empty
+	Forge      string `yaml:"forge"`
+	Repository string `yaml:"repository"` // "owner/repo"
+	Ref        string `yaml:"ref"`
+	Workflow   string `yaml:"workflow"`
+	// either a host or a host label, the least busy host carrying the label runs the job
+	Host      string            `yaml:"host"`
+	HostLabel string            `yaml:"host_label"`
+	Env       map[string]string `yaml:"env"`
+	// workflow_dispatch inputs
+	Inputs map[string]string `yaml:"inputs"`
+	// issue receiving the start and report comments
+	TrackingIssue int `yaml:"tracking_issue"`
+	// overrides the global policy
+	CatchUp string `yaml:"catch_up"`
+	// like --timeout, capped by the max_job_duration of the host and the workflow
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type SchedulesEnvironment struct {
+	// IANA zone the cron expressions are evaluated in, UTC when empty
+	Timezone string `yaml:"timezone"`
+	// skip, latest or all
+	CatchUp string `yaml:"catch_up"`
+	// upper bound of runs fired per schedule by the all policy
+	MaxCatchUp int `yaml:"max_catch_up"`
+	// a run started later than this after its time counts as missed
+	Grace     time.Duration       `yaml:"grace"`
+	Schedules map[string]Schedule `yaml:"schedules"`
 }
 
 //
@@ -31,17 +178,144 @@ type ServerEnvironment struct {
 	StreamDSN      string `env:"STREAM_DSN" envDefault:"http://localhost:8000"`
 	AllowOrigins   string `env:"ALLOW_ORIGINS" envDefault:"*"`
 	StaticFileRoot string `env:"STATIC_FILE_ROOT"`
+	// deadline of the drain phase on SIGTERM/SIGINT: in-flight requests, report processing and connections
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
 }
 
 type GeneralEnvironment struct {
 	HostConf    string   `env:"HOST_CONF"`
 	DryRunJobs  bool     `env:"DRY_RUN_JOBS" envDefault:"false"`
 	AllowedTags []string `env:"ALLOWED_TAGS" envSeparator:"," envDefault:"@qa-r2d2,@bot"`
+	// chat notification sinks and routes (yaml), notifications are off when empty
+	NotifyConf string `env:"NOTIFY_CONF"`
+	// outbound job event webhooks (yaml), off when empty
+	WebhooksConf string `env:"WEBHOOKS_CONF"`
+	// upper bound of jobs a single /wf_start --matrix may expand into
+	MaxMatrixJobs int `env:"MATRIX_MAX_JOBS" envDefault:"16"`
+	// how long /wf_rerun can find a job, forever when 0
+	JobSpecTTL time.Duration `env:"JOB_SPEC_TTL" envDefault:"720h"`
+	// fetch the workflow at the commit and check it before scheduling
+	ValidateWorkflows bool `env:"VALIDATE_WORKFLOWS" envDefault:"true"`
+	// cron scheduled workflow runs (yaml), off when empty
+	SchedulesConf string `env:"SCHEDULES_CONF"`
+	// how often the leader looks for jobs past their maximum duration
+	WatchdogInterval time.Duration `env:"WATCHDOG_INTERVAL" envDefault:"30s"`
 }
 
 type GithubAPIEnvironment struct {
 	AppID          string `env:"GITHUB_APP_ID"`
 	PrivateKeyPath string `env:"GITHUB_PRIVATE_KEY_PATH"`
+	// PKCS#1 or PKCS#8 key as PEM or base64, takes precedence over PrivateKeyPath
+	PrivateKey string `env:"GITHUB_PRIVATE_KEY"`
+	// external process reading the JWT signing input on stdin and printing a base64 signature,
+	// the way to sign with a KMS or HSM held key. A JSON array of the program and its arguments
+	// (["/opt/kms tools/sign", "--key", "app key"]), or plain words separated by spaces.
+	SignerCommand string        `env:"GITHUB_JWT_SIGNER_COMMAND"`
+	SignerTimeout time.Duration `env:"GITHUB_JWT_SIGNER_TIMEOUT" envDefault:"10s"`
+	// how long the installation of a repository is trusted before it is looked up again, a repository can move
+	// to another installation; 0 keeps it until GitHub rejects the installation
+	InstallationIdTTL time.Duration `env:"GITHUB_INSTALLATION_ID_TTL" envDefault:"1h"`
+	// REST endpoint, e.g. https://github.example.com/api/v3/ for GitHub Enterprise Server
+	BaseURL   string `env:"GITHUB_API_URL" envDefault:"https://api.github.com/"`
+	UploadURL string `env:"GITHUB_UPLOAD_URL"`
+	// extra CA bundle (PEM) trusted for the API endpoint
+	CACertPath string        `env:"GITHUB_CA_CERT"`
+	ProxyURL   string        `env:"GITHUB_PROXY_URL"`
+	Timeout    time.Duration `env:"GITHUB_TIMEOUT" envDefault:"30s"`
+	// fmt format of the clone URL, receives "owner/repo"
+	CloneURLFormat string `env:"GITHUB_CLONE_URL_FORMAT" envDefault:"git@github.com:%s.git"`
+}
+
+type GitlabAPIEnvironment struct {
+	// instance root, the REST API lives under /api/v4
+	URL string `env:"GITLAB_URL" envDefault:"https://gitlab.com"`
+	// personal, group or project access token of the bot user (api scope)
+	Token string `env:"GITLAB_TOKEN"`
+	// secret configured on the webhook, sent back as X-Gitlab-Token; the webhook is disabled when empty
+	WebhookToken string        `env:"GITLAB_WEBHOOK_TOKEN"`
+	Timeout      time.Duration `env:"GITLAB_TIMEOUT" envDefault:"30s"`
+	// fmt format of the clone URL, receives "group/project"
+	CloneURLFormat string `env:"GITLAB_CLONE_URL_FORMAT" envDefault:"git@gitlab.com:%s.git"`
+}
+
+type LogExcerptEnvironment struct {
+	Enabled bool `env:"LOG_EXCERPT_ENABLED" envDefault:"true"`
+	// lines kept from the end of the job log before heuristics are applied
+	ScanLines     int      `env:"LOG_EXCERPT_SCAN_LINES" envDefault:"2000"`
+	TailLines     int      `env:"LOG_EXCERPT_TAIL_LINES" envDefault:"40"`
+	ContextLines  int      `env:"LOG_EXCERPT_CONTEXT_LINES" envDefault:"3"`
+	MaxLines      int      `env:"LOG_EXCERPT_MAX_LINES" envDefault:"80"`
+	ErrorPatterns []string `env:"LOG_EXCERPT_ERROR_PATTERNS" envSeparator:";" envDefault:"(?i)\\berror\\b;(?i)\\bfailed\\b;(?i)\\bexception\\b;^--- FAIL:;^FAIL\\b"`
+	// <dir>/<host>/<job_id>.log or <dir>/<job_id>.log is preferred over JobLogStream when present
+	ArchiveDir   string        `env:"LOG_ARCHIVE_DIR"`
+	FetchTimeout time.Duration `env:"LOG_EXCERPT_FETCH_TIMEOUT" envDefault:"20s"`
+}
+
+type OutboxEnvironment struct {
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"5s"`
+	MaxAttempts  int           `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"8"`
+	BaseBackoff  time.Duration `env:"OUTBOX_BASE_BACKOFF" envDefault:"2s"`
+	MaxBackoff   time.Duration `env:"OUTBOX_MAX_BACKOFF" envDefault:"10m"`
+}
+
+type TracingEnvironment struct {
+	// none, stdout or otlp (configured through the standard OTEL_EXPORTER_OTLP_* variables)
+	Exporter    string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	ServiceName string  `env:"TRACING_SERVICE_NAME" envDefault:"qabot"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+}
+
+type LoggingEnvironment struct {
+	// text or json
+	Format string `env:"LOG_FORMAT" envDefault:"text"`
+	// trace, debug, info, warn or error; adjustable at runtime through the admin API
+	Level string `env:"LOG_LEVEL" envDefault:"info"`
+}
+
+// HAEnvironment lets several replicas share the etcd queues: webhooks are served everywhere,
+// the report consumer, the outbox worker and the scheduler only run on the elected leader
+type HAEnvironment struct {
+	Enabled        bool   `env:"HA_ENABLED" envDefault:"false"`
+	ElectionPrefix string `env:"HA_ELECTION_PREFIX" envDefault:"/qabot/leader/"`
+	// hostname when empty
+	ReplicaId string `env:"HA_REPLICA_ID"`
+	// lease of the leader key, a crashed leader is replaced within this time
+	SessionTTL time.Duration `env:"HA_SESSION_TTL" envDefault:"5s"`
+	// pause before campaigning again after an etcd error or a failed term, doubled up to MaxRetryInterval
+	RetryInterval    time.Duration `env:"HA_RETRY_INTERVAL" envDefault:"1s"`
+	MaxRetryInterval time.Duration `env:"HA_MAX_RETRY_INTERVAL" envDefault:"30s"`
+}
+
+// StorageEnvironment selects where job meta, worker reports and the outbox live
+type StorageEnvironment struct {
+	// etcd or memory, the memory backend serves a single replica
+	Backend string `env:"STORAGE_BACKEND" envDefault:"etcd"`
+	// memory backend snapshot, kept in memory only when empty
+	File string `env:"STORAGE_FILE"`
+}
+
+// SecretsEnvironment holds the server key sealing the repository secrets, the secret store is disabled without one
+type SecretsEnvironment struct {
+	// base64 of a 32 bytes AES-256 key
+	Key string `env:"SECRETS_KEY"`
+	// file holding the base64 key, read when SECRETS_KEY is empty
+	KeyFile string `env:"SECRETS_KEY_FILE"`
+}
+
+// RedactEnvironment configures the masking of log lines and worker reports, the job secrets are always masked
+type RedactEnvironment struct {
+	Enabled bool `env:"REDACT_ENABLED" envDefault:"true"`
+	// the first capture group is masked when the pattern has one, the whole match otherwise
+	Patterns []string `env:"REDACT_PATTERNS" envSeparator:";" envDefault:"\\b((?:AKIA|ASIA)[0-9A-Z]{16})\\b;\\b(gh[pousr]_[A-Za-z0-9]{36,})\\b;\\b(github_pat_[A-Za-z0-9_]{22,})\\b;(?i)\\bbearer\\s+([A-Za-z0-9._~+/-]+=*)"`
+	// Shannon entropy in bits per character above which a long token is masked, 0 disables the detection
+	EntropyThreshold float64 `env:"REDACT_ENTROPY_THRESHOLD" envDefault:"4.5"`
+	EntropyMinLength int     `env:"REDACT_ENTROPY_MIN_LENGTH" envDefault:"24"`
+	Mask             string  `env:"REDACT_MASK" envDefault:"***"`
+}
+
+type AdminEnvironment struct {
+	// admin API is disabled when empty
+	Token string `env:"ADMIN_TOKEN"`
 }
 
 //
@@ -52,6 +326,10 @@ type TemplatesEnvironment struct {
 	BaseCommandTemplate  string `env:"BASE_TEMPLATE" envDefault:"assets/base.tpl"`
 	ErrorTemplate        string `env:"ERROR_TEMPLATE" envDefault:"assets/error.tpl"`
 	WorkerReportTemplate string `env:"WORKER_REPORT" envDefault:"assets/workerReport.tpl"`
+	NotificationTemplate string `env:"NOTIFICATION_TEMPLATE" envDefault:"assets/notification.tpl"`
+	MatrixStartTemplate  string `env:"MATRIX_START_TEMPLATE" envDefault:"assets/matrixStart.tpl"`
+	MatrixReportTemplate string `env:"MATRIX_REPORT_TEMPLATE" envDefault:"assets/matrixReport.tpl"`
+	WorkflowListTemplate string `env:"WORKFLOW_LIST_TEMPLATE" envDefault:"assets/workflowList.tpl"`
 }
 
 func NewEnviron(environ any) {
@@ -64,7 +342,7 @@ func NewHostsEnvironment(hostsConf string) (*HostsEnvironment, error) {
 	var hosts HostsEnvironment
 	hostsConfFile, err := os.Open(hostsConf)
 	if err != nil {
-		glog.Errorf("failed to open hosts configuration file: %s", err)
+		slog.Error("failed to open hosts configuration file", "error", err)
 		return nil, err
 	}
 	err = yaml.NewDecoder(hostsConfFile).Decode(
@@ -75,3 +353,112 @@ func NewHostsEnvironment(hostsConf string) (*HostsEnvironment, error) {
 	}
 	return &hosts, nil
 }
+
+func NewNotificationsEnvironment(notifyConf string) (*NotificationsEnvironment, error) {
+	var notifications NotificationsEnvironment
+	notifyConfFile, err := os.Open(notifyConf)
+	if err != nil {
+		slog.Error("failed to open notifications configuration file", "error", err)
+		return nil, err
+	}
+	defer func() {
+		_ = notifyConfFile.Close()
+	}()
+	if err = yaml.NewDecoder(notifyConfFile).Decode(&notifications); err != nil {
+		return nil, err
+	}
+	for i, route := range notifications.Routes {
+		if len(route.Sinks) == 0 {
+			return nil, fmt.Errorf("notification route %d has no sinks", i)
+		}
+		for _, sink := range route.Sinks {
+			if _, ok := notifications.Sinks[sink]; !ok {
+				return nil, fmt.Errorf("notification route %d refers to unknown sink %s", i, sink)
+			}
+		}
+	}
+	if notifications.Timeout <= 0 {
+		notifications.Timeout = 10 * time.Second
+	}
+	return &notifications, nil
+}
+
+func NewWebhooksEnvironment(webhooksConf string) (*WebhooksEnvironment, error) {
+	webhooks := WebhooksEnvironment{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 6,
+		BaseBackoff: 2 * time.Second,
+		MaxBackoff:  5 * time.Minute,
+		LogSize:     500,
+	}
+	webhooksConfFile, err := os.Open(webhooksConf)
+	if err != nil {
+		slog.Error("failed to open webhooks configuration file", "error", err)
+		return nil, err
+	}
+	defer func() {
+		_ = webhooksConfFile.Close()
+	}()
+	if err = yaml.NewDecoder(webhooksConfFile).Decode(&webhooks); err != nil {
+		return nil, err
+	}
+	for name, endpoint := range webhooks.Endpoints {
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("webhook endpoint %s has no url", name)
+		}
+		if endpoint.SecretEnv != "" {
+			endpoint.Secret = os.Getenv(endpoint.SecretEnv)
+			if endpoint.Secret == "" {
+				return nil, fmt.Errorf("webhook endpoint %s: %s is empty", name, endpoint.SecretEnv)
+			}
+			webhooks.Endpoints[name] = endpoint
+		}
+	}
+	return &webhooks, nil
+}
+
+func NewSchedulesEnvironment(schedulesConf string) (*SchedulesEnvironment, error) {
+	schedules := SchedulesEnvironment{
+		CatchUp:    CatchUpSkip,
+		MaxCatchUp: 3,
+		Grace:      time.Minute,
+	}
+	schedulesConfFile, err := os.Open(schedulesConf)
+	if err != nil {
+		slog.Error("failed to open schedules configuration file", "error", err)
+		return nil, err
+	}
+	defer func() {
+		_ = schedulesConfFile.Close()
+	}()
+	if err = yaml.NewDecoder(schedulesConfFile).Decode(&schedules); err != nil {
+		return nil, err
+	}
+	if _, err = time.LoadLocation(schedules.Timezone); err != nil {
+		return nil, fmt.Errorf("schedules timezone: %w", err)
+	}
+	if !validCatchUp(schedules.CatchUp) {
+		return nil, fmt.Errorf("unknown catch_up policy %s", schedules.CatchUp)
+	}
+	for name, schedule := range schedules.Schedules {
+		switch {
+		case schedule.Cron == "":
+			return nil, fmt.Errorf("schedule %s has no cron", name)
+		case strings.Count(schedule.Repository, "/") < 1:
+			return nil, fmt.Errorf("schedule %s: repository must be owner/repo", name)
+		case schedule.Ref == "":
+			return nil, fmt.Errorf("schedule %s has no ref", name)
+		case (schedule.Host == "") == (schedule.HostLabel == ""):
+			return nil, fmt.Errorf("schedule %s needs exactly one of host and host_label", name)
+		case schedule.TrackingIssue <= 0:
+			return nil, fmt.Errorf("schedule %s has no tracking_issue", name)
+		case schedule.CatchUp != "" && !validCatchUp(schedule.CatchUp):
+			return nil, fmt.Errorf("schedule %s: unknown catch_up policy %s", name, schedule.CatchUp)
+		}
+	}
+	return &schedules, nil
+}
+
+func validCatchUp(policy string) bool {
+	return policy == CatchUpSkip || policy == CatchUpLatest || policy == CatchUpAll
+}
@@ -2,8 +2,10 @@ package conf
 
 import (
 	"ActQABot/internal/etcd_utils"
+	"ActQABot/internal/metrics"
 	"github.com/caarlos0/env/v11"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
 	"time"
 )
 
@@ -22,6 +24,7 @@ func NewEtcdConfFromEnv() (*EtcdConf, error) {
 			clientv3.Config{
 				Endpoints:   cfg.Endpoints,
 				DialTimeout: cfg.DialTimeout,
+				DialOptions: []grpc.DialOption{grpc.WithChainUnaryInterceptor(metrics.EtcdUnaryInterceptor)},
 			},
 		)
 		if err != nil {
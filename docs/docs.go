@@ -15,9 +15,726 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/leader": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "HA leader status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/leader.Status"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/log/level": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get log level",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.LogLevel"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Set log level",
+                "parameters": [
+                    {
+                        "description": "New level",
+                        "name": "level",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.LogLevel"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.LogLevel"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/dead/": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List outbox dead letters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.OutboxDeadList"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/dead/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Inspect an outbox dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Outbox item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/outbox.Item"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Purge an outbox dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Outbox item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/dead/{id}/replay": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Replay an outbox dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Outbox item ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/outbox.Item"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/reports/dead/": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List worker report dead letters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.ReportDeadList"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/reports/dead/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Inspect a worker report dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/worker_report.DeadReport"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Purge a worker report dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/reports/dead/{id}/replay": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Replay a worker report dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/worker_report.JobReport"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/secrets/": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List repository secrets",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "github",
+                        "description": "github or gitlab, github when empty",
+                        "name": "forge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "h200",
+                        "description": "host from the hosts configuration",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "owner/repo",
+                        "description": "owner/repo, the GitLab project path",
+                        "name": "repository",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.SecretList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/secrets/{name}": {
+            "put": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Set a repository secret",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Secret name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "github",
+                        "description": "github or gitlab, github when empty",
+                        "name": "forge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "h200",
+                        "description": "host from the hosts configuration",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "owner/repo",
+                        "description": "owner/repo, the GitLab project path",
+                        "name": "repository",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Secret value",
+                        "name": "value",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.SecretValue"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/secrets.Secret"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Delete a repository secret",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Secret name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "github",
+                        "description": "github or gitlab, github when empty",
+                        "name": "forge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "h200",
+                        "description": "host from the hosts configuration",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "owner/repo",
+                        "description": "owner/repo, the GitLab project path",
+                        "name": "repository",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/deliveries/": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "dashboard",
+                        "description": "Endpoint name from the webhooks configuration",
+                        "name": "endpoint",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "6f1c1d2e-0000-0000-0000-000000000000",
+                        "description": "Event ID (X-QABot-Delivery)",
+                        "name": "event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_api.WebhookDeliveryList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
         "/github/events/": {
             "post": {
-                "description": "GitHub Webhooks: issue_comment, ping etc.",
+                "description": "GitHub Webhooks: issue_comment, ping etc.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "github"
+                ],
+                "summary": "GitHub webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "GitHub Event Type (e.g. 'issue_comment')",
+                        "name": "X-GitHub-Event",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "example": false,
+                        "description": "If true, server will respond back to GitHub after processing",
+                        "name": "post_back",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Webhook payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_api.IssueCommentEvent"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Shutting down, retry later",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    }
+                }
+            }
+        },
+        "/gitlab/events/": {
+            "post": {
+                "description": "GitLab Webhooks: merge request notes (Note Hook)",
                 "consumes": [
                     "application/json"
                 ],
@@ -25,21 +742,28 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "github"
+                    "gitlab"
                 ],
-                "summary": "GitHub webhook",
+                "summary": "GitLab webhook",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "GitHub Event Type (e.g. 'issue_comment')",
-                        "name": "X-GitHub-Event",
+                        "description": "GitLab Event Type (e.g. 'Note Hook')",
+                        "name": "X-Gitlab-Event",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Secret token configured on the webhook",
+                        "name": "X-Gitlab-Token",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "boolean",
                         "example": false,
-                        "description": "If true, server will respond back to GitHub after processing",
+                        "description": "If true, server will respond back to GitLab after processing",
                         "name": "post_back",
                         "in": "query"
                     },
@@ -49,7 +773,7 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/github_api.IssueCommentEvent"
+                            "$ref": "#/definitions/gitlab_api.NoteEvent"
                         }
                     }
                 ],
@@ -66,10 +790,25 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
+                        }
+                    },
+                    "503": {
+                        "description": "Shutting down, retry later",
+                        "schema": {
+                            "$ref": "#/definitions/base_api.APIError"
                         }
                     }
                 }
@@ -147,7 +886,7 @@ const docTemplate = `{
         },
         "/job/logs/": {
             "get": {
-                "description": "Stream logs from a remote job using gRPC and send via SSE",
+                "description": "Stream logs from a remote job using gRPC and send via SSE.\nA ` + "`" + `reconnect` + "`" + ` event with ` + "`" + `{\"reconnect\": true}` + "`" + ` data is sent before the server shuts down.",
                 "produces": [
                     "text/event-stream"
                 ],
@@ -186,13 +925,22 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "404": {
+                        "description": "unknown job",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
         "/worker/report/": {
             "post": {
-                "description": "Decodes worker report data, sends a business event, and returns a success response.",
+                "description": "Decodes worker report data, sends a business event, and returns a success response.\nA report without status is progress. The last report of a job must carry its status:\nthe job finished notification and event and the matrix summary wait for it.",
                 "consumes": [
                     "application/json"
                 ],
@@ -238,6 +986,75 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "admin_api.LogLevel": {
+            "description": "runtime log level",
+            "type": "object",
+            "properties": {
+                "level": {
+                    "description": "trace, debug, info, warn or error",
+                    "type": "string",
+                    "example": "debug"
+                }
+            }
+        },
+        "admin_api.OutboxDeadList": {
+            "description": "dead-lettered outbox items",
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/outbox.Item"
+                    }
+                }
+            }
+        },
+        "admin_api.ReportDeadList": {
+            "description": "dead-lettered worker reports",
+            "type": "object",
+            "properties": {
+                "reports": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/worker_report.DeadReport"
+                    }
+                }
+            }
+        },
+        "admin_api.SecretList": {
+            "description": "repository secrets",
+            "type": "object",
+            "properties": {
+                "secrets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/secrets.Secret"
+                    }
+                }
+            }
+        },
+        "admin_api.SecretValue": {
+            "description": "secret value",
+            "type": "object",
+            "properties": {
+                "value": {
+                    "type": "string",
+                    "example": "hf_xxx"
+                }
+            }
+        },
+        "admin_api.WebhookDeliveryList": {
+            "description": "webhook delivery log",
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhooks.Delivery"
+                    }
+                }
+            }
+        },
         "base_api.APIError": {
             "type": "object",
             "properties": {
@@ -321,12 +1138,296 @@ const docTemplate = `{
                 }
             }
         },
+        "gitlab_api.NoteEvent": {
+            "description": "GitLab note (comment) webhook payload",
+            "type": "object",
+            "properties": {
+                "merge_request": {
+                    "type": "object",
+                    "properties": {
+                        "iid": {
+                            "type": "integer",
+                            "example": 1
+                        }
+                    }
+                },
+                "object_attributes": {
+                    "type": "object",
+                    "properties": {
+                        "action": {
+                            "description": "create or update, absent on older GitLab versions",
+                            "type": "string",
+                            "example": "create"
+                        },
+                        "id": {
+                            "type": "integer",
+                            "example": 1244
+                        },
+                        "note": {
+                            "type": "string",
+                            "example": "@bot /help"
+                        },
+                        "noteable_type": {
+                            "description": "Commit, MergeRequest, Issue or Snippet",
+                            "type": "string",
+                            "example": "MergeRequest"
+                        }
+                    }
+                },
+                "object_kind": {
+                    "type": "string",
+                    "example": "note"
+                },
+                "project": {
+                    "type": "object",
+                    "properties": {
+                        "path_with_namespace": {
+                            "description": "\"group/subgroup/project\"",
+                            "type": "string",
+                            "example": "group/project"
+                        }
+                    }
+                },
+                "user": {
+                    "type": "object",
+                    "properties": {
+                        "username": {
+                            "type": "string",
+                            "example": "jdoe"
+                        }
+                    }
+                }
+            }
+        },
+        "leader.Status": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "is_leader": {
+                    "type": "boolean"
+                },
+                "leader": {
+                    "description": "replica ID of the current leader, empty during an election",
+                    "type": "string",
+                    "example": "qabot-7d9f8"
+                },
+                "leader_since": {
+                    "type": "string"
+                },
+                "replica_id": {
+                    "type": "string",
+                    "example": "qabot-7d9f8"
+                }
+            }
+        },
+        "outbox.Attempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "outbox.Item": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/outbox.Attempt"
+                    }
+                },
+                "comment_id": {
+                    "type": "integer"
+                },
+                "enqueued_at": {
+                    "type": "string"
+                },
+                "forge": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "issue_number": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "$ref": "#/definitions/outbox.Kind"
+                },
+                "next_attempt": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "repo": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "trace": {
+                    "description": "trace context of the request or report the write belongs to",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/tracing.Carrier"
+                        }
+                    ]
+                }
+            }
+        },
+        "outbox.Kind": {
+            "type": "string",
+            "enum": [
+                "post_comment",
+                "update_comment"
+            ],
+            "x-enum-varnames": [
+                "KindPostComment",
+                "KindUpdateComment"
+            ]
+        },
+        "secrets.Secret": {
+            "type": "object",
+            "properties": {
+                "forge": {
+                    "type": "string",
+                    "example": "github"
+                },
+                "host": {
+                    "type": "string",
+                    "example": "h200"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "HF_TOKEN"
+                },
+                "repository": {
+                    "type": "string",
+                    "example": "owner/repo"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "tracing.Carrier": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "string"
+            }
+        },
+        "webhooks.Delivery": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "attempt": {
+                    "type": "integer"
+                },
+                "delivered": {
+                    "type": "boolean"
+                },
+                "duration": {
+                    "type": "integer"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
         "worker_api.JobReportResponse": {
             "type": "object"
         },
         "worker_api.JobWorkerReport": {
             "type": "object",
             "properties": {
+                "attempts": {
+                    "description": "why the report was put back, one entry per nack",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/worker_report.ReportAttempt"
+                    }
+                },
+                "id": {
+                    "description": "set when the report is queued, a retried report keeps it",
+                    "type": "string"
+                },
+                "job_id": {
+                    "type": "string"
+                },
+                "report_text": {
+                    "type": "string"
+                },
+                "retried": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "marks the last report of the job, empty for a progress report",
+                    "type": "string",
+                    "enum": [
+                        "success",
+                        "failure",
+                        "cancelled",
+                        "timeout"
+                    ],
+                    "example": "failure"
+                }
+            }
+        },
+        "worker_report.DeadReport": {
+            "type": "object",
+            "properties": {
+                "dead_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0d7f6c44-8a4e-4d2b-9a57-3c1f1a6b2d10"
+                },
+                "reason": {
+                    "description": "error of the last attempt, the whole history is in Report.Attempts",
+                    "type": "string",
+                    "example": "job 5b1c3f0e does not exist"
+                },
+                "report": {
+                    "$ref": "#/definitions/worker_report.JobReport"
+                }
+            }
+        },
+        "worker_report.JobReport": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "why the report was put back, one entry per nack",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/worker_report.ReportAttempt"
+                    }
+                },
+                "id": {
+                    "description": "set when the report is queued, a retried report keeps it",
+                    "type": "string"
+                },
                 "job_id": {
                     "type": "string"
                 },
@@ -335,9 +1436,39 @@ const docTemplate = `{
                 },
                 "retried": {
                     "type": "integer"
+                },
+                "status": {
+                    "description": "marks the last report of the job, empty for a progress report",
+                    "type": "string",
+                    "enum": [
+                        "success",
+                        "failure",
+                        "cancelled",
+                        "timeout"
+                    ],
+                    "example": "failure"
+                }
+            }
+        },
+        "worker_report.ReportAttempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "job 5b1c3f0e does not exist"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
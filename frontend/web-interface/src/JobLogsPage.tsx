@@ -265,6 +265,7 @@ const JobLogsPage = () => {
 
         const abortController = new AbortController();
         abortControllerRef.current = abortController;
+        let reconnectTimer: ReturnType<typeof setTimeout> | undefined;
 
         const fetchLogs = async () => {
             try {
@@ -305,7 +306,17 @@ const JobLogsPage = () => {
                         const dataStr = line.slice(6);
 
                         try {
-                            const data: LogEntry = JSON.parse(dataStr);
+                            const data: LogEntry & { reconnect?: boolean } = JSON.parse(dataStr);
+                            if (data && data.reconnect === true) {
+                                // the server is shutting down, the stream restarts from the beginning on another replica
+                                await reader.cancel();
+                                setConnectionStatus('connecting');
+                                reconnectTimer = setTimeout(() => {
+                                    setLogs([]);
+                                    fetchLogs();
+                                }, 1000);
+                                return;
+                            }
                             if (data && typeof data === 'object' && 'line' in data) {
                                 let parsed = parseLogLine(data);
 
@@ -344,6 +355,7 @@ const JobLogsPage = () => {
         fetchLogs();
 
         return () => {
+            clearTimeout(reconnectTimer);
             if (abortControllerRef.current) {
                 abortControllerRef.current.abort();
             }
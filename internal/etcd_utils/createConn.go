@@ -9,3 +9,13 @@ var EtcdStoreInstance *EtcdStore
 type EtcdStore struct {
 	Client *clientv3.Client
 }
+
+// Close closes the shared client, pending requests fail
+func Close() error {
+	if EtcdStoreInstance == nil || EtcdStoreInstance.Client == nil {
+		return nil
+	}
+	err := EtcdStoreInstance.Client.Close()
+	EtcdStoreInstance = nil
+	return err
+}
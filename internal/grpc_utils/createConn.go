@@ -4,17 +4,37 @@ import (
 	"ActQABot/conf"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 var NewGRPCConn = dialGRPC
 
+// connections are shared per host, a grpc.ClientConn multiplexes calls and reconnects by itself
+var conns = struct {
+	sync.Mutex
+	byHost map[string]*grpc.ClientConn
+}{byHost: make(map[string]*grpc.ClientConn)}
+
+func connKey(host conf.Host) string {
+	if host.TlsCert == nil {
+		return host.Address
+	}
+	return host.Address + "|" + *host.TlsCert
+}
+
 func dialGRPC(host conf.Host) (grpc.ClientConnInterface, error) {
+	conns.Lock()
+	defer conns.Unlock()
+	if conn, ok := conns.byHost[connKey(host)]; ok {
+		return conn, nil
+	}
 	var creds credentials.TransportCredentials
 	if host.TlsCert != nil {
 		certPath, err := filepath.Abs(*host.TlsCert)
@@ -47,5 +67,20 @@ func dialGRPC(host conf.Host) (grpc.ClientConnInterface, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial %s: %w", host.Address, err)
 	}
+	conns.byHost[connKey(host)] = conn
 	return conn, nil
 }
+
+// CloseAll closes the host connections, calls in flight fail with codes.Canceled
+func CloseAll() error {
+	conns.Lock()
+	defer conns.Unlock()
+	var errs []error
+	for key, conn := range conns.byHost {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		delete(conns.byHost, key)
+	}
+	return errors.Join(errs...)
+}
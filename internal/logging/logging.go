@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"ActQABot/conf"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Correlation fields carried through context.Context
+const (
+	KeyDelivery = "delivery_id"
+	KeyRepo     = "repo"
+	KeyIssue    = "issue"
+	KeySender   = "sender"
+	KeyCommand  = "command"
+	KeyHost     = "host"
+	KeyJob      = "job_id"
+	KeyGroup    = "job_group"
+)
+
+// Formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// LevelTrace sits below debug, for per-message chatter like stream frames and lock hand-offs
+const LevelTrace = slog.LevelDebug - 4
+
+var level = new(slog.LevelVar)
+
+type attrsKey struct{}
+
+// Init installs the default slog logger writing to stderr
+func Init(loggingEnv conf.LoggingEnvironment) error {
+	lvl, err := ParseLevel(loggingEnv.Level)
+	if err != nil {
+		return err
+	}
+	handler, err := NewHandler(os.Stderr, loggingEnv.Format)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// NewHandler builds a handler honouring the runtime level and adding the correlation fields of the context
+func NewHandler(w io.Writer, format string) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if lvl, ok := a.Value.Any().(slog.Level); ok {
+					a.Value = slog.StringValue(LevelName(lvl))
+				}
+			}
+			return a
+		},
+	}
+	switch format {
+	case FormatText, "":
+		return &contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case FormatJSON:
+		return &contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+}
+
+// ParseLevel accepts trace, debug, info, warn and error (case insensitive, slog offsets like debug+2 too)
+func ParseLevel(s string) (slog.Level, error) {
+	if strings.EqualFold(s, "trace") {
+		return LevelTrace, nil
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %s", s)
+	}
+	return lvl, nil
+}
+
+func LevelName(lvl slog.Level) string {
+	if lvl == LevelTrace {
+		return "TRACE"
+	}
+	return lvl.String()
+}
+
+func Level() slog.Level {
+	return level.Level()
+}
+
+func SetLevel(lvl slog.Level) {
+	level.Set(lvl)
+}
+
+// With returns a context whose log records carry the given key/value pairs, later values replace earlier ones
+func With(ctx context.Context, args ...any) context.Context {
+	record := slog.Record{}
+	record.Add(args...)
+	parent := Attrs(ctx)
+	attrs := make([]slog.Attr, 0, len(parent)+record.NumAttrs())
+	record.Attrs(
+		func(a slog.Attr) bool {
+			attrs = append(attrs, a)
+			return true
+		},
+	)
+	for i := len(parent) - 1; i >= 0; i-- {
+		if !hasKey(attrs, parent[i].Key) {
+			attrs = append([]slog.Attr{parent[i]}, attrs...)
+		}
+	}
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// Attrs returns the correlation fields stored in the context
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		record.AddAttrs(Attrs(ctx)...)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Fatal logs at error level and exits, the slog counterpart of glog.Fatal
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,270 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const namespace = "qabot"
+
+// Outcome label values
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+var (
+	WebhookEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_events_total",
+			Help:      "Incoming forge webhook events by forge, event type and outcome.",
+		}, []string{"forge", "event", "outcome"},
+	)
+	Commands = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_total",
+			Help:      "Bot commands executed by command name and result.",
+		}, []string{"command", "result"},
+	)
+	ScheduleJobDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "schedule_job_duration_seconds",
+			Help:      "Latency of ActService ScheduleActJob calls per host.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"host"},
+	)
+	ScheduleJobErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schedule_job_errors_total",
+			Help:      "Failed ActService ScheduleActJob calls per host.",
+		}, []string{"host"},
+	)
+	WorkflowValidationFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workflow_validation_failures_total",
+			Help:      "Jobs refused by the workflow pre-flight validation per host.",
+		}, []string{"host"},
+	)
+	ScheduledRuns = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scheduled_runs_total",
+			Help:      "Runs fired by the cron scheduler by schedule and outcome.",
+		}, []string{"schedule", "outcome"},
+	)
+	ScheduledRunsSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scheduled_runs_skipped_total",
+			Help:      "Missed scheduled runs dropped by the catch-up policy.",
+		}, []string{"schedule"},
+	)
+	HostSlots = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "host_slots",
+			Help:      "Configured concurrent job slots per host.",
+		}, []string{"host"},
+	)
+	HostSlotsInUse = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "host_slots_in_use",
+			Help:      "Job slots currently taken per host.",
+		}, []string{"host"},
+	)
+	ContainerPolicyViolations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "container_policy_violations_total",
+			Help:      "Commands rejected by the container options policy per host.",
+		}, []string{"host"},
+	)
+	JobTimeouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_timeouts_total",
+			Help:      "Jobs cancelled by the watchdog for exceeding their maximum duration per host and outcome.",
+		}, []string{"host", "outcome"},
+	)
+	Redactions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redactions_total",
+			Help:      "Values masked before leaving the bot, by source (log_stream, report) and kind (secret, pattern, entropy).",
+		}, []string{"source", "kind"},
+	)
+	ActiveLogStreams = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "log_streams_active",
+			Help:      "Open SSE job log streams.",
+		},
+	)
+	GithubAPICalls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "github_api_calls_total",
+			Help:      "GitHub REST calls by method and status code (0 for transport errors).",
+		}, []string{"method", "code"},
+	)
+	GithubRateLimitRemaining = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "github_rate_limit_remaining",
+			Help:      "Last X-RateLimit-Remaining seen per rate limit resource.",
+		}, []string{"resource"},
+	)
+	JobReportAcks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_report_acks_total",
+			Help:      "Worker report acknowledgements by result.",
+		}, []string{"result"},
+	)
+	JobReportNacks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_report_nacks_total",
+			Help:      "Worker report negative acknowledgements by result.",
+		}, []string{"result"},
+	)
+	JobReportRequeues = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_report_requeues_total",
+			Help:      "Worker reports put back on the queue for another attempt.",
+		},
+	)
+	JobReportDeadLettered = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_report_dead_lettered_total",
+			Help:      "Worker reports moved to the dead-letter queue after too many attempts.",
+		},
+	)
+	EtcdOperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "etcd_operation_duration_seconds",
+			Help:      "Latency of etcd requests by gRPC method and outcome.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"method", "outcome"},
+	)
+	Leader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "leader",
+			Help:      "1 while this replica runs the report consumer and the outbox worker.",
+		},
+	)
+	LeaderChanges = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "leader_changes_total",
+			Help:      "Leadership terms won or lost by this replica.",
+		},
+	)
+)
+
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeOK
+}
+
+// scrapeSource is a gauge value computed on scrape by a function installed later
+type scrapeSource struct {
+	sync.Mutex
+	source func() float64
+}
+
+func (s *scrapeSource) set(source func() float64) {
+	s.Lock()
+	defer s.Unlock()
+	s.source = source
+}
+
+func (s *scrapeSource) value() float64 {
+	s.Lock()
+	source := s.source
+	s.Unlock()
+	if source == nil {
+		return 0
+	}
+	return source()
+}
+
+var reportQueueDepth, deadReports scrapeSource
+
+// SetReportQueueDepthSource installs the function counting queued worker reports on scrape
+func SetReportQueueDepthSource(source func() float64) {
+	reportQueueDepth.set(source)
+}
+
+// SetDeadReportsSource installs the function counting dead-lettered worker reports on scrape
+func SetDeadReportsSource(source func() float64) {
+	deadReports.set(source)
+}
+
+var _ = promauto.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_report_queue_depth",
+		Help:      "Worker reports waiting in the queue.",
+	}, reportQueueDepth.value,
+)
+
+// alert on increase, every entry needs a replay or a purge
+var _ = promauto.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_report_dead_letters",
+		Help:      "Worker reports in the dead-letter queue.",
+	}, deadReports.value,
+)
+
+// EtcdUnaryInterceptor times every unary etcd request
+func EtcdUnaryInterceptor(
+	ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	EtcdOperationDuration.WithLabelValues(method, Outcome(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// GithubTransport counts GitHub REST calls and tracks the rate limit they report
+type GithubTransport struct {
+	Base http.RoundTripper
+}
+
+func (t GithubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		GithubAPICalls.WithLabelValues(req.Method, "0").Inc()
+		return resp, err
+	}
+	GithubAPICalls.WithLabelValues(req.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	if remaining, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64); err == nil {
+		resource := resp.Header.Get("X-RateLimit-Resource")
+		if resource == "" {
+			resource = "core"
+		}
+		GithubRateLimitRemaining.WithLabelValues(resource).Set(remaining)
+	}
+	return resp, nil
+}
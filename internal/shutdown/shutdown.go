@@ -0,0 +1,53 @@
+package shutdown
+
+import (
+	"sync"
+)
+
+// Drain state of the process: once draining, new webhooks are refused and
+// long-lived streams ask their viewers to reconnect to another replica
+var state = newDrainState()
+
+type drainState struct {
+	mu       sync.Mutex
+	draining chan struct{}
+	started  bool
+}
+
+func newDrainState() *drainState {
+	return &drainState{draining: make(chan struct{})}
+}
+
+// Drain starts the drain phase, later calls are no-ops
+func Drain() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if !state.started {
+		state.started = true
+		close(state.draining)
+	}
+}
+
+// Draining is closed when the drain phase starts
+func Draining() <-chan struct{} {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.draining
+}
+
+func IsDraining() bool {
+	select {
+	case <-Draining():
+		return true
+	default:
+		return false
+	}
+}
+
+// Reset leaves the drain phase, for tests
+func Reset() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.draining = make(chan struct{})
+	state.started = false
+}
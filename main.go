@@ -1,29 +1,54 @@
 package main
 
 import (
+	"ActQABot/api/admin_api"
 	"ActQABot/api/github_api"
+	"ActQABot/api/gitlab_api"
 	"ActQABot/api/static"
 	"ActQABot/api/worker_api"
 	"ActQABot/conf"
 	_ "ActQABot/docs"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/shutdown"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/container_policy"
+	"ActQABot/pkg/github/gh_api"
+	_ "ActQABot/pkg/gitlab/gl_api"
 	"ActQABot/pkg/hosts"
+	"ActQABot/pkg/leader"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/redact"
+	"ActQABot/pkg/scheduler"
+	"ActQABot/pkg/secrets"
+	"ActQABot/pkg/storage"
+	"ActQABot/pkg/watchdog"
 	"ActQABot/pkg/worker_report"
 	"context"
-	"flag"
-	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"log/slog"
 	"net/http"
+	"os/signal"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
 )
 
 var serverEnv conf.ServerEnvironment
 
+// nil without SCHEDULES_CONF
+var cronScheduler *scheduler.Scheduler
+
 // @title BeepBoop bot
 // @version 1.0
 // @description API for convenient CI/CD management
 // @BasePath /api/v1
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
 
 func mount(r *mux.Router, path string, handler http.Handler) {
 	r.PathPrefix(path).Handler(
@@ -56,35 +81,102 @@ func enableCORS(router *mux.Router) {
 
 func main() {
 	var err error
-	flag.Parse()
+	conf.NewEnviron(&conf.LoggingEnv)
+	if err = logging.Init(conf.LoggingEnv); err != nil {
+		panic(err)
+	}
 	//
 	conf.NewEnviron(&conf.GeneralEnvironments)
 	conf.Hosts, err = conf.NewHostsEnvironment(conf.GeneralEnvironments.HostConf)
 	if err != nil {
 		panic(err)
 	}
+	if err = container_policy.Validate(conf.Hosts); err != nil {
+		panic(err)
+	}
+	if err = hosts.ValidateCustomFlags(conf.Hosts); err != nil {
+		panic(err)
+	}
+	if err = watchdog.Validate(conf.Hosts); err != nil {
+		panic(err)
+	}
 	hosts.HostAvbl = hosts.NewAvailability(conf.Hosts)
+	if conf.GeneralEnvironments.NotifyConf != "" {
+		conf.Notifications, err = conf.NewNotificationsEnvironment(conf.GeneralEnvironments.NotifyConf)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if conf.GeneralEnvironments.WebhooksConf != "" {
+		conf.Webhooks, err = conf.NewWebhooksEnvironment(conf.GeneralEnvironments.WebhooksConf)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if conf.GeneralEnvironments.SchedulesConf != "" {
+		conf.Schedules, err = conf.NewSchedulesEnvironment(conf.GeneralEnvironments.SchedulesConf)
+		if err != nil {
+			panic(err)
+		}
+		cronScheduler, err = scheduler.New(conf.Schedules, conf.Hosts)
+		if err != nil {
+			panic(err)
+		}
+	}
 	conf.NewEnviron(&conf.GithubEnvironment)
+	if err = gh_api.CheckEnvironment(conf.GithubEnvironment); err != nil {
+		panic(err)
+	}
+	conf.NewEnviron(&conf.GitlabEnvironment)
 	conf.NewEnviron(&serverEnv)
-	_, err = conf.NewEtcdConfFromEnv()
-	if err != nil {
+	conf.NewEnviron(&conf.LogExcerptEnv)
+	conf.NewEnviron(&conf.OutboxEnv)
+	conf.NewEnviron(&conf.AdminEnv)
+	conf.NewEnviron(&conf.TracingEnv)
+	conf.NewEnviron(&conf.HAEnv)
+	conf.NewEnviron(&conf.StorageEnv)
+	conf.NewEnviron(&conf.SecretsEnv)
+	if err = secrets.Init(conf.SecretsEnv); err != nil {
 		panic(err)
 	}
-
-	// Worker Report consumer
-	jobReportConsumerCtx, cancelReportConsumer := context.WithCancel(context.Background())
-	defer cancelReportConsumer()
-
-	jobReportEventChannel, err := worker_report.SubscribeJobReports(jobReportConsumerCtx)
+	conf.NewEnviron(&conf.RedactEnv)
+	if err = redact.Init(conf.RedactEnv); err != nil {
+		panic(err)
+	}
+	shutdownTracing, err := tracing.Init(conf.TracingEnv)
 	if err != nil {
 		panic(err)
 	}
-	go worker_report.JobReportsConsumer(jobReportConsumerCtx, jobReportEventChannel)
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+	// the election needs a store shared by the replicas
+	if conf.HAEnv.Enabled && conf.StorageEnv.Backend != storage.BackendEtcd {
+		panic("HA_ENABLED requires STORAGE_BACKEND=etcd")
+	}
+	if _, err = storage.Open(conf.StorageEnv); err != nil {
+		panic(err)
+	}
+	slog.Info("storage opened", "backend", conf.StorageEnv.Backend, "file", conf.StorageEnv.File)
+	slog.Info("secret store", "enabled", secrets.Enabled())
+
+	// Worker Report consumer and forge writes, on the leader only in HA mode
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		leader.Run(workersCtx, conf.HAEnv, runWorkers)
+	}()
 
 	// server
 	r := mux.NewRouter()
 	enableCORS(r)
 	mount(r, "/api/v1/worker", worker_api.Router())
+	mount(r, "/api/v1/admin", admin_api.Router())
+	mount(r, "/api/v1/gitlab", gitlab_api.Router())
 	mount(r, "/api/v1", github_api.Router())
 	mount(r, "/static/", static.Router(serverEnv.StaticFileRoot))
 	indexFileReturnHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -93,11 +185,82 @@ func main() {
 	r.HandleFunc("/", indexFileReturnHandler)
 	r.HandleFunc("/job/logs", indexFileReturnHandler)
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+	r.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{Addr: serverEnv.Address, Handler: r}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	slog.Info("listening", "address", serverEnv.Address, "static_path", serverEnv.StaticFileRoot)
 
-	glog.Infof("Listening on %s", serverEnv.Address)
-	glog.Infof("Static path %s", serverEnv.StaticFileRoot)
-	err = http.ListenAndServe(serverEnv.Address, r)
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	select {
+	case <-signals.Done():
+		slog.Info("shutting down", "timeout", serverEnv.ShutdownTimeout)
+	case err = <-serverErr:
+		slog.Error("error starting server", "error", err)
+	}
+	gracefulShutdown(server, stopWorkers, workersDone)
+}
+
+// runWorkers consumes worker reports, delivers forge writes, cancels overdue jobs and fires schedules until ctx is done
+func runWorkers(ctx context.Context) {
+	jobReportEventChannel, err := worker_report.SubscribeJobReports(ctx)
 	if err != nil {
-		glog.Error("Error starting server:", err)
+		slog.ErrorContext(ctx, "failed to subscribe to job reports", "error", err)
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		worker_report.JobReportsConsumer(ctx, jobReportEventChannel)
+	}()
+	go func() {
+		defer wg.Done()
+		outbox.Worker(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		watchdog.Run(ctx, conf.GeneralEnvironments.WatchdogInterval)
+	}()
+	if cronScheduler != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cronScheduler.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// gracefulShutdown drains the replica: webhooks are refused, log streams are asked to reconnect,
+// requests and reports in flight complete, then the connections are closed. All within serverEnv.ShutdownTimeout.
+func gracefulShutdown(server *http.Server, stopWorkers context.CancelFunc, workersDone ...<-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverEnv.ShutdownTimeout)
+	defer cancel()
+	shutdown.Drain()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("failed to drain http requests", "error", err)
+	}
+	stopWorkers()
+	for _, done := range workersDone {
+		select {
+		case <-done:
+			continue
+		case <-ctx.Done():
+		}
+		// unacked reports stay queued and are picked up again
+		slog.Error("shutdown deadline exceeded, abandoning work in flight")
+		break
+	}
+	if err := grpc_utils.CloseAll(); err != nil {
+		slog.Error("failed to close gRPC connections", "error", err)
+	}
+	if err := storage.Close(); err != nil {
+		slog.Error("failed to close storage", "error", err)
 	}
+	slog.Info("shutdown complete")
 }
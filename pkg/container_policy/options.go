@@ -0,0 +1,117 @@
+package container_policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shortFlags maps the docker run short flags to their long form
+var shortFlags = map[string]string{
+	"-a": "--attach",
+	"-c": "--cpu-shares",
+	"-d": "--detach",
+	"-e": "--env",
+	"-h": "--hostname",
+	"-i": "--interactive",
+	"-l": "--label",
+	"-m": "--memory",
+	"-p": "--publish",
+	"-P": "--publish-all",
+	"-t": "--tty",
+	"-u": "--user",
+	"-v": "--volume",
+	"-w": "--workdir",
+}
+
+// flagAliases are the long flags docker accepts under two names
+var flagAliases = map[string]string{
+	"--net":       "--network",
+	"--net-alias": "--network-alias",
+}
+
+// booleanFlags take no value unless given with =
+var booleanFlags = map[string]bool{
+	"--detach":           true,
+	"--init":             true,
+	"--interactive":      true,
+	"--no-healthcheck":   true,
+	"--oom-kill-disable": true,
+	"--privileged":       true,
+	"--publish-all":      true,
+	"--read-only":        true,
+	"--rm":               true,
+	"--sig-proxy":        true,
+	"--tty":              true,
+}
+
+// Option is a docker option in its long form
+type Option struct {
+	Flag  string
+	Value string
+}
+
+// longName normalizes a flag of the command or of the policy
+func longName(flag string) string {
+	if long, ok := shortFlags[flag]; ok {
+		return long
+	}
+	if long, ok := flagAliases[flag]; ok {
+		return long
+	}
+	return flag
+}
+
+// Parse splits the options the way docker run reads them: --flag=value, --flag value, -e value, -eVALUE
+// and grouped boolean short flags such as -it
+func Parse(args []string) ([]Option, error) {
+	var options []Option
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		next := func(flag string) (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s requires a value", flag)
+			}
+			i++
+			return args[i], nil
+		}
+		switch {
+		case arg == "":
+			continue
+		case strings.HasPrefix(arg, "--"):
+			flag, value, hasValue := strings.Cut(arg, "=")
+			flag = longName(flag)
+			if !hasValue && !booleanFlags[flag] {
+				var err error
+				if value, err = next(flag); err != nil {
+					return nil, err
+				}
+			}
+			options = append(options, Option{Flag: flag, Value: value})
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for rest := arg[1:]; rest != ""; {
+				short := "-" + rest[:1]
+				flag, ok := shortFlags[short]
+				if !ok {
+					return nil, fmt.Errorf("unknown docker option %s", short)
+				}
+				rest = rest[1:]
+				if booleanFlags[flag] {
+					options = append(options, Option{Flag: flag})
+					continue
+				}
+				value := strings.TrimPrefix(rest, "=")
+				if rest == "" {
+					var err error
+					if value, err = next(short); err != nil {
+						return nil, err
+					}
+				}
+				options = append(options, Option{Flag: flag, Value: value})
+				rest = ""
+			}
+		default:
+			return nil, fmt.Errorf("unexpected argument %s, docker options start with -", arg)
+		}
+	}
+	return options, nil
+}
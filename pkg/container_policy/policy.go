@@ -0,0 +1,352 @@
+package container_policy
+
+import (
+	"ActQABot/conf"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultPolicy applies to the hosts without a policy: no privileges, host mounts, host namespaces or
+// published ports, and no dynamic linker overrides
+var DefaultPolicy = conf.ContainerPolicy{
+	DeniedFlags: []string{
+		"--privileged", "--cap-add", "--security-opt", "--device", "--device-cgroup-rule", "--runtime",
+		"--network", "--pid", "--ipc", "--uts", "--userns", "--cgroupns", "--cgroup-parent", "--sysctl",
+		"--group-add", "--volume", "--mount", "--volumes-from", "--env-file", "--publish", "--publish-all",
+	},
+	DeniedEnv: []string{"LD_*"},
+}
+
+// ViolationError lists the options the policy of the host rejects
+type ViolationError struct {
+	Host     string
+	Problems []error
+}
+
+func (e *ViolationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("container options rejected by the policy of host %s:", e.Host))
+	for _, problem := range e.Problems {
+		sb.WriteString("\n- ")
+		sb.WriteString(problem.Error())
+	}
+	return sb.String()
+}
+
+// For returns the policy of the host
+func For(hostsEnv *conf.HostsEnvironment, host conf.Host) *conf.ContainerPolicy {
+	switch {
+	case host.ContainerPolicy != nil:
+		return host.ContainerPolicy
+	case hostsEnv != nil && hostsEnv.DefaultContainerPolicy != nil:
+		return hostsEnv.DefaultContainerPolicy
+	}
+	return &DefaultPolicy
+}
+
+// Check parses the docker options a user gave for the host and returns a *ViolationError
+// listing everything the policy rejects
+func Check(hostName string, policy *conf.ContainerPolicy, args []string) error {
+	options, err := Parse(args)
+	if err != nil {
+		return &ViolationError{Host: hostName, Problems: []error{err}}
+	}
+	return checkOptions(hostName, policy, options)
+}
+
+// CheckContainerOptions checks the --container-options value act receives, split into words the way act
+// splits it. The options of trusted, the words the operator wrote in custom_flags, are exempt: they come
+// first in the value, the first occurrences of their flags are skipped.
+func CheckContainerOptions(hostName string, policy *conf.ContainerPolicy, value string, trusted []string) error {
+	words, err := SplitWords(value)
+	if err != nil {
+		return &ViolationError{Host: hostName, Problems: []error{err}}
+	}
+	// splitters disagree on them, docker options have no use for them
+	for _, word := range words {
+		if strings.ContainsFunc(word, unicode.IsControl) {
+			return &ViolationError{Host: hostName, Problems: []error{fmt.Errorf("control characters in %q", word)}}
+		}
+	}
+	options, err := Parse(words)
+	if err != nil {
+		return &ViolationError{Host: hostName, Problems: []error{err}}
+	}
+	exempt := make(map[string]int)
+	// custom_flags that aren't docker options exempt nothing
+	if trustedOptions, err := Parse(trusted); err == nil {
+		for _, option := range trustedOptions {
+			exempt[option.Flag]++
+		}
+	}
+	var checked []Option
+	for _, option := range options {
+		if exempt[option.Flag] > 0 {
+			exempt[option.Flag]--
+			continue
+		}
+		checked = append(checked, option)
+	}
+	return checkOptions(hostName, policy, checked)
+}
+
+func checkOptions(hostName string, policy *conf.ContainerPolicy, options []Option) error {
+	var problems []error
+	for _, option := range options {
+		if err := checkOption(policy, option); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(problems) > 0 {
+		return &ViolationError{Host: hostName, Problems: problems}
+	}
+	return nil
+}
+
+func containsFlag(flags []string, flag string) bool {
+	return slices.ContainsFunc(flags, func(f string) bool { return longName(f) == flag })
+}
+
+func checkOption(policy *conf.ContainerPolicy, option Option) error {
+	if containsFlag(policy.DeniedFlags, option.Flag) ||
+		(len(policy.AllowedFlags) > 0 && !containsFlag(policy.AllowedFlags, option.Flag)) {
+		return fmt.Errorf("%s is not allowed", option.Flag)
+	}
+	limits := policy.Limits
+	switch option.Flag {
+	case "--env":
+		return checkEnv(policy, option.Value)
+	case "--volume":
+		return checkVolume(policy, option.Value)
+	case "--mount":
+		return checkMount(policy, option.Value)
+	case "--memory":
+		return checkSize(option, limits.Memory)
+	case "--shm-size":
+		return checkSize(option, limits.ShmSize)
+	case "--cpus":
+		if limits.Cpus > 0 {
+			cpus, err := strconv.ParseFloat(option.Value, 64)
+			if err != nil {
+				return fmt.Errorf("--cpus %s is not a number", option.Value)
+			}
+			if cpus > limits.Cpus {
+				return fmt.Errorf("--cpus %s exceeds the limit of %g", option.Value, limits.Cpus)
+			}
+		}
+	case "--gpus":
+		if limits.Gpus > 0 {
+			gpus, err := gpuCount(option.Value)
+			if err != nil {
+				return err
+			}
+			if gpus < 0 || gpus > limits.Gpus {
+				return fmt.Errorf("--gpus %s exceeds the limit of %d", option.Value, limits.Gpus)
+			}
+		}
+	case "--pids-limit":
+		if limits.Pids > 0 {
+			pids, err := strconv.ParseInt(option.Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("--pids-limit %s is not a number", option.Value)
+			}
+			if pids <= 0 || pids > limits.Pids {
+				return fmt.Errorf("--pids-limit %s exceeds the limit of %d", option.Value, limits.Pids)
+			}
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(
+		patterns, func(pattern string) bool {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		},
+	)
+}
+
+func checkEnv(policy *conf.ContainerPolicy, value string) error {
+	name, _, ok := strings.Cut(value, "=")
+	switch {
+	case name == "":
+		return fmt.Errorf("--env %s has no variable name", value)
+	case !ok:
+		// docker copies a bare NAME from the environment of the host
+		return fmt.Errorf("--env %s has no value, give %s=value", value, value)
+	case matchesAny(policy.DeniedEnv, name):
+		return fmt.Errorf("env variable %s is not allowed", name)
+	case len(policy.AllowedEnv) > 0 && !matchesAny(policy.AllowedEnv, name):
+		return fmt.Errorf("env variable %s is not allowed", name)
+	}
+	return nil
+}
+
+// within tells whether p is dir or under it
+func within(p, dir string) bool {
+	dir = path.Clean(dir)
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+func checkBindSource(policy *conf.ContainerPolicy, source string) error {
+	if !path.IsAbs(source) {
+		return fmt.Errorf("bind mount source %s must be an absolute path", source)
+	}
+	source = path.Clean(source)
+	if slices.ContainsFunc(policy.DeniedMounts, func(dir string) bool { return within(source, dir) }) ||
+		(len(policy.AllowedMounts) > 0 &&
+			!slices.ContainsFunc(policy.AllowedMounts, func(dir string) bool { return within(source, dir) })) {
+		return fmt.Errorf("mounting %s is not allowed", source)
+	}
+	return nil
+}
+
+// checkVolume checks src:dst[:opts], a source without / names a docker volume rather than a host path
+func checkVolume(policy *conf.ContainerPolicy, value string) error {
+	source, _, ok := strings.Cut(value, ":")
+	if !ok {
+		// anonymous volume
+		return nil
+	}
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+		return checkBindSource(policy, source)
+	}
+	return nil
+}
+
+// checkMount checks the source of type=bind mounts, volume and tmpfs mounts don't expose the host
+func checkMount(policy *conf.ContainerPolicy, value string) error {
+	mountType := "volume"
+	var source string
+	for _, field := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			mountType = val
+		case "source", "src":
+			source = val
+		}
+	}
+	if mountType != "bind" {
+		return nil
+	}
+	return checkBindSource(policy, source)
+}
+
+func checkSize(option Option, limit string) error {
+	if limit == "" {
+		return nil
+	}
+	size, err := ParseSize(option.Value)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", option.Flag, option.Value, err)
+	}
+	maxSize, err := ParseSize(limit)
+	if err != nil {
+		return err
+	}
+	if size > maxSize {
+		return fmt.Errorf("%s %s exceeds the limit of %s", option.Flag, option.Value, limit)
+	}
+	return nil
+}
+
+var sizePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s?([kKmMgGtT]?)[iI]?[bB]?$`)
+
+// ParseSize reads a docker size such as 512m or 64g, the units are powers of 1024
+func ParseSize(size string) (int64, error) {
+	match := sizePattern.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	multiplier := int64(1)
+	switch strings.ToLower(match[2]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	case "t":
+		multiplier = 1 << 40
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// gpuCount reads --gpus: all, a count, count=N or device=ID,ID; all is -1
+func gpuCount(value string) (int, error) {
+	value = strings.Trim(value, `"'`)
+	if value == "all" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, nil
+	}
+	if devices, ok := strings.CutPrefix(value, "device="); ok {
+		return len(strings.Split(devices, ",")), nil
+	}
+	for _, field := range strings.Split(value, ",") {
+		if count, ok := strings.CutPrefix(field, "count="); ok {
+			if count == "all" {
+				return -1, nil
+			}
+			if n, err := strconv.Atoi(count); err == nil {
+				return n, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unable to read the GPU count of --gpus %s", value)
+}
+
+// Validate checks the policies of the hosts configuration
+func Validate(hostsEnv *conf.HostsEnvironment) error {
+	if err := validatePolicy(hostsEnv.DefaultContainerPolicy); err != nil {
+		return fmt.Errorf("default_container_policy: %w", err)
+	}
+	for name, host := range hostsEnv.Hosts {
+		if err := validatePolicy(host.ContainerPolicy); err != nil {
+			return fmt.Errorf("host %s container_policy: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validatePolicy(policy *conf.ContainerPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	for _, flag := range append(append([]string{}, policy.AllowedFlags...), policy.DeniedFlags...) {
+		if !strings.HasPrefix(flag, "-") {
+			return fmt.Errorf("flag %s must start with -", flag)
+		}
+	}
+	for _, dir := range append(append([]string{}, policy.AllowedMounts...), policy.DeniedMounts...) {
+		if !path.IsAbs(dir) {
+			return fmt.Errorf("mount %s must be an absolute path", dir)
+		}
+	}
+	for _, pattern := range append(append([]string{}, policy.AllowedEnv...), policy.DeniedEnv...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("env pattern %s: %w", pattern, err)
+		}
+	}
+	for _, size := range []string{policy.Limits.Memory, policy.Limits.ShmSize} {
+		if size == "" {
+			continue
+		}
+		if _, err := ParseSize(size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package container_policy
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	UnterminatedQuoteError  = errors.New("unterminated quote in the container options")
+	UnterminatedEscapeError = errors.New("unterminated backslash escape in the container options")
+)
+
+const (
+	wordSeparators = " \n\t"
+	// the characters a backslash escapes inside double quotes
+	doubleEscapes = "$`\"\n\\"
+)
+
+// SplitWords splits the --container-options value into the words act gives to docker: act splits it with
+// github.com/kballard/go-shellquote, the same POSIX shell rules apply here. The policy must see these words,
+// not the tokens of the comment.
+func SplitWords(input string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case strings.IndexByte(wordSeparators, c) >= 0:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 >= len(input) {
+				return nil, UnterminatedEscapeError
+			}
+			i++
+			// an escaped newline continues the line
+			if input[i] != '\n' {
+				word.WriteByte(input[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(input[i+1:], '\'')
+			if end < 0 {
+				return nil, UnterminatedQuoteError
+			}
+			word.WriteString(input[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			closed := false
+			for i++; i < len(input); i++ {
+				if input[i] == '"' {
+					closed = true
+					break
+				}
+				if input[i] == '\\' && i+1 < len(input) && strings.IndexByte(doubleEscapes, input[i+1]) >= 0 {
+					i++
+					if input[i] != '\n' {
+						word.WriteByte(input[i])
+					}
+					continue
+				}
+				word.WriteByte(input[i])
+			}
+			if !closed {
+				return nil, UnterminatedQuoteError
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// QuoteWord quotes the value so that SplitWords reads it back as a single word, as is when it needs no quoting
+func QuoteWord(value string) string {
+	if value == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(value, wordSeparators+"'\"\\$`;&|<>()*?[]#~{}!") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,53 @@
+package forge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is returned when a forge answers with an unexpected status.
+// RetryAfter is set when the forge asked us to back off (Retry-After or an exhausted rate limit).
+type APIError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("unexpected status code: %d, retry after %s", e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+func NewAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(v); err == nil {
+			apiErr.RetryAfter = time.Until(at)
+		}
+	}
+	// GitHub sends X-RateLimit-*, GitLab RateLimit-*
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if apiErr.RetryAfter > 0 || resp.Header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		if reset, err := strconv.ParseInt(resp.Header.Get(prefix+"Reset"), 10, 64); err == nil {
+			apiErr.RetryAfter = time.Until(time.Unix(reset, 0))
+		}
+	}
+	if apiErr.RetryAfter < 0 {
+		apiErr.RetryAfter = 0
+	}
+	return apiErr
+}
+
+// IsNotFound tells whether the forge answered 404, e.g. for a missing file or ref
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,64 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Supported forges
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// Reply is a bot comment on an issue, pull request or merge request.
+// Owner is the namespace of the repository, IssueNumber the issue/PR number or the MR IID.
+type Reply struct {
+	Forge       string
+	Owner       string
+	Repo        string
+	IssueNumber int
+	CommentId   *int
+
+	Text string
+}
+
+// Forge is what the bot needs from a code hosting provider
+type Forge interface {
+	PostReply(ctx context.Context, reply *Reply) error
+	UpdateReply(ctx context.Context, reply *Reply) error
+	// ResolveRef turns a branch, tag or short SHA into a full commit SHA
+	ResolveRef(ctx context.Context, owner, repo, ref string) (string, error)
+	// CloneURL is the URL ActService clones "owner/repo" from
+	CloneURL(fullName string) string
+	// GetFile returns the content of the file at ref, the default branch when ref is empty
+	GetFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error)
+	// ListFiles returns the paths of the files directly inside dir at ref
+	ListFiles(ctx context.Context, owner, repo, ref, dir string) ([]string, error)
+}
+
+var registry = struct {
+	sync.RWMutex
+	forges map[string]Forge
+}{forges: make(map[string]Forge)}
+
+func Register(name string, f Forge) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.forges[name] = f
+}
+
+// Get returns the named forge; the empty name is GitHub, which predates the other forges
+func Get(name string) (Forge, error) {
+	if name == "" {
+		name = GitHub
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	f, ok := registry.forges[name]
+	if !ok {
+		return nil, fmt.Errorf("forge %s is not registered", name)
+	}
+	return f, nil
+}
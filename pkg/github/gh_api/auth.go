@@ -3,57 +3,173 @@ package gh_api
 import (
 	"ActQABot/conf"
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-github/v60/github"
-	"golang.org/x/oauth2"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
 var Authorize = authForRepo
 var GenerateJWTToken = generateJWT
-var GHClientConstructor = func(client *http.Client) *github.Client {
-	return github.NewClient(client)
+
+// installation tokens are reused until this long before they expire
+const tokenRefreshMargin = 5 * time.Minute
+
+type authCache struct {
+	mu sync.Mutex
+
+	// where the signer came from, a file signer is reloaded when its mtime changes
+	signerSource  string
+	signerModTime time.Time
+	signer        JWTSigner
+
+	installIds map[string]cachedInstallId
+	tokens     map[int64]*github.InstallationToken
 }
 
-var installIdMemoized map[string]int64
+type cachedInstallId struct {
+	id       int64
+	cachedAt time.Time
+}
 
-func loadPrivateKey(pemFile string) (*rsa.PrivateKey, error) {
-	bytes, err := os.ReadFile(pemFile)
-	if err != nil {
-		return nil, err
+var auth = newAuthCache()
+
+func newAuthCache() *authCache {
+	return &authCache{
+		installIds: make(map[string]cachedInstallId),
+		tokens:     make(map[int64]*github.InstallationToken),
 	}
-	block, _ := pem.Decode(bytes)
-	if block == nil {
-		return nil, fmt.Errorf("no valid PEM data found")
+}
+
+// ResetAuthCache drops cached keys, installation IDs and tokens
+func ResetAuthCache() {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.signerSource, auth.signerModTime, auth.signer = "", time.Time{}, nil
+	auth.installIds = make(map[string]cachedInstallId)
+	auth.tokens = make(map[int64]*github.InstallationToken)
+}
+
+func (c *authCache) cachedSigner(source string, modTime time.Time) (JWTSigner, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.signer == nil || c.signerSource != source || !c.signerModTime.Equal(modTime) {
+		return nil, false
 	}
-	return x509.ParsePKCS1PrivateKey(block.Bytes)
+	return c.signer, true
 }
 
-func generateJWT(privateKey *rsa.PrivateKey, appID string) (string, error) {
+func (c *authCache) setSigner(source string, modTime time.Time, signer JWTSigner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signerSource, c.signerModTime, c.signer = source, modTime, signer
+}
+
+// jwtSigner picks the App JWT signer: external command, inline key, key file.
+// The key is loaded once; a key file is reloaded when it changes.
+func (c *authCache) jwtSigner(ghEnv conf.GithubAPIEnvironment) (JWTSigner, error) {
+	var source string
+	var modTime time.Time
+	switch {
+	case ghEnv.SignerCommand != "":
+		command, err := ParseSignerCommand(ghEnv.SignerCommand)
+		if err != nil {
+			return nil, err
+		}
+		return CommandSigner{Command: command, Timeout: ghEnv.SignerTimeout}, nil
+	case ghEnv.PrivateKey != "":
+		source = "env"
+	case ghEnv.PrivateKeyPath != "":
+		st, err := os.Stat(ghEnv.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		source, modTime = "file:"+ghEnv.PrivateKeyPath, st.ModTime()
+	default:
+		return nil, errors.New("no GitHub App private key or signer configured")
+	}
+	if signer, ok := c.cachedSigner(source, modTime); ok {
+		return signer, nil
+	}
+	var signer JWTSigner
+	switch {
+	case ghEnv.PrivateKey != "":
+		pk, err := ParsePrivateKey([]byte(ghEnv.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_PRIVATE_KEY: %w", err)
+		}
+		signer = KeySigner{Key: pk}
+	default:
+		pk, err := loadPrivateKey(ghEnv.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		signer = KeySigner{Key: pk}
+	}
+	slog.Debug("loaded GitHub App signer", "source", source)
+	c.setSigner(source, modTime, signer)
+	return signer, nil
+}
+
+// installId returns the installation of the repository, unless it was looked up more than ttl ago
+func (c *authCache) installId(repoKey string, ttl time.Duration) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.installIds[repoKey]
+	if !ok || (ttl > 0 && time.Since(cached.cachedAt) > ttl) {
+		return 0, false
+	}
+	return cached.id, true
+}
+
+func (c *authCache) setInstallId(repoKey string, installID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.installIds[repoKey] = cachedInstallId{id: installID, cachedAt: time.Now()}
+}
+
+// forgetInstallation drops an installation that GitHub no longer knows or no longer lets the app use
+func (c *authCache) forgetInstallation(repoKey string, installID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, installID)
+	for k, cached := range c.installIds {
+		if cached.id == installID || k == repoKey {
+			delete(c.installIds, k)
+		}
+	}
+}
+
+func (c *authCache) token(installID int64) (*github.InstallationToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tok, ok := c.tokens[installID]
+	if !ok || tok.ExpiresAt == nil || time.Until(tok.ExpiresAt.Time) < tokenRefreshMargin {
+		return nil, false
+	}
+	return tok, true
+}
+
+func (c *authCache) setToken(installID int64, tok *github.InstallationToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[installID] = tok
+}
+
+func generateJWT(signer JWTSigner, appID string) (string, error) {
 	now := time.Now()
 	claims := jwt.RegisteredClaims{
 		Issuer:    appID,
 		IssuedAt:  jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(10 * time.Minute)),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(privateKey)
-}
-
-func makeClient(jwtToken string) *github.Client {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{TokenType: "Bearer", AccessToken: jwtToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := GHClientConstructor(tc)
-	return client
+	token := jwt.NewWithClaims(signingMethodRS256{}, claims)
+	return token.SignedString(signer)
 }
 
 func getInstallIDFromRepo(client *github.Client, owner, repo string) (int64, error) {
@@ -71,22 +187,63 @@ func getInstallationToken(client *github.Client, installID int64) (*github.Insta
 	return token, err
 }
 
+// installationRejected tells the answers of access_tokens for an installation that was removed (404),
+// suspended or whose permissions changed (401, 403)
+func installationRejected(err error) bool {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil {
+		return false
+	}
+	switch ghErr.Response.StatusCode {
+	case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
 func authForRepo(ghEnv conf.GithubAPIEnvironment, owner, repo string) (*github.InstallationToken, error) {
-	pk, err := loadPrivateKey(ghEnv.PrivateKeyPath)
+	repoKey := owner + "/" + repo
+	installID, known := auth.installId(repoKey, ghEnv.InstallationIdTTL)
+	if known {
+		if tok, ok := auth.token(installID); ok {
+			return tok, nil
+		}
+	}
+	signer, err := auth.jwtSigner(ghEnv)
 	if err != nil {
 		return nil, err
 	}
-	tok, err := GenerateJWTToken(pk, ghEnv.AppID)
+	jwtToken, err := GenerateJWTToken(signer, ghEnv.AppID)
 	if err != nil {
 		return nil, err
 	}
-	client := makeClient(tok)
-	installID, ok := installIdMemoized[owner+"/"+repo]
-	if !ok {
-		installID, err = getInstallIDFromRepo(client, owner, repo)
+	client, err := NewClient(ghEnv, jwtToken)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if !known {
+			installID, err = getInstallIDFromRepo(client, owner, repo)
+			if err != nil {
+				return nil, err
+			}
+			auth.setInstallId(repoKey, installID)
+		}
+		tok, err := getInstallationToken(client, installID)
 		if err != nil {
+			// the app was reinstalled or suspended, or the repository moved: look the installation up once more
+			if known && installationRejected(err) {
+				slog.Info(
+					"installation rejected, looking it up again", "installation", installID, "repo", repoKey,
+					"error", err,
+				)
+				auth.forgetInstallation(repoKey, installID)
+				known = false
+				continue
+			}
 			return nil, err
 		}
+		auth.setToken(installID, tok)
+		return tok, nil
 	}
-	return getInstallationToken(client, installID)
 }
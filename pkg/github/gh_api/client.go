@@ -0,0 +1,148 @@
+package gh_api
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/forge"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v60/github"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const publicAPIURL = "https://api.github.com/"
+
+// GHClientConstructor turns an authenticated http client into the REST client, every GitHub call goes through it
+var GHClientConstructor = func(ghEnv conf.GithubAPIEnvironment, client *http.Client) (*github.Client, error) {
+	cl, err := withBaseURL(github.NewClient(client), ghEnv)
+	if err != nil {
+		return nil, fmt.Errorf("GITHUB_API_URL: %w", err)
+	}
+	return cl, nil
+}
+
+func withBaseURL(client *github.Client, ghEnv conf.GithubAPIEnvironment) (*github.Client, error) {
+	if ghEnv.BaseURL == "" || strings.TrimSuffix(ghEnv.BaseURL, "/") == strings.TrimSuffix(publicAPIURL, "/") {
+		return client, nil
+	}
+	uploadURL := ghEnv.UploadURL
+	if uploadURL == "" {
+		uploadURL = ghEnv.BaseURL
+	}
+	return client.WithEnterpriseURLs(ghEnv.BaseURL, uploadURL)
+}
+
+var transports = struct {
+	sync.Mutex
+	byConf map[string]http.RoundTripper
+}{byConf: make(map[string]http.RoundTripper)}
+
+// transport is shared per proxy/CA configuration so connections are reused
+func transport(ghEnv conf.GithubAPIEnvironment) (http.RoundTripper, error) {
+	key := ghEnv.ProxyURL + "|" + ghEnv.CACertPath
+	transports.Lock()
+	defer transports.Unlock()
+	if rt, ok := transports.byConf[key]; ok {
+		return rt, nil
+	}
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	if ghEnv.ProxyURL != "" {
+		proxyURL, err := url.Parse(ghEnv.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_PROXY_URL: %w", err)
+		}
+		rt.Proxy = http.ProxyURL(proxyURL)
+	}
+	if ghEnv.CACertPath != "" {
+		caCert, err := os.ReadFile(ghEnv.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append CA cert from %s", ghEnv.CACertPath)
+		}
+		rt.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+	transports.byConf[key] = metrics.GithubTransport{Base: rt}
+	return transports.byConf[key], nil
+}
+
+// NewClient returns a REST client authenticated with a bearer token (App JWT or installation token)
+func NewClient(ghEnv conf.GithubAPIEnvironment, token string) (*github.Client, error) {
+	base, err := transport(ghEnv)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Timeout: ghEnv.Timeout,
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{TokenType: "Bearer", AccessToken: token}),
+			Base:   base,
+		},
+	}
+	return GHClientConstructor(ghEnv, httpClient)
+}
+
+// CheckEnvironment validates the client configuration at startup
+func CheckEnvironment(ghEnv conf.GithubAPIEnvironment) error {
+	if _, err := transport(ghEnv); err != nil {
+		return err
+	}
+	_, err := withBaseURL(github.NewClient(nil), ghEnv)
+	return err
+}
+
+// CloneURL is the URL ActService clones "owner/repo" from
+func CloneURL(ghEnv conf.GithubAPIEnvironment, fullName string) string {
+	format := ghEnv.CloneURLFormat
+	if format == "" {
+		format = "git@github.com:%s.git"
+	}
+	return fmt.Sprintf(format, fullName)
+}
+
+func requestContext(ghEnv conf.GithubAPIEnvironment) (context.Context, context.CancelFunc) {
+	if ghEnv.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), ghEnv.Timeout)
+}
+
+// apiError converts go-github failures into forge.APIError so callers can honour rate limits
+func apiError(resp *github.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return &forge.APIError{
+			StatusCode: http.StatusForbidden,
+			RetryAfter: max(time.Until(rateLimitErr.Rate.Reset.Time), 0),
+		}
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		apiErr := forge.NewAPIError(abuseErr.Response)
+		if abuseErr.RetryAfter != nil {
+			apiErr.RetryAfter = *abuseErr.RetryAfter
+		}
+		return apiErr
+	}
+	if resp != nil && resp.Response != nil && resp.StatusCode >= 300 {
+		return forge.NewAPIError(resp.Response)
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package gh_api
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"context"
+	"fmt"
+	"github.com/google/go-github/v60/github"
+	"strings"
+)
+
+var ResolveRefFunc = resolveRef
+var GetFileFunc = getFile
+var ListFilesFunc = listFiles
+
+func init() {
+	forge.Register(forge.GitHub, githubForge{})
+}
+
+// githubForge serves forge.Forge with the App installation of the repository owner
+type githubForge struct{}
+
+func (githubForge) PostReply(_ context.Context, reply *forge.Reply) error {
+	tok, err := Authorize(conf.GithubEnvironment, reply.Owner, reply.Repo)
+	if err != nil {
+		return err
+	}
+	return PostIssueCommentFunc(reply, *tok.Token)
+}
+
+func (githubForge) UpdateReply(_ context.Context, reply *forge.Reply) error {
+	tok, err := Authorize(conf.GithubEnvironment, reply.Owner, reply.Repo)
+	if err != nil {
+		return err
+	}
+	return UpdateIssueComment(*reply, *tok.Token)
+}
+
+func (githubForge) ResolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	return ResolveRefFunc(ctx, owner, repo, ref)
+}
+
+func (githubForge) CloneURL(fullName string) string {
+	return CloneURL(conf.GithubEnvironment, fullName)
+}
+
+func (githubForge) GetFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	return GetFileFunc(ctx, owner, repo, ref, path)
+}
+
+func (githubForge) ListFiles(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+	return ListFilesFunc(ctx, owner, repo, ref, dir)
+}
+
+func resolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	tok, err := Authorize(conf.GithubEnvironment, owner, repo)
+	if err != nil {
+		return "", err
+	}
+	client, err := NewClient(conf.GithubEnvironment, *tok.Token)
+	if err != nil {
+		return "", err
+	}
+	if conf.GithubEnvironment.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.GithubEnvironment.Timeout)
+		defer cancel()
+	}
+	sha, resp, err := client.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
+	return sha, apiError(resp, err)
+}
+
+// contents calls the contents API, path is either a file or a directory
+func contents(
+	ctx context.Context, owner, repo, ref, path string,
+) (*github.RepositoryContent, []*github.RepositoryContent, error) {
+	tok, err := Authorize(conf.GithubEnvironment, owner, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := NewClient(conf.GithubEnvironment, *tok.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conf.GithubEnvironment.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.GithubEnvironment.Timeout)
+		defer cancel()
+	}
+	file, dir, resp, err := client.Repositories.GetContents(
+		ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref},
+	)
+	return file, dir, apiError(resp, err)
+}
+
+func getFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	file, _, err := contents(ctx, owner, repo, ref, path)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	content, err := file.GetContent()
+	return []byte(content), err
+}
+
+func listFiles(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+	_, entries, err := contents(ctx, owner, repo, ref, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.GetType() == "file" {
+			paths = append(paths, entry.GetPath())
+		}
+	}
+	return paths, nil
+}
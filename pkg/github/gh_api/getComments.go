@@ -1,46 +1,37 @@
 package gh_api
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"ActQABot/conf"
+	"github.com/google/go-github/v60/github"
 )
 
 func getBotComments(token, owner, repo string, issueNumber int, botLogin string) ([]Comment, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/comments", owner, repo, issueNumber)
-
-	req, err := http.NewRequest("GET", url, nil)
+	client, err := NewClient(conf.GithubEnvironment, token)
 	if err != nil {
 		return nil, err
 	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
-	}
-
-	var allComments []Comment
-	if err := json.NewDecoder(resp.Body).Decode(&allComments); err != nil {
-		return nil, err
-	}
+	ctx, cancel := requestContext(conf.GithubEnvironment)
+	defer cancel()
 
 	var botComments []Comment
-	for _, c := range allComments {
-		if c.User.Login == botLogin {
-			botComments = append(botComments, c)
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := client.Issues.ListComments(ctx, owner, repo, issueNumber, opts)
+		if err != nil {
+			return nil, apiError(resp, err)
+		}
+		for _, c := range page {
+			if c.GetUser().GetLogin() != botLogin {
+				continue
+			}
+			comment := Comment{ID: c.GetID(), Body: c.GetBody()}
+			comment.User.Login = c.GetUser().GetLogin()
+			botComments = append(botComments, comment)
+		}
+		if resp.NextPage == 0 {
+			break
 		}
+		opts.Page = resp.NextPage
 	}
 
 	return botComments, nil
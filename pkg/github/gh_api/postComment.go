@@ -1,56 +1,35 @@
 package gh_api
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"github.com/golang/glog"
-	"io"
-	"net/http"
+	"ActQABot/conf"
+	"github.com/google/go-github/v60/github"
+	"log/slog"
 )
 
 var PostIssueCommentFunc = postIssueComment
 
 func postIssueComment(botComment *BotResponse, token string) error {
-	url := fmt.Sprintf(
-		"https://api.github.com/repos/%s/%s/issues/%d/comments",
-		botComment.Owner,
-		botComment.Repo,
-		botComment.IssueNumber,
-	)
-
-	payload := map[string]string{
-		"body": botComment.Text,
-	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		glog.Errorf("Error marshalling payload: %v", err)
-		return err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	client, err := NewClient(conf.GithubEnvironment, token)
 	if err != nil {
-		glog.Errorf("Error creating request: %v", err)
+		slog.Error("failed to create GitHub client", "error", err)
 		return err
 	}
+	ctx, cancel := requestContext(conf.GithubEnvironment)
+	defer cancel()
 
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	_, resp, err := client.Issues.CreateComment(
+		ctx,
+		botComment.Owner,
+		botComment.Repo,
+		botComment.IssueNumber,
+		&github.IssueComment{Body: &botComment.Text},
+	)
 	if err != nil {
-		glog.Errorf("post issue comment failed with error: %v", err)
-		return err
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
-
-	if resp.StatusCode != 201 {
-		glog.Errorf("Post comment failed with status code %d", resp.StatusCode)
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		slog.Error(
+			"post issue comment failed",
+			"repo", botComment.Owner+"/"+botComment.Repo, "issue", botComment.IssueNumber, "error", err,
+		)
+		return apiError(resp, err)
 	}
 	return nil
 }
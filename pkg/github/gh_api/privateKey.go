@@ -0,0 +1,64 @@
+package gh_api
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var pemHeader = []byte("-----BEGIN")
+
+// parsePrivateKeyDER accepts PKCS#1 and PKCS#8 encoded RSA keys
+func parsePrivateKeyDER(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("key is neither PKCS#1 nor PKCS#8: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub Apps require an RSA key, got %T", parsed)
+	}
+	return key, nil
+}
+
+// ParsePrivateKey decodes an RSA key given as PEM, base64 encoded PEM or base64 encoded DER
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.Contains(data, pemHeader) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil {
+			return nil, errors.New("no valid PEM data found")
+		}
+		if !bytes.Contains(decoded, pemHeader) {
+			return parsePrivateKeyDER(decoded)
+		}
+		data = decoded
+	}
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("no valid PEM data found")
+		}
+		if block.Type == "RSA PRIVATE KEY" || block.Type == "PRIVATE KEY" {
+			return parsePrivateKeyDER(block.Bytes)
+		}
+	}
+}
+
+func loadPrivateKey(pemFile string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(pemFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
@@ -0,0 +1,103 @@
+package gh_api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// JWTSigner produces RS256 (RSASSA-PKCS1-v1_5 with SHA-256) signatures for the App JWT,
+// so the private key doesn't have to live inside the bot. Keys held by a KMS or an HSM are reached
+// through GITHUB_JWT_SIGNER_COMMAND, e.g. a script around the vendor CLI or pkcs11-tool.
+type JWTSigner interface {
+	SignRS256(signingInput []byte) ([]byte, error)
+}
+
+// signingMethodRS256 is RS256 delegated to a JWTSigner
+type signingMethodRS256 struct{}
+
+func (signingMethodRS256) Alg() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func (signingMethodRS256) Sign(signingString string, key interface{}) ([]byte, error) {
+	signer, ok := key.(JWTSigner)
+	if !ok {
+		return nil, jwt.ErrInvalidKeyType
+	}
+	return signer.SignRS256([]byte(signingString))
+}
+
+func (signingMethodRS256) Verify(string, []byte, interface{}) error {
+	return errors.New("verification is not supported by external signers")
+}
+
+// KeySigner signs in-process with a loaded private key
+type KeySigner struct {
+	Key *rsa.PrivateKey
+}
+
+func (s KeySigner) SignRS256(signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	return rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+}
+
+// ParseSignerCommand reads GITHUB_JWT_SIGNER_COMMAND: a JSON array of the program and its arguments,
+// e.g. ["/opt/kms tools/sign", "--key", "app key"], or words separated by spaces when none contains one
+func ParseSignerCommand(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return strings.Fields(value), nil
+	}
+	var command []string
+	if err := json.Unmarshal([]byte(value), &command); err != nil {
+		return nil, fmt.Errorf("GITHUB_JWT_SIGNER_COMMAND: %w", err)
+	}
+	if len(command) == 0 || command[0] == "" {
+		return nil, errors.New("GITHUB_JWT_SIGNER_COMMAND: the program is missing")
+	}
+	return command, nil
+}
+
+// CommandSigner pipes the signing input into an external process,
+// which must print the base64 encoded signature to stdout.
+type CommandSigner struct {
+	Command []string
+	Timeout time.Duration
+}
+
+func (s CommandSigner) SignRS256(signingInput []byte) ([]byte, error) {
+	if len(s.Command) == 0 {
+		return nil, errors.New("signer command is empty")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(signingInput)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("signer command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	out := strings.TrimSpace(stdout.String())
+	if sig, err := base64.StdEncoding.DecodeString(out); err == nil {
+		return sig, nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(out, "="))
+	if err != nil {
+		return nil, fmt.Errorf("signer command returned no base64 signature: %w", err)
+	}
+	return sig, nil
+}
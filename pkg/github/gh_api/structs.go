@@ -1,13 +1,9 @@
 package gh_api
 
-type BotResponse struct {
-	Owner       string
-	Repo        string
-	IssueNumber int
-	CommentId   *int
+import "ActQABot/pkg/forge"
 
-	Text string
-}
+// BotResponse is the GitHub flavour of forge.Reply
+type BotResponse = forge.Reply
 
 type Comment struct {
 	ID   int64  `json:"id"`
@@ -2,9 +2,12 @@ package issues
 
 import (
 	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"ActQABot/internal/tracing"
 	"ActQABot/pkg/github/gh_api"
 	"ActQABot/pkg/worker_report"
 	"ActQABot/templates"
+	"context"
 	"errors"
 	"fmt"
 	"slices"
@@ -17,11 +20,15 @@ var CommentDataEmptyError = fmt.Errorf("comment data is empty")
 const (
 	HelpCommand string = "/help"
 	StartJob    string = "/wf_start"
+	RerunJob    string = "/wf_rerun"
+	ListFlows   string = "/wf_list"
 )
 
 var SupportedCommands = []string{
 	HelpCommand,
 	StartJob,
+	RerunJob,
+	ListFlows,
 }
 
 type IssuePRCommand struct {
@@ -63,20 +70,33 @@ func (cmd *IssuePRCommand) CommandName() string {
 	return cmd.command
 }
 
-func (cmd *IssuePRCommand) Exec(commandMeta *worker_report.GithubIssueMeta) (*gh_api.BotResponse, error) {
+func (cmd *IssuePRCommand) Exec(ctx context.Context, commandMeta *worker_report.GithubIssueMeta) (*gh_api.BotResponse, error) {
 	var err error = nil
 	var botResponse *gh_api.BotResponse
+	ctx, span := tracing.Start(ctx, "command "+cmd.command)
+	defer func() {
+		tracing.End(span, err)
+	}()
 
 	switch cmd.command {
 	case HelpCommand:
-		botResponse, err = cmd.helpIssueCommentCommandExec()
+		botResponse, err = cmd.helpIssueCommentCommandExec(ctx)
 		break
 	case StartJob:
-		botResponse, err = cmd.startJobIssueCommentCommandExec(commandMeta)
+		botResponse, err = cmd.startJobIssueCommentCommandExec(ctx, commandMeta)
+		break
+	case RerunJob:
+		botResponse, err = cmd.rerunJobIssueCommentCommandExec(ctx, commandMeta)
+		break
+	case ListFlows:
+		botResponse, err = cmd.listWorkflowsIssueCommentCommandExec(ctx)
 		break
 	default:
-		return nil, errors.New("invalid command")
+		metrics.Commands.WithLabelValues("unknown", metrics.OutcomeError).Inc()
+		err = errors.New("invalid command")
+		return nil, err
 	}
+	metrics.Commands.WithLabelValues(cmd.command, metrics.Outcome(err)).Inc()
 	if err != nil {
 		return nil, err
 	}
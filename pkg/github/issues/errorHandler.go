@@ -3,13 +3,14 @@ package issues
 import (
 	"ActQABot/pkg/github/gh_api"
 	"ActQABot/templates"
-	"github.com/golang/glog"
+	"log/slog"
 )
 
 func ErrorToBotResponse(err error, incomingIssue *IssueComment) *gh_api.BotResponse {
 	if err != nil {
 		errCtx := templates.NewErrorResultContext(err.Error())
 		resp := &gh_api.BotResponse{
+			Forge:       incomingIssue.Forge,
 			Text:        "",
 			Owner:       incomingIssue.Repository.Owner.Login,
 			Repo:        incomingIssue.Repository.Name,
@@ -17,7 +18,7 @@ func ErrorToBotResponse(err error, incomingIssue *IssueComment) *gh_api.BotRespo
 		}
 		errText, err2 := errCtx.GenText()
 		if err2 != nil {
-			glog.Errorf("Error generating error response: %v", err2)
+			slog.Error("failed to generate error response", "error", err2)
 			resp.Text = "Error generating error response: " + err2.Error() + ".\n"
 		} else {
 			resp.Text = errText + "\n"
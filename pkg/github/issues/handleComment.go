@@ -0,0 +1,90 @@
+package issues
+
+import (
+	"ActQABot/internal/logging"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/worker_report"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// HandleComment runs the command of a freshly created comment, whatever forge it came from,
+// and queues the reply unless postBack is off.
+func HandleComment(ctx context.Context, issueComment *IssueComment, postBack bool) (err error) {
+	ctx = logging.With(
+		ctx,
+		logging.KeyRepo, issueComment.Repository.FullName,
+		logging.KeyIssue, issueComment.Issue.Number,
+		logging.KeySender, issueComment.Comment.User.Login,
+	)
+	ctx, span := tracing.Start(
+		ctx, "issues.HandleComment", trace.WithAttributes(
+			attribute.String("forge", issueComment.Forge),
+			attribute.String("repository", issueComment.Repository.FullName),
+			attribute.Int("issue", issueComment.Issue.Number),
+			attribute.String("sender", issueComment.Comment.User.Login),
+		),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+	var resp *gh_api.BotResponse
+	githubIssueMeta := worker_report.GithubIssueMeta{
+		Forge:      issueComment.Forge,
+		IssueId:    issueComment.Issue.Number,
+		Body:       issueComment.Comment.Body,
+		Sender:     issueComment.Comment.User.Login,
+		Repository: issueComment.Repository.Name,
+		Owner:      issueComment.Repository.Owner.Login,
+	}
+	if issueComment.Action == "created" {
+		issueCommand, err := NewIssuePRCommand(*issueComment, []string{})
+		if err != nil && !errors.Is(err, NotMyCommentError) && !errors.Is(err, CommentDataEmptyError) {
+			slog.ErrorContext(ctx, "NewIssuePRCommand failed", "error", err)
+			resp = ErrorToBotResponse(err, issueComment)
+		} else if err == nil {
+			ctx = logging.With(ctx, logging.KeyCommand, issueCommand.CommandName())
+			resp, err = issueCommand.Exec(ctx, &githubIssueMeta)
+			if githubIssueMeta.JobId != nil {
+				ctx = logging.With(ctx, logging.KeyHost, githubIssueMeta.Host, logging.KeyJob, *githubIssueMeta.JobId)
+			} else if githubIssueMeta.Group != nil {
+				ctx = logging.With(ctx, logging.KeyGroup, githubIssueMeta.Group.Id)
+			}
+			if githubIssueMeta.JobId != nil || githubIssueMeta.Group != nil {
+				// worker reports link back to this trace through the job meta
+				githubIssueMeta.Trace = tracing.Inject(ctx)
+				err = githubIssueMeta.StoreJobs(ctx, 5)
+				if err != nil {
+					slog.ErrorContext(ctx, "githubIssueMeta.Store failed", "error", err)
+				}
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "issueCommand.Exec failed", "error", err)
+				resp = ErrorToBotResponse(err, issueComment)
+			}
+		}
+	}
+	if resp != nil {
+		if postBack {
+			if githubIssueMeta.JobId != nil || githubIssueMeta.Group != nil {
+				githubIssueMeta.AnswerCommentBody = new(string)
+				*githubIssueMeta.AnswerCommentBody = resp.Text
+				if err := githubIssueMeta.StoreJobs(ctx, 5); err != nil {
+					slog.ErrorContext(ctx, "githubIssueMeta.Store failed", "error", err)
+				}
+			}
+			if err := outbox.Enqueue(ctx, outbox.NewCommentItem(resp)); err != nil {
+				slog.ErrorContext(ctx, "outbox.Enqueue failed", "error", err)
+				return err
+			}
+		} else {
+			slog.InfoContext(ctx, "reply not posted back", "text", resp.Text)
+		}
+	}
+	return err
+}
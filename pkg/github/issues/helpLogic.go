@@ -1,22 +1,81 @@
 package issues
 
 import (
+	"ActQABot/pkg/forge"
 	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/workflow"
 	"ActQABot/templates"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 )
 
-func (cmd *IssuePRCommand) helpIssueCommentCommandExec() (*gh_api.BotResponse, error) {
+func (cmd *IssuePRCommand) helpIssueCommentCommandExec(ctx context.Context) (*gh_api.BotResponse, error) {
 	helpCmd := templates.NewHelpCmdContext(
 		cmd.history,
 		HelpCommand,
 		SupportedCommands,
-		templates.StartJobHelpContext{StartCommand: StartJob},
+		templates.StartJobHelpContext{StartCommand: StartJob, RerunCommand: RerunJob, ListCommand: ListFlows},
 	)
+	args := slices.DeleteFunc(slices.Clone(cmd.args), func(arg string) bool { return arg == "" })
+	if len(args) > 0 {
+		workflowHelp, err := cmd.workflowHelp(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		helpCmd.Workflow = workflowHelp
+	}
 	txt, err := helpCmd.GenText()
 	return &gh_api.BotResponse{
+		Forge:       cmd.correspondingIssue.Forge,
 		Owner:       cmd.correspondingIssue.Repository.Owner.Login,
 		Repo:        cmd.correspondingIssue.Repository.Name,
 		IssueNumber: cmd.correspondingIssue.Issue.Number,
 		Text:        txt,
 	}, err
 }
+
+// workflowHelp describes the inputs of the workflow at args[0], at the ref args[1] or the default branch
+func (cmd *IssuePRCommand) workflowHelp(ctx context.Context, args []string) (*templates.WorkflowHelpContext, error) {
+	if len(args) > 2 || !workflow.IsWorkflowFile(args[0]) {
+		return nil, errors.New("usage: /help [WORKFLOW_PATH [REF]]")
+	}
+	help := &templates.WorkflowHelpContext{Path: args[0], Ref: "default branch"}
+	var ref string
+	if len(args) == 2 {
+		ref, help.Ref = args[1], args[1]
+	}
+	repoForge, err := forge.Get(cmd.correspondingIssue.Forge)
+	if err != nil {
+		return nil, err
+	}
+	workflows, problems, err := workflow.Load(
+		ctx, repoForge, cmd.correspondingIssue.Repository.Owner.Login, cmd.correspondingIssue.Repository.Name,
+		ref, help.Path,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", help.Path, err)
+	} else if len(problems) > 0 {
+		return nil, problems[0]
+	}
+	wf := workflows[0]
+	help.Dispatch = wf.Dispatch
+	for _, input := range wf.Inputs {
+		inputType := input.Type
+		if input.Type == workflow.InputChoice {
+			inputType += ": " + strings.Join(input.Options, ", ")
+		}
+		help.Inputs = append(
+			help.Inputs, templates.WorkflowInputRow{
+				Name:        input.Name,
+				Type:        templates.TableCell(inputType),
+				Required:    input.Required,
+				Default:     templates.TableCell(input.Default),
+				Description: templates.TableCell(input.Description),
+			},
+		)
+	}
+	return help, nil
+}
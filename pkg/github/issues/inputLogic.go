@@ -0,0 +1,39 @@
+package issues
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const inputFlag = "--input"
+
+var inputName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// extractInputs takes the --input name=value pairs out of the command arguments
+func extractInputs(args []string) ([]string, map[string]string, error) {
+	rest := make([]string, 0, len(args))
+	var inputs map[string]string
+	for i := 0; i < len(args); i++ {
+		if args[i] != inputFlag {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, nil, fmt.Errorf("%s needs name=value", inputFlag)
+		}
+		i++
+		name, value, ok := strings.Cut(args[i], "=")
+		if !ok || !inputName.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid input %q, use name=value", args[i])
+		}
+		if _, ok = inputs[name]; ok {
+			return nil, nil, fmt.Errorf("input %s is given twice", name)
+		}
+		if inputs == nil {
+			inputs = make(map[string]string)
+		}
+		inputs[name] = value
+	}
+	return rest, inputs, nil
+}
@@ -0,0 +1,61 @@
+package issues
+
+import (
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/workflow"
+	"ActQABot/templates"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func (cmd *IssuePRCommand) listWorkflowsIssueCommentCommandExec(ctx context.Context) (*gh_api.BotResponse, error) {
+	args := slices.DeleteFunc(slices.Clone(cmd.args), func(arg string) bool { return arg == "" })
+	if len(args) > 1 {
+		return nil, errors.New("usage: /wf_list [REF]")
+	}
+	var ref string
+	if len(args) == 1 {
+		ref = args[0]
+	}
+	repoForge, err := forge.Get(cmd.correspondingIssue.Forge)
+	if err != nil {
+		return nil, err
+	}
+	workflows, problems, err := workflow.Load(
+		ctx, repoForge, cmd.correspondingIssue.Repository.Owner.Login, cmd.correspondingIssue.Repository.Name,
+		ref, workflow.Dir,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list workflows: %w", err)
+	}
+	rows := make([]templates.WorkflowRow, 0, len(workflows))
+	for _, wf := range workflows {
+		jobs := make([]string, 0, len(wf.Jobs))
+		for _, job := range wf.Jobs {
+			jobs = append(jobs, job.Id)
+		}
+		rows = append(
+			rows, templates.WorkflowRow{
+				Path: wf.Path,
+				Name: templates.TableCell(wf.Name),
+				Jobs: templates.TableCell(strings.Join(jobs, ", ")),
+			},
+		)
+	}
+	problemTexts := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		problemTexts = append(problemTexts, problem.Error())
+	}
+	if ref == "" {
+		ref = "default branch"
+	}
+	txt, err := templates.NewWorkflowListContext(cmd.history, ref, rows, problemTexts).GenText()
+	if err != nil {
+		return nil, err
+	}
+	return cmd.botResponse(txt), nil
+}
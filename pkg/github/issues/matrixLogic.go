@@ -0,0 +1,179 @@
+package issues
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/logging"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/templates"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	matrixFlag = "--matrix"
+	// the host axis replaces the HOST argument, every other axis is passed as -e AXIS=value
+	matrixHostAxis = "host"
+)
+
+var matrixEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type matrixAxis struct {
+	name   string
+	values []string
+}
+
+type matrixCombination struct {
+	host string
+	// AXIS=value, in axis order
+	axes []string
+	env  []string
+}
+
+// extractMatrix takes the --matrix AXIS=v1,v2 pairs out of the command arguments
+func extractMatrix(args []string) ([]string, []matrixAxis, error) {
+	rest := make([]string, 0, len(args))
+	var axes []matrixAxis
+	for i := 0; i < len(args); i++ {
+		if args[i] != matrixFlag {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, nil, fmt.Errorf("%s needs AXIS=value1,value2", matrixFlag)
+		}
+		i++
+		name, list, ok := strings.Cut(args[i], "=")
+		if !ok || name == "" || list == "" {
+			return nil, nil, fmt.Errorf("invalid matrix axis %q, use AXIS=value1,value2", args[i])
+		}
+		if name != matrixHostAxis && !matrixEnvName.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid matrix axis name %q", name)
+		}
+		for _, axis := range axes {
+			if axis.name == name {
+				return nil, nil, fmt.Errorf("matrix axis %s is given twice", name)
+			}
+		}
+		values := strings.Split(list, ",")
+		for _, value := range values {
+			if value == "" {
+				return nil, nil, fmt.Errorf("matrix axis %s has an empty value", name)
+			}
+		}
+		axes = append(axes, matrixAxis{name: name, values: values})
+	}
+	return rest, axes, nil
+}
+
+// expandMatrix builds every combination of the axes, the first axis varies slowest
+func expandMatrix(host string, axes []matrixAxis) []matrixCombination {
+	combinations := []matrixCombination{{host: host}}
+	for _, axis := range axes {
+		expanded := make([]matrixCombination, 0, len(combinations)*len(axis.values))
+		for _, combination := range combinations {
+			for _, value := range axis.values {
+				next := matrixCombination{
+					host: combination.host,
+					axes: append(append([]string{}, combination.axes...), axis.name+"="+value),
+					env:  append([]string{}, combination.env...),
+				}
+				if axis.name == matrixHostAxis {
+					next.host = value
+				} else {
+					next.env = append(next.env, "-e", axis.name+"="+value)
+				}
+				expanded = append(expanded, next)
+			}
+		}
+		combinations = expanded
+	}
+	return combinations
+}
+
+func matrixSize(axes []matrixAxis) int {
+	size := 1
+	for _, axis := range axes {
+		size *= len(axis.values)
+	}
+	return size
+}
+
+// startMatrixExec schedules a job per matrix combination and replies with a single table
+func (cmd *IssuePRCommand) startMatrixExec(
+	ctx context.Context, commandMeta *worker_report.GithubIssueMeta, args []string, axes []matrixAxis,
+	base startCallArgs,
+) (*gh_api.BotResponse, error) {
+	hostAxis := false
+	for _, axis := range axes {
+		hostAxis = hostAxis || axis.name == matrixHostAxis
+	}
+	if !hostAxis {
+		if len(args) == 0 {
+			return nil, errors.New("args are empty")
+		}
+		base.hostName, args = args[0], args[1:]
+	}
+	if len(args) < 1 {
+		return nil, errors.New("commit is missing")
+	}
+	base.commitId = args[0]
+	if len(args) > 1 {
+		base.workflowName = args[1]
+	}
+	if len(args) > 2 {
+		base.extraFlag = args[2:]
+	}
+	if size := matrixSize(axes); size > conf.GeneralEnvironments.MaxMatrixJobs {
+		return nil, fmt.Errorf(
+			"matrix expands into %d jobs, at most %d are allowed", size, conf.GeneralEnvironments.MaxMatrixJobs,
+		)
+	}
+	combinations := expandMatrix(base.hostName, axes)
+	for _, combination := range combinations {
+		if _, ok := conf.Hosts.Hosts[combination.host]; !ok {
+			return nil, fmt.Errorf("Unknown host %s", combination.host)
+		}
+	}
+
+	group := &worker_report.JobGroup{Id: uuid.NewString(), CreatedAt: time.Now()}
+	ctx = logging.With(ctx, logging.KeyGroup, group.Id)
+	var scheduled int
+	var lastErr error
+	for _, combination := range combinations {
+		callArgs := base
+		callArgs.hostName = combination.host
+		callArgs.extraFlag = append(append([]string{}, base.extraFlag...), combination.env...)
+		member := worker_report.GroupJob{Host: combination.host, Axes: combination.axes}
+		jobResponse, err := cmd.scheduleJob(logging.With(ctx, logging.KeyHost, combination.host), &callArgs)
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to schedule matrix job", "axes", combination.axes, "error", err)
+			member.Error = err.Error()
+			lastErr = err
+		} else {
+			member.JobId = jobResponse.JobId
+			scheduled++
+			cmd.notifyJobStarted(&callArgs, jobResponse.JobId)
+		}
+		group.Jobs = append(group.Jobs, member)
+	}
+	if scheduled == 0 {
+		return nil, fmt.Errorf("no matrix job could be scheduled: %w", lastErr)
+	}
+	slog.InfoContext(ctx, "matrix scheduled", "jobs", scheduled, "failed", len(combinations)-scheduled)
+	if commandMeta != nil {
+		commandMeta.Group = group
+	}
+	txt, err := templates.NewMatrixStartContext(cmd.history, group.Id, group.Rows(nil)).GenText()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to generate BotResponse", "error", err)
+		return nil, err
+	}
+	return cmd.botResponse(txt), nil
+}
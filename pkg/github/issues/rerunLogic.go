@@ -0,0 +1,142 @@
+package issues
+
+import (
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/pkg/workflow"
+	"ActQABot/templates"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+)
+
+type rerunArgs struct {
+	jobId string
+	host  string
+	ref   string
+}
+
+func parseRerunArgs(args []string) (*rerunArgs, error) {
+	var parsed rerunArgs
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "":
+			continue
+		case "--host", "--ref":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s requires a value", args[i])
+			}
+			if args[i] == "--host" {
+				parsed.host = args[i+1]
+			} else {
+				parsed.ref = args[i+1]
+			}
+			i++
+		default:
+			if parsed.jobId != "" {
+				return nil, fmt.Errorf("unexpected argument %s", args[i])
+			}
+			parsed.jobId = args[i]
+		}
+	}
+	return &parsed, nil
+}
+
+// rerunSpec finds the job to re-run, it has to come from the same repository
+func (cmd *IssuePRCommand) rerunSpec(ctx context.Context, jobId string) (*worker_report.JobSpec, error) {
+	issue := cmd.correspondingIssue
+	if jobId == "" {
+		spec, err := worker_report.LastJobSpec(
+			ctx, issue.Forge, issue.Repository.Owner.Login, issue.Repository.Name, issue.Issue.Number,
+		)
+		if errors.Is(err, worker_report.JobSpecNotFoundError) {
+			return nil, errors.New("no job was started in this issue yet")
+		}
+		return spec, err
+	}
+	spec, err := worker_report.GetJobSpec(ctx, jobId)
+	if err != nil && !errors.Is(err, worker_report.JobSpecNotFoundError) {
+		return nil, err
+	}
+	if spec == nil || spec.Forge != issue.Forge ||
+		spec.Owner != issue.Repository.Owner.Login || spec.Repository != issue.Repository.Name {
+		return nil, fmt.Errorf("job %s not found", jobId)
+	}
+	return spec, nil
+}
+
+func (cmd *IssuePRCommand) rerunJobIssueCommentCommandExec(
+	ctx context.Context, commandMeta *worker_report.GithubIssueMeta,
+) (*gh_api.BotResponse, error) {
+	rest, inputs, err := extractInputs(cmd.args)
+	if err != nil {
+		return nil, err
+	}
+	rest, timeout, err := extractTimeout(rest)
+	if err != nil {
+		return nil, err
+	}
+	args, err := parseRerunArgs(rest)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := cmd.rerunSpec(ctx, args.jobId)
+	if err != nil {
+		return nil, err
+	}
+	// the stored commit keeps a re-run of a branch on the same code
+	callArgs := startCallArgs{
+		hostName:     spec.Host,
+		commitId:     spec.Commit,
+		workflowName: spec.WorkflowFile,
+		extraFlag:    spec.ExtraFlags,
+		inputs:       maps.Clone(spec.Inputs),
+		rerunOf:      spec.JobId,
+		timeout:      spec.Timeout,
+	}
+	if timeout > 0 {
+		callArgs.timeout = timeout
+	}
+	for name, value := range inputs {
+		if callArgs.inputs == nil {
+			callArgs.inputs = make(map[string]string, len(inputs))
+		}
+		callArgs.inputs[name] = value
+	}
+	if args.host != "" {
+		callArgs.hostName = args.host
+	}
+	if args.ref != "" {
+		callArgs.commitId = args.ref
+	}
+	jobResponse, err := cmd.scheduleJob(ctx, &callArgs)
+	if err != nil {
+		return nil, err
+	}
+	if commandMeta != nil {
+		commandMeta.JobId = new(string)
+		*commandMeta.JobId = jobResponse.JobId
+		commandMeta.Host = callArgs.hostName
+		commandMeta.RerunOf = new(string)
+		*commandMeta.RerunOf = spec.JobId
+	}
+	cmd.notifyJobStarted(&callArgs, jobResponse.JobId)
+	tmpContext := templates.NewStartCmdContext(
+		cmd.history,
+		callArgs.hostName,
+		callArgs.extraFlag,
+		jobResponse,
+	)
+	tmpContext.RerunOf = spec.JobId
+	tmpContext.Warnings = callArgs.warnings
+	tmpContext.Inputs = workflow.InputList(callArgs.resolvedInputs)
+	tmpContext.Timeout = formatTimeout(callArgs.resolvedTimeout)
+	txt, err := tmpContext.GenText()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to generate BotResponse", "error", err)
+		return nil, err
+	}
+	return cmd.botResponse(txt), nil
+}
@@ -0,0 +1,106 @@
+package issues
+
+import (
+	"ActQABot/internal/logging"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/pkg/workflow"
+	"ActQABot/templates"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ScheduledSender stands for the comment author of scheduled runs
+const ScheduledSender = "scheduler"
+
+// ScheduledStart is a /wf_start issued by the scheduler instead of a comment
+type ScheduledStart struct {
+	Schedule   string
+	Forge      string
+	Repository string // "owner/repo"
+	Ref        string
+	Workflow   string
+	Host       string
+	ExtraFlags []string
+	Inputs     map[string]string
+	// issue receiving the start and report comments
+	TrackingIssue int
+	Timeout       time.Duration
+}
+
+// StartScheduled schedules the job like /wf_start and posts the reply to the tracking issue,
+// the worker report follows through the job meta. Failures are posted there as well.
+func StartScheduled(ctx context.Context, run ScheduledStart) (jobId string, err error) {
+	owner, repo, _ := strings.Cut(run.Repository, "/")
+	var issueComment IssueComment
+	if run.Forge != forge.GitHub {
+		issueComment.Forge = run.Forge
+	}
+	issueComment.Action = "created"
+	issueComment.Issue.Number = run.TrackingIssue
+	issueComment.Comment.Body = fmt.Sprintf("schedule %s", run.Schedule)
+	issueComment.Comment.User.Login = ScheduledSender
+	issueComment.Repository.FullName = run.Repository
+	issueComment.Repository.Owner.Login = owner
+	issueComment.Repository.Name = repo
+	ctx = logging.With(ctx, logging.KeyRepo, run.Repository, logging.KeyIssue, run.TrackingIssue)
+	ctx, span := tracing.Start(ctx, "issues.StartScheduled")
+	defer func() {
+		tracing.End(span, err)
+		if err != nil {
+			if enqueueErr := outbox.Enqueue(ctx, outbox.NewCommentItem(ErrorToBotResponse(err, &issueComment))); enqueueErr != nil {
+				slog.ErrorContext(ctx, "outbox.Enqueue failed", "error", enqueueErr)
+			}
+		}
+	}()
+
+	cmd := &IssuePRCommand{correspondingIssue: issueComment, command: StartJob}
+	callArgs := startCallArgs{
+		hostName:     run.Host,
+		commitId:     run.Ref,
+		workflowName: run.Workflow,
+		extraFlag:    run.ExtraFlags,
+		inputs:       run.Inputs,
+		timeout:      run.Timeout,
+	}
+	jobResponse, err := cmd.scheduleJob(ctx, &callArgs)
+	if err != nil {
+		return "", err
+	}
+	ctx = logging.With(ctx, logging.KeyHost, run.Host, logging.KeyJob, jobResponse.JobId)
+	cmd.notifyJobStarted(&callArgs, jobResponse.JobId)
+	tmpContext := templates.NewStartCmdContext(nil, run.Host, run.ExtraFlags, jobResponse)
+	tmpContext.Schedule = run.Schedule
+	tmpContext.Warnings = callArgs.warnings
+	tmpContext.Inputs = workflow.InputList(callArgs.resolvedInputs)
+	tmpContext.Timeout = formatTimeout(callArgs.resolvedTimeout)
+	txt, err := tmpContext.GenText()
+	if err != nil {
+		return "", err
+	}
+	meta := worker_report.GithubIssueMeta{
+		Forge:             issueComment.Forge,
+		Sender:            ScheduledSender,
+		Body:              issueComment.Comment.Body,
+		Owner:             owner,
+		Repository:        repo,
+		AnswerCommentBody: &txt,
+		IssueId:           run.TrackingIssue,
+		Host:              run.Host,
+		JobId:             &jobResponse.JobId,
+		Trace:             tracing.Inject(ctx),
+	}
+	// the job runs anyway, only its report would be lost
+	if err := meta.Store(ctx, jobResponse.JobId, 5); err != nil {
+		slog.ErrorContext(ctx, "githubIssueMeta.Store failed", "error", err)
+	}
+	if err := outbox.Enqueue(ctx, outbox.NewCommentItem(cmd.botResponse(txt))); err != nil {
+		slog.ErrorContext(ctx, "outbox.Enqueue failed", "error", err)
+	}
+	return jobResponse.JobId, nil
+}
@@ -3,17 +3,30 @@ package issues
 import (
 	"ActQABot/conf"
 	"ActQABot/internal/grpc_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/container_policy"
+	"ActQABot/pkg/forge"
 	"ActQABot/pkg/github/gh_api"
 	"ActQABot/pkg/hosts"
+	"ActQABot/pkg/notify"
+	"ActQABot/pkg/secrets"
+	"ActQABot/pkg/watchdog"
+	"ActQABot/pkg/webhooks"
 	"ActQABot/pkg/worker_report"
+	"ActQABot/pkg/workflow"
 	"ActQABot/templates"
 	"context"
 	"errors"
 	"fmt"
 	actservice "github.com/D1-3105/ActService/api/gen/ActService"
-	"github.com/golang/glog"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"strings"
+	"time"
 )
 
 type startCallArgs struct {
@@ -21,20 +34,89 @@ type startCallArgs struct {
 	commitId     string
 	workflowName string `default:".github/workflows/"`
 	extraFlag    []string
+	// set by createJob, the commit commitId pointed to
+	resolvedCommit string
+	// job being re-run
+	rerunOf string
+	// workflow_dispatch inputs as given, and after defaults were applied by createJob
+	inputs         map[string]string
+	resolvedInputs map[string]string
+	// set by createJob, workflow problems that don't keep the job from running
+	warnings []string
+	// set by scheduleJob, identifies the run in the custom_flags before ActService assigns the job ID
+	runId string
+	// maximum duration asked for with --timeout, and the one applied by scheduleJob within the host limit
+	timeout         time.Duration
+	resolvedTimeout time.Duration
 }
 
-func createJob(ctx context.Context, callArgs *startCallArgs, cmd *IssuePRCommand) (*actservice.JobResponse, error) {
+func createJob(ctx context.Context, callArgs *startCallArgs, cmd *IssuePRCommand) (_ *actservice.JobResponse, err error) {
+	ctx, span := tracing.Start(
+		ctx, "createJob", trace.WithAttributes(
+			attribute.String("job.host", callArgs.hostName),
+			attribute.String("job.ref", callArgs.commitId),
+			attribute.String("job.workflow", callArgs.workflowName),
+		),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+	ctx = logging.With(ctx, logging.KeyHost, callArgs.hostName)
 	hostConf, ok := conf.Hosts.Hosts[callArgs.hostName]
 	if !ok {
 		return nil, errors.New(fmt.Sprintf("Unknown host %s", callArgs.hostName))
 	}
 	grpcConn, err := grpc_utils.NewGRPCConn(hostConf)
 	if err != nil {
-		glog.Errorf("unable to create connection, %s", err.Error())
+		slog.ErrorContext(ctx, "unable to create connection", "error", err)
 		return nil, err
 	}
+	repoForge, err := forge.Get(cmd.correspondingIssue.Forge)
+	if err != nil {
+		return nil, err
+	}
+	commitId, err := repoForge.ResolveRef(
+		ctx, cmd.correspondingIssue.Repository.Owner.Login, cmd.correspondingIssue.Repository.Name, callArgs.commitId,
+	)
+	if err != nil {
+		// ActService checks the ref out itself, resolving only pins it
+		slog.WarnContext(ctx, "unable to resolve ref, passing it as is", "ref", callArgs.commitId, "error", err)
+		commitId = callArgs.commitId
+	}
+	callArgs.resolvedCommit = commitId
+	callArgs.resolvedInputs = callArgs.inputs
+	if len(callArgs.inputs) > 0 && !conf.GeneralEnvironments.ValidateWorkflows {
+		return nil, workflow.UncheckedInputsError
+	}
+	if conf.GeneralEnvironments.ValidateWorkflows {
+		callArgs.warnings, callArgs.resolvedInputs, err = workflow.Check(
+			ctx, repoForge, cmd.correspondingIssue.Repository.Owner.Login, cmd.correspondingIssue.Repository.Name,
+			commitId, callArgs.workflowName, hostConf, callArgs.inputs,
+		)
+		if err != nil {
+			metrics.WorkflowValidationFailures.WithLabelValues(callArgs.hostName).Inc()
+			return nil, err
+		}
+	}
 	client := actservice.NewActServiceClient(grpcConn)
-	resultExtraFlags := append([]string{}, hostConf.CustomFlags...)
+	flagCtx := hosts.FlagContext{
+		Forge:      cmd.correspondingIssue.Forge,
+		Repository: cmd.correspondingIssue.Repository.FullName,
+		Owner:      cmd.correspondingIssue.Repository.Owner.Login,
+		Repo:       cmd.correspondingIssue.Repository.Name,
+		Issue:      cmd.correspondingIssue.Issue.Number,
+		Sender:     cmd.correspondingIssue.Comment.User.Login,
+		Ref:        callArgs.commitId,
+		Commit:     commitId,
+		Workflow:   callArgs.workflowName,
+		Host:       callArgs.hostName,
+		RunId:      callArgs.runId,
+	}
+	resultExtraFlags, err := hosts.RenderCustomFlags(callArgs.hostName, hostConf, flagCtx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to render the custom flags", "error", err)
+		return nil, err
+	}
 	found := false
 	for i, f := range resultExtraFlags {
 		if strings.HasPrefix(f, "--container-options") {
@@ -54,55 +136,211 @@ func createJob(ctx context.Context, callArgs *startCallArgs, cmd *IssuePRCommand
 			strings.Join(callArgs.extraFlag, " "),
 		)
 	}
+	// the value act gets, the custom_flags of the operator included
+	if containerOptions, ok := hosts.ContainerOptions(resultExtraFlags); ok {
+		trusted, err := hosts.TrustedContainerOptions(callArgs.hostName, hostConf, flagCtx)
+		if err != nil {
+			return nil, err
+		}
+		if err = container_policy.CheckContainerOptions(
+			callArgs.hostName, container_policy.For(conf.Hosts, hostConf), containerOptions, trusted,
+		); err != nil {
+			metrics.ContainerPolicyViolations.WithLabelValues(callArgs.hostName).Inc()
+			return nil, err
+		}
+	}
+	resultExtraFlags = append(resultExtraFlags, workflow.InputFlags(callArgs.resolvedInputs)...)
+	jobSecrets, err := secrets.ForJob(
+		ctx, cmd.correspondingIssue.Forge, cmd.correspondingIssue.Repository.FullName, callArgs.hostName,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to load the repository secrets", "error", err)
+		return nil, err
+	}
+	if len(jobSecrets) > 0 && hostConf.TlsCert == nil && !hostConf.AllowPlaintextSecrets {
+		return nil, fmt.Errorf(
+			"host %s has no tls_cert, the repository secrets can't be sent to it "+
+				"(allow_plaintext_secrets sends them anyway)", callArgs.hostName,
+		)
+	}
 
 	job := &actservice.Job{
-		RepoUrl:      fmt.Sprintf("git@github.com:%s.git", cmd.correspondingIssue.Repository.FullName),
-		CommitId:     callArgs.commitId,
+		RepoUrl:      repoForge.CloneURL(cmd.correspondingIssue.Repository.FullName),
+		CommitId:     commitId,
 		WorkflowFile: &callArgs.workflowName,
-		ExtraFlags:   resultExtraFlags,
+		ExtraFlags:   append(resultExtraFlags, secrets.Flags(jobSecrets)...),
 	}
-	glog.Infof(
-		"Scheduling job of repo %s, commitId %s, workflowFile %s, extraFlags %v", job.RepoUrl, job.CommitId,
-		*job.WorkflowFile, job.ExtraFlags,
+	// the secret values only go to ActService
+	slog.InfoContext(
+		ctx, "scheduling job", "run_id", callArgs.runId,
+		"repo_url", job.RepoUrl, "commit", job.CommitId, "workflow", *job.WorkflowFile, "extra_flags", resultExtraFlags,
+		"secrets", secrets.Names(jobSecrets),
 	)
-	actJobResponse, err := client.ScheduleActJob(ctx, job)
+	scheduleStart := time.Now()
+	actJobResponse, err := client.ScheduleActJob(tracing.OutgoingGRPC(ctx), job)
+	metrics.ScheduleJobDuration.WithLabelValues(callArgs.hostName).Observe(time.Since(scheduleStart).Seconds())
 	if err != nil {
-		glog.Errorf("unable to schedule job, %s", err.Error())
+		metrics.ScheduleJobErrors.WithLabelValues(callArgs.hostName).Inc()
+		slog.ErrorContext(ctx, "unable to schedule job", "error", err)
 		return nil, err
 	}
+	span.SetAttributes(attribute.String("job.id", actJobResponse.JobId))
+	slog.InfoContext(ctx, "job scheduled", logging.KeyJob, actJobResponse.JobId)
 	return actJobResponse, nil
 }
 
-func (cmd *IssuePRCommand) startJobIssueCommentCommandExec(commandMeta *worker_report.GithubIssueMeta) (*gh_api.BotResponse, error) {
-	var callArgs startCallArgs
-	var err error
-
-	if len(cmd.args) < 2 {
-		return nil, errors.New("args are empty")
-	}
-	callArgs.hostName = cmd.args[0]
-	callArgs.commitId = cmd.args[1]
-	if len(cmd.args) > 2 {
-		callArgs.workflowName = cmd.args[2]
-	}
-	if len(cmd.args) > 3 {
-		callArgs.extraFlag = cmd.args[3:]
+// scheduleJob takes a slot of the host while the job is scheduled and keeps its spec for /wf_rerun
+func (cmd *IssuePRCommand) scheduleJob(ctx context.Context, callArgs *startCallArgs) (*actservice.JobResponse, error) {
+	// the options go verbatim to docker on the host
+	if hostConf, ok := conf.Hosts.Hosts[callArgs.hostName]; ok {
+		// act splits the options again, as shell words: the policy must see the same words
+		policy := container_policy.For(conf.Hosts, hostConf)
+		if err := container_policy.CheckContainerOptions(
+			callArgs.hostName, policy, strings.Join(callArgs.extraFlag, " "), nil,
+		); err != nil {
+			metrics.ContainerPolicyViolations.WithLabelValues(callArgs.hostName).Inc()
+			return nil, err
+		}
 	}
-	jobContext, cancel := context.WithCancel(context.Background())
+	jobContext, cancel := context.WithCancel(ctx)
 	defer cancel()
 	callControl, err := hosts.HostAvbl.WrapJobCtx(callArgs.hostName, jobContext)
 	if err != nil {
 		return nil, err
 	}
 	go callControl()
+	callArgs.runId = uuid.NewString()
 	var jobResponse *actservice.JobResponse
-	if !conf.GeneralEnvironments.DryRunJobs {
-		jobResponse, err = createJob(jobContext, &callArgs, cmd)
-	} else {
+	if conf.GeneralEnvironments.DryRunJobs {
 		jobResponse = &actservice.JobResponse{
 			JobId: uuid.NewString(),
 		}
+		callArgs.resolvedCommit = callArgs.commitId
+		callArgs.resolvedInputs = callArgs.inputs
+	} else if jobResponse, err = createJob(jobContext, callArgs, cmd); err != nil {
+		return nil, err
+	}
+	webhooks.Publish(webhooks.NewEvent(webhooks.EventJobScheduled, cmd.webhookJob(callArgs, jobResponse.JobId)))
+	limit := watchdog.Limit(conf.Hosts, callArgs.hostName, callArgs.workflowName)
+	var capped bool
+	callArgs.resolvedTimeout, capped = watchdog.Effective(limit, callArgs.timeout)
+	if capped {
+		callArgs.warnings = append(
+			callArgs.warnings, fmt.Sprintf(
+				"%s %s exceeds the limit of %s for this host and workflow, the limit applies",
+				timeoutFlag, watchdog.Format(callArgs.timeout), watchdog.Format(limit),
+			),
+		)
+	}
+	// a dry run has nothing to cancel
+	if !conf.GeneralEnvironments.DryRunJobs {
+		if err = watchdog.Watch(ctx, jobResponse.JobId, callArgs.hostName, callArgs.resolvedTimeout); err != nil {
+			slog.ErrorContext(
+				ctx, "failed to record the job deadline, it won't be cancelled", logging.KeyJob, jobResponse.JobId,
+				"error", err,
+			)
+		}
+	}
+	spec := &worker_report.JobSpec{
+		JobId:        jobResponse.JobId,
+		RunId:        callArgs.runId,
+		Forge:        cmd.correspondingIssue.Forge,
+		Owner:        cmd.correspondingIssue.Repository.Owner.Login,
+		Repository:   cmd.correspondingIssue.Repository.Name,
+		IssueNumber:  cmd.correspondingIssue.Issue.Number,
+		Host:         callArgs.hostName,
+		Ref:          callArgs.commitId,
+		Commit:       callArgs.resolvedCommit,
+		WorkflowFile: callArgs.workflowName,
+		ExtraFlags:   callArgs.extraFlag,
+		Inputs:       callArgs.resolvedInputs,
+		Requester:    cmd.correspondingIssue.Comment.User.Login,
+		CreatedAt:    time.Now(),
+		RerunOf:      callArgs.rerunOf,
+		Timeout:      callArgs.timeout,
 	}
+	// the job runs anyway, it just can't be re-run
+	if err = worker_report.SaveJobSpec(ctx, spec); err != nil {
+		slog.ErrorContext(ctx, "failed to store job spec", logging.KeyJob, jobResponse.JobId, "error", err)
+	}
+	return jobResponse, nil
+}
+
+// notifyJobStarted announces a job ActService accepted, once per job
+func (cmd *IssuePRCommand) notifyJobStarted(callArgs *startCallArgs, jobId string) {
+	webhooks.Publish(webhooks.NewEvent(webhooks.EventJobStarted, cmd.webhookJob(callArgs, jobId)))
+	notify.Notify(
+		notify.Event{
+			Kind:        templates.NotificationJobStarted,
+			Owner:       cmd.correspondingIssue.Repository.Owner.Login,
+			Repo:        cmd.correspondingIssue.Repository.Name,
+			IssueNumber: cmd.correspondingIssue.Issue.Number,
+			Sender:      cmd.correspondingIssue.Comment.User.Login,
+			Host:        callArgs.hostName,
+			JobId:       jobId,
+			Command:     cmd.correspondingIssue.Comment.Body,
+		},
+	)
+}
+
+func (cmd *IssuePRCommand) webhookJob(callArgs *startCallArgs, jobId string) webhooks.Job {
+	return webhooks.Job{
+		Id:          jobId,
+		Host:        callArgs.hostName,
+		Forge:       cmd.correspondingIssue.Forge,
+		Owner:       cmd.correspondingIssue.Repository.Owner.Login,
+		Repository:  cmd.correspondingIssue.Repository.Name,
+		IssueNumber: cmd.correspondingIssue.Issue.Number,
+		Sender:      cmd.correspondingIssue.Comment.User.Login,
+		Command:     cmd.correspondingIssue.Comment.Body,
+		RerunOf:     callArgs.rerunOf,
+	}
+}
+
+func (cmd *IssuePRCommand) botResponse(text string) *gh_api.BotResponse {
+	return &gh_api.BotResponse{
+		Forge:       cmd.correspondingIssue.Forge,
+		Owner:       cmd.correspondingIssue.Repository.Owner.Login,
+		Repo:        cmd.correspondingIssue.Repository.Name,
+		IssueNumber: cmd.correspondingIssue.Issue.Number,
+		Text:        text,
+	}
+}
+
+func (cmd *IssuePRCommand) startJobIssueCommentCommandExec(
+	ctx context.Context, commandMeta *worker_report.GithubIssueMeta,
+) (*gh_api.BotResponse, error) {
+	var callArgs startCallArgs
+
+	args, inputs, err := extractInputs(cmd.args)
+	if err != nil {
+		return nil, err
+	}
+	args, timeout, err := extractTimeout(args)
+	if err != nil {
+		return nil, err
+	}
+	args, axes, err := extractMatrix(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(axes) > 0 {
+		return cmd.startMatrixExec(ctx, commandMeta, args, axes, startCallArgs{inputs: inputs, timeout: timeout})
+	}
+	callArgs.inputs = inputs
+	callArgs.timeout = timeout
+	if len(args) < 2 {
+		return nil, errors.New("args are empty")
+	}
+	callArgs.hostName = args[0]
+	callArgs.commitId = args[1]
+	if len(args) > 2 {
+		callArgs.workflowName = args[2]
+	}
+	if len(args) > 3 {
+		callArgs.extraFlag = args[3:]
+	}
+	jobResponse, err := cmd.scheduleJob(ctx, &callArgs)
 	if err != nil {
 		return nil, err
 	}
@@ -111,21 +349,20 @@ func (cmd *IssuePRCommand) startJobIssueCommentCommandExec(commandMeta *worker_r
 		*commandMeta.JobId = jobResponse.JobId
 		commandMeta.Host = callArgs.hostName
 	}
+	cmd.notifyJobStarted(&callArgs, jobResponse.JobId)
 	tmpContext := templates.NewStartCmdContext(
 		cmd.history,
 		callArgs.hostName,
 		callArgs.extraFlag,
 		jobResponse,
 	)
+	tmpContext.Warnings = callArgs.warnings
+	tmpContext.Inputs = workflow.InputList(callArgs.resolvedInputs)
+	tmpContext.Timeout = formatTimeout(callArgs.resolvedTimeout)
 	txt, err := tmpContext.GenText()
 	if err != nil {
-		glog.Errorf("failed to generate BotResponse: %v", err)
+		slog.ErrorContext(ctx, "failed to generate BotResponse", "error", err)
 		return nil, err
 	}
-	return &gh_api.BotResponse{
-		Owner:       cmd.correspondingIssue.Repository.Owner.Login,
-		Repo:        cmd.correspondingIssue.Repository.Name,
-		IssueNumber: cmd.correspondingIssue.Issue.Number,
-		Text:        txt,
-	}, err
+	return cmd.botResponse(txt), err
 }
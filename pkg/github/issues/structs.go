@@ -1,6 +1,9 @@
 package issues
 
 type IssueComment struct {
+	// Forge the comment came from, empty for GitHub
+	Forge string `json:"-"`
+
 	Action string `json:"action"` // "created", "edited", "deleted"
 
 	Issue struct {
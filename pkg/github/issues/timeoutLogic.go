@@ -0,0 +1,41 @@
+package issues
+
+import (
+	"ActQABot/pkg/watchdog"
+	"fmt"
+	"time"
+)
+
+const timeoutFlag = "--timeout"
+
+// extractTimeout takes --timeout DURATION out of the command arguments, 0 when it isn't given
+func extractTimeout(args []string) ([]string, time.Duration, error) {
+	rest := make([]string, 0, len(args))
+	var timeout time.Duration
+	for i := 0; i < len(args); i++ {
+		if args[i] != timeoutFlag {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, 0, fmt.Errorf("%s needs a duration such as 2h or 90m", timeoutFlag)
+		}
+		if timeout != 0 {
+			return nil, 0, fmt.Errorf("%s is given twice", timeoutFlag)
+		}
+		i++
+		var err error
+		if timeout, err = time.ParseDuration(args[i]); err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("invalid %s %q, use a duration such as 2h or 90m", timeoutFlag, args[i])
+		}
+	}
+	return rest, timeout, nil
+}
+
+// formatTimeout is the time limit shown in the start comment, empty for unlimited jobs
+func formatTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return ""
+	}
+	return watchdog.Format(timeout)
+}
@@ -0,0 +1,77 @@
+package gl_api
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var HTTPClient = &http.Client{}
+
+// projectPath is the url-encoded "group/project" GitLab accepts in place of the numeric project id
+func projectPath(owner, repo string) string {
+	return url.PathEscape(owner + "/" + repo)
+}
+
+func apiURL(glEnv conf.GitlabAPIEnvironment, path string) string {
+	return strings.TrimSuffix(glEnv.URL, "/") + "/api/v4" + path
+}
+
+// do sends a REST v4 request and decodes the JSON answer into out (if not nil)
+func do(ctx context.Context, glEnv conf.GitlabAPIEnvironment, method, path string, in, out interface{}) error {
+	if glEnv.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, glEnv.Timeout)
+		defer cancel()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL(glEnv, path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", glEnv.Token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 300 {
+		return forge.NewAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("malformed GitLab response: %w", err)
+	}
+	return nil
+}
+
+// CloneURL is the URL ActService clones "group/project" from
+func CloneURL(glEnv conf.GitlabAPIEnvironment, fullName string) string {
+	format := glEnv.CloneURLFormat
+	if format == "" {
+		format = "git@gitlab.com:%s.git"
+	}
+	return fmt.Sprintf(format, fullName)
+}
@@ -0,0 +1,63 @@
+package gl_api
+
+import (
+	"ActQABot/conf"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var GetFileFunc = getFile
+var ListFilesFunc = listFiles
+
+type File struct {
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+type TreeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"` // "blob" or "tree"
+}
+
+func getFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	query := url.Values{}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	query.Set("ref", ref)
+	filePath := fmt.Sprintf(
+		"/projects/%s/repository/files/%s?%s", projectPath(owner, repo), url.PathEscape(path), query.Encode(),
+	)
+	var file File
+	if err := do(ctx, conf.GitlabEnvironment, "GET", filePath, nil, &file); err != nil {
+		return nil, err
+	}
+	if file.Encoding != "base64" {
+		return []byte(file.Content), nil
+	}
+	return base64.StdEncoding.DecodeString(file.Content)
+}
+
+func listFiles(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+	query := url.Values{}
+	query.Set("path", strings.TrimSuffix(dir, "/"))
+	query.Set("per_page", "100")
+	if ref != "" {
+		query.Set("ref", ref)
+	}
+	var entries []TreeEntry
+	treePath := fmt.Sprintf("/projects/%s/repository/tree?%s", projectPath(owner, repo), query.Encode())
+	if err := do(ctx, conf.GitlabEnvironment, "GET", treePath, nil, &entries); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type == "blob" {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths, nil
+}
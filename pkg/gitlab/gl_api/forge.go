@@ -0,0 +1,38 @@
+package gl_api
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"context"
+)
+
+func init() {
+	forge.Register(forge.GitLab, gitlabForge{})
+}
+
+// gitlabForge answers on merge requests as the user owning GITLAB_TOKEN
+type gitlabForge struct{}
+
+func (gitlabForge) PostReply(ctx context.Context, reply *forge.Reply) error {
+	return PostMergeRequestNoteFunc(ctx, reply)
+}
+
+func (gitlabForge) UpdateReply(ctx context.Context, reply *forge.Reply) error {
+	return UpdateMergeRequestNoteFunc(ctx, reply)
+}
+
+func (gitlabForge) ResolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	return ResolveRefFunc(ctx, owner, repo, ref)
+}
+
+func (gitlabForge) GetFile(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	return GetFileFunc(ctx, owner, repo, ref, path)
+}
+
+func (gitlabForge) ListFiles(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+	return ListFilesFunc(ctx, owner, repo, ref, dir)
+}
+
+func (gitlabForge) CloneURL(fullName string) string {
+	return CloneURL(conf.GitlabEnvironment, fullName)
+}
@@ -0,0 +1,48 @@
+package gl_api
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var PostMergeRequestNoteFunc = postMergeRequestNote
+var UpdateMergeRequestNoteFunc = updateMergeRequestNote
+var ResolveRefFunc = resolveRef
+
+type Note struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+type Commit struct {
+	ID string `json:"id"`
+}
+
+func postMergeRequestNote(ctx context.Context, reply *forge.Reply) error {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d/notes", projectPath(reply.Owner, reply.Repo), reply.IssueNumber)
+	return do(ctx, conf.GitlabEnvironment, "POST", path, map[string]string{"body": reply.Text}, &Note{})
+}
+
+func updateMergeRequestNote(ctx context.Context, reply *forge.Reply) error {
+	if reply.CommentId == nil {
+		return errors.New("note id is required to update a note")
+	}
+	path := fmt.Sprintf(
+		"/projects/%s/merge_requests/%d/notes/%d", projectPath(reply.Owner, reply.Repo), reply.IssueNumber,
+		*reply.CommentId,
+	)
+	return do(ctx, conf.GitlabEnvironment, "PUT", path, map[string]string{"body": reply.Text}, &Note{})
+}
+
+func resolveRef(ctx context.Context, owner, repo, ref string) (string, error) {
+	path := fmt.Sprintf("/projects/%s/repository/commits/%s", projectPath(owner, repo), url.PathEscape(ref))
+	var commit Commit
+	if err := do(ctx, conf.GitlabEnvironment, "GET", path, nil, &commit); err != nil {
+		return "", err
+	}
+	return commit.ID, nil
+}
@@ -0,0 +1,261 @@
+package hosts
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/container_policy"
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// FlagContext holds the variables of the custom_flags templates, e.g.
+// "--container-options=-v /cache/{{ slug .Repository }}:/cache --label run={{ .RunId }}".
+//
+// ActService assigns the job ID in its answer to the flags, so it can't be one of them: RunId is generated
+// by the bot before scheduling and kept in the job spec next to the job ID.
+type FlagContext struct {
+	Forge string
+	// owner/name
+	Repository string
+	Owner      string
+	Repo       string
+	Issue      int
+	Sender     string
+	// ref as written in the command and the commit it resolved to
+	Ref      string
+	Commit   string
+	Workflow string
+	Host     string
+	RunId    string
+}
+
+const containerOptionsFlag = "--container-options"
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var flagFuncs = template.FuncMap{
+	// slug keeps a value usable in a path or a container name: owner/repo becomes owner-repo
+	"slug": func(value any) string {
+		return strings.TrimLeft(unsafeChars.ReplaceAllString(fmt.Sprint(value), "-"), ".-")
+	},
+}
+
+// quoteFunc is appended to the actions of the --container-options templates, the name can't be typed in one
+const quoteFunc = "_shell_quote"
+
+// quoteActions makes every value printed by the template a single shell word: act splits the
+// --container-options value into words, a ref like "x --privileged" must not become an option
+func quoteActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(
+				n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand, Pos: n.Pos,
+					Args: []parse.Node{parse.NewIdentifier(quoteFunc).SetPos(n.Pos)},
+				},
+			)
+		}
+	case *parse.IfNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.WithNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	}
+}
+
+func parseCustomFlag(host string, i int, flag string) (*template.Template, error) {
+	templ, err := template.New(fmt.Sprintf("%s custom_flags[%d]", host, i)).
+		Funcs(flagFuncs).
+		Funcs(template.FuncMap{quoteFunc: func(value any) string { return container_policy.QuoteWord(fmt.Sprint(value)) }}).
+		Option("missingkey=error").
+		Parse(flag)
+	if err != nil {
+		return nil, fmt.Errorf("host %s custom_flags[%d]: %w", host, i, err)
+	}
+	return templ, nil
+}
+
+func flagVariables() []string {
+	t := reflect.TypeOf(FlagContext{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Name
+	}
+	return names
+}
+
+// checkVariables walks the whole template, the branches a sample rendering skips included
+func checkVariables(node parse.Node, known []string) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkVariables(child, known); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkVariables(n.Pipe, known)
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode, known)
+	case *parse.RangeNode:
+		return checkBranch(&n.BranchNode, known)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode, known)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkVariables(arg, known); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.ChainNode:
+		return checkVariables(n.Node, known)
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 || !slices.Contains(known, n.Ident[0]) {
+			return fmt.Errorf("unknown variable %s, the variables are %s", n, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode, known []string) error {
+	for _, child := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+		if err := checkVariables(child, known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderCustomFlags fills the custom_flags templates of the host with the job context. The values printed in
+// the --container-options value are shell quoted, each one stays within its word.
+func RenderCustomFlags(hostName string, host conf.Host, flagCtx FlagContext) ([]string, error) {
+	rendered := make([]string, 0, len(host.CustomFlags))
+	for i, flag := range host.CustomFlags {
+		if !strings.Contains(flag, "{{") {
+			rendered = append(rendered, flag)
+			continue
+		}
+		templ, err := parseCustomFlag(hostName, i, flag)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(flag, containerOptionsFlag+"=") || (i > 0 && host.CustomFlags[i-1] == containerOptionsFlag) {
+			quoteActions(templ.Tree.Root)
+		}
+		var buf bytes.Buffer
+		if err = templ.Execute(&buf, flagCtx); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, buf.String())
+	}
+	return rendered, nil
+}
+
+// ContainerOptions returns the --container-options value of the flags, given as --container-options=value
+// or as the next flag
+func ContainerOptions(flags []string) (string, bool) {
+	for i, flag := range flags {
+		if !strings.HasPrefix(flag, containerOptionsFlag) {
+			continue
+		}
+		if _, value, ok := strings.Cut(flag, "="); ok {
+			return value, true
+		}
+		if i+1 < len(flags) {
+			return flags[i+1], true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// trustedPlaceholder stands for every value printed by the --container-options templates when the trusted
+// words are rendered: a value is the job's, not the operator's, and must not exempt an option
+const trustedPlaceholder = "value"
+
+// TrustedContainerOptions returns the words of the --container-options the operator wrote in the custom_flags
+// of the host, with the branches taken for this job and the printed values replaced by a placeholder: they are
+// exempt from the container policy, the user ones aren't
+func TrustedContainerOptions(hostName string, host conf.Host, flagCtx FlagContext) ([]string, error) {
+	rendered := make([]string, 0, len(host.CustomFlags))
+	for i, flag := range host.CustomFlags {
+		if !strings.Contains(flag, "{{") {
+			rendered = append(rendered, flag)
+			continue
+		}
+		templ, err := parseCustomFlag(hostName, i, flag)
+		if err != nil {
+			return nil, err
+		}
+		quoteActions(templ.Tree.Root)
+		templ.Funcs(template.FuncMap{quoteFunc: func(any) string { return trustedPlaceholder }})
+		var buf bytes.Buffer
+		if err = templ.Execute(&buf, flagCtx); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, buf.String())
+	}
+	value, ok := ContainerOptions(rendered)
+	if !ok {
+		return nil, nil
+	}
+	words, err := container_policy.SplitWords(value)
+	if err != nil {
+		return nil, fmt.Errorf("host %s custom_flags %s: %w", hostName, containerOptionsFlag, err)
+	}
+	return words, nil
+}
+
+func sampleFlagContext(hostName string) FlagContext {
+	return FlagContext{
+		Forge: "github", Repository: "owner/repo", Owner: "owner", Repo: "repo", Issue: 1, Sender: "user",
+		Ref: "main", Commit: "0000000000000000000000000000000000000000", Workflow: ".github/workflows/ci.yml",
+		Host: hostName, RunId: "00000000-0000-0000-0000-000000000000",
+	}
+}
+
+// ValidateCustomFlags rejects the custom_flags templates that don't parse, use unknown variables or fail
+// to render, before any job is scheduled
+func ValidateCustomFlags(hostsEnv *conf.HostsEnvironment) error {
+	known := flagVariables()
+	for name, host := range hostsEnv.Hosts {
+		for i, flag := range host.CustomFlags {
+			templ, err := parseCustomFlag(name, i, flag)
+			if err != nil {
+				return err
+			}
+			if err = checkVariables(templ.Tree.Root, known); err != nil {
+				return fmt.Errorf("host %s custom_flags[%d]: %w", name, i, err)
+			}
+		}
+		if _, err := TrustedContainerOptions(name, host, sampleFlagContext(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
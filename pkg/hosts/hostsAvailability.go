@@ -2,9 +2,12 @@ package hosts
 
 import (
 	"ActQABot/conf"
+	"ActQABot/internal/metrics"
 	"context"
 	"errors"
-	"github.com/golang/glog"
+	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
 )
 
@@ -17,6 +20,9 @@ type Availability struct {
 var HostAvbl Availability
 
 func NewAvailability(hostsEnv *conf.HostsEnvironment) Availability {
+	for name, host := range hostsEnv.Hosts {
+		metrics.HostSlots.WithLabelValues(name).Set(float64(host.MaxConcurrency))
+	}
 	return Availability{
 		hostsEnv:        hostsEnv,
 		mutex:           &sync.Mutex{},
@@ -27,7 +33,7 @@ func NewAvailability(hostsEnv *conf.HostsEnvironment) Availability {
 func (ha *Availability) WrapJobCtx(hostName string, jobContext context.Context) (func(), error) {
 	host, ok := ha.hostsEnv.Hosts[hostName]
 	if !ok {
-		glog.Errorf("host %s not found", hostName)
+		slog.ErrorContext(jobContext, "host not found", "host", hostName)
 		return nil, errors.New("host not found")
 	}
 	hostAvbl, ok := ha.availabilityMap[hostName]
@@ -41,8 +47,10 @@ func (ha *Availability) WrapJobCtx(hostName string, jobContext context.Context)
 	}
 	return func() {
 		hostAvbl <- struct{}{} // lock
+		metrics.HostSlotsInUse.WithLabelValues(hostName).Inc()
 		defer func() {
 			<-hostAvbl // unlock
+			metrics.HostSlotsInUse.WithLabelValues(hostName).Dec()
 		}()
 		select {
 		case <-jobContext.Done():
@@ -50,3 +58,29 @@ func (ha *Availability) WrapJobCtx(hostName string, jobContext context.Context)
 		}
 	}, nil
 }
+
+// inUse is the number of slots of the host taken by jobs being scheduled
+func (ha *Availability) inUse(hostName string) int {
+	ha.mutex.Lock()
+	defer ha.mutex.Unlock()
+	return len(ha.availabilityMap[hostName])
+}
+
+// PickByLabel returns the host carrying the label with the most free slots, by name on ties
+func (ha *Availability) PickByLabel(label string) (string, error) {
+	var picked string
+	pickedFree := 0
+	for name, host := range ha.hostsEnv.Hosts {
+		if !slices.Contains(host.Labels, label) {
+			continue
+		}
+		free := host.MaxConcurrency - ha.inUse(name)
+		if picked == "" || free > pickedFree || (free == pickedFree && name < picked) {
+			picked, pickedFree = name, free
+		}
+	}
+	if picked == "" {
+		return "", fmt.Errorf("no host labeled %s", label)
+	}
+	return picked, nil
+}
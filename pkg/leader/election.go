@@ -0,0 +1,86 @@
+package leader
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/etcd_utils"
+	"context"
+	"errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+var NewElectionFunc = newEtcdElection
+
+// Election is a single campaign of this replica, bound to one etcd session
+type Election interface {
+	// Campaign blocks until the replica is elected with the given value
+	Campaign(ctx context.Context, value string) error
+	Resign(ctx context.Context) error
+	// Leader returns the value of the current leader, empty when there is none
+	Leader(ctx context.Context) (string, error)
+	// IsLeader checks with the store that the key won by Campaign is still the leader key
+	IsLeader(ctx context.Context) (bool, error)
+	// Done is closed when the session lease is lost; leadership is gone with it
+	Done() <-chan struct{}
+	Close() error
+}
+
+type etcdElection struct {
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+func newEtcdElection(haEnv conf.HAEnvironment) (Election, error) {
+	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
+		return nil, errors.New("etcd_store instance is nil")
+	}
+	session, err := concurrency.NewSession(
+		etcd_utils.EtcdStoreInstance.Client, concurrency.WithTTL(max(int(haEnv.SessionTTL.Seconds()), 1)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &etcdElection{session: session, election: concurrency.NewElection(session, haEnv.ElectionPrefix)}, nil
+}
+
+func (e *etcdElection) Campaign(ctx context.Context, value string) error {
+	return e.election.Campaign(ctx, value)
+}
+
+func (e *etcdElection) Resign(ctx context.Context) error {
+	return e.election.Resign(ctx)
+}
+
+func (e *etcdElection) Leader(ctx context.Context) (string, error) {
+	resp, err := e.election.Leader(ctx)
+	if errors.Is(err, concurrency.ErrElectionNoLeader) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// IsLeader compares the create revision of the campaign key in a txn: the key is gone once the
+// session lease expired, even when this replica didn't notice yet
+func (e *etcdElection) IsLeader(ctx context.Context) (bool, error) {
+	key := e.election.Key()
+	if key == "" {
+		return false, nil
+	}
+	resp, err := e.session.Client().Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", e.election.Rev())).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (e *etcdElection) Done() <-chan struct{} {
+	return e.session.Done()
+}
+
+func (e *etcdElection) Close() error {
+	return e.session.Close()
+}
@@ -0,0 +1,270 @@
+package leader
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status tells which replica runs the report consumer and the outbox worker
+type Status struct {
+	Enabled   bool   `json:"enabled"`
+	ReplicaId string `json:"replica_id" example:"qabot-7d9f8"`
+	// replica ID of the current leader, empty during an election
+	Leader      string     `json:"leader" example:"qabot-7d9f8"`
+	IsLeader    bool       `json:"is_leader"`
+	LeaderSince *time.Time `json:"leader_since,omitempty"`
+}
+
+var state = struct {
+	sync.Mutex
+	enabled     bool
+	replicaId   string
+	election    Election
+	leaderSince *time.Time
+}{}
+
+// ReplicaId is HA_REPLICA_ID, or the hostname
+func ReplicaId(haEnv conf.HAEnvironment) string {
+	if haEnv.ReplicaId != "" {
+		return haEnv.ReplicaId
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return uuid.NewString()
+}
+
+// NotLeaderError is returned by Fence when this replica must not act as the leader
+var NotLeaderError = errors.New("this replica is not the leader")
+
+// errWorkReturned ends a term whose work returned while still leading
+var errWorkReturned = errors.New("leader work returned")
+
+// Run calls work while this replica is the leader, until ctx is done.
+// The context passed to work is cancelled when leadership is lost, work must return then.
+// Without HA, work simply runs until ctx is done.
+func Run(ctx context.Context, haEnv conf.HAEnvironment, work func(ctx context.Context)) {
+	replicaId := ReplicaId(haEnv)
+	state.Lock()
+	state.enabled = haEnv.Enabled
+	state.replicaId = replicaId
+	state.Unlock()
+	defer func() {
+		state.Lock()
+		state.enabled = false
+		state.Unlock()
+	}()
+	if !haEnv.Enabled {
+		setLeader(true)
+		defer setLeader(false)
+		work(ctx)
+		return
+	}
+	logger := slog.With("replica", replicaId)
+	retry := haEnv.RetryInterval
+	for ctx.Err() == nil {
+		election, err := NewElectionFunc(haEnv)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to start an election session", "error", err, "retry_in", retry)
+			sleep(ctx, retry)
+			retry = nextRetry(haEnv, retry)
+			continue
+		}
+		state.Lock()
+		state.election = election
+		state.Unlock()
+		started := time.Now()
+		err = term(ctx, logger, haEnv, replicaId, election, work)
+		state.Lock()
+		state.election = nil
+		state.Unlock()
+		_ = election.Close()
+		// a long term proves the failure behind the backoff is over
+		if time.Since(started) > haEnv.MaxRetryInterval {
+			retry = haEnv.RetryInterval
+		}
+		if err != nil && ctx.Err() == nil {
+			if !errors.Is(err, errWorkReturned) {
+				logger.ErrorContext(ctx, "election failed", "error", err)
+			}
+			logger.InfoContext(ctx, "campaigning again later", "retry_in", retry)
+			sleep(ctx, retry)
+			retry = nextRetry(haEnv, retry)
+		}
+	}
+}
+
+func nextRetry(haEnv conf.HAEnvironment, retry time.Duration) time.Duration {
+	return max(min(retry*2, haEnv.MaxRetryInterval), haEnv.RetryInterval)
+}
+
+// term campaigns once and runs work for as long as the leadership lasts
+func term(
+	ctx context.Context, logger *slog.Logger, haEnv conf.HAEnvironment, replicaId string, election Election,
+	work func(ctx context.Context),
+) error {
+	// a lost session must abort a campaign still waiting for its turn
+	campaignCtx, stopCampaign := context.WithCancel(ctx)
+	defer stopCampaign()
+	go func() {
+		select {
+		case <-election.Done():
+			stopCampaign()
+		case <-campaignCtx.Done():
+		}
+	}()
+	logger.InfoContext(ctx, "campaigning for leadership")
+	if err := election.Campaign(campaignCtx, replicaId); err != nil {
+		return err
+	}
+	select {
+	case <-election.Done():
+		return nil
+	default:
+	}
+	logger.InfoContext(ctx, "elected leader")
+	setLeader(true)
+	leaderCtx, stop := context.WithCancel(ctx)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		work(leaderCtx)
+	}()
+	var err error
+	select {
+	case <-election.Done():
+		logger.ErrorContext(ctx, "leadership lost, the election session expired")
+	case lost := <-watchLeadership(leaderCtx, haEnv, election):
+		logger.ErrorContext(ctx, "leadership lost, stepping down", "reason", lost)
+	case <-ctx.Done():
+	case <-finished:
+		logger.ErrorContext(ctx, "leader work returned, stepping down")
+		err = errWorkReturned
+	}
+	stop()
+	<-finished
+	setLeader(false)
+	// resigning hands the leadership over right away instead of after the session TTL
+	resignCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if resignErr := election.Resign(resignCtx); resignErr != nil {
+		logger.ErrorContext(ctx, "failed to resign", "error", resignErr)
+	}
+	return err
+}
+
+// watchLeadership checks the leader key a few times per session TTL. The session keepalive alone
+// notices a lost lease late: the work of a partitioned leader is cancelled once the key is gone or
+// can't be confirmed for a whole TTL, by then another replica may have been elected.
+func watchLeadership(ctx context.Context, haEnv conf.HAEnvironment, election Election) <-chan string {
+	lost := make(chan string, 1)
+	interval := max(haEnv.SessionTTL/3, 10*time.Millisecond)
+	go func() {
+		confirmed := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			isLeader, err := election.IsLeader(checkCtx)
+			cancel()
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err == nil && !isLeader:
+				lost <- "the leader key is gone"
+				return
+			case err == nil:
+				confirmed = time.Now()
+			case time.Since(confirmed) > haEnv.SessionTTL:
+				lost <- "the leader key can't be checked: " + err.Error()
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+// Fence checks that this replica still leads right before a write only the leader may do, e.g.
+// a forge comment: the work context of an old leader may not be cancelled yet. Nil without HA.
+func Fence(ctx context.Context) error {
+	state.Lock()
+	enabled, leading, election := state.enabled, state.leaderSince != nil, state.election
+	state.Unlock()
+	if !enabled {
+		return nil
+	}
+	if !leading || election == nil {
+		return NotLeaderError
+	}
+	isLeader, err := election.IsLeader(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to confirm the leadership: %w", err)
+	}
+	if !isLeader {
+		return NotLeaderError
+	}
+	return nil
+}
+
+func setLeader(isLeader bool) {
+	state.Lock()
+	defer state.Unlock()
+	if isLeader == (state.leaderSince != nil) {
+		return
+	}
+	if isLeader {
+		now := time.Now()
+		state.leaderSince = &now
+		metrics.Leader.Set(1)
+	} else {
+		state.leaderSince = nil
+		metrics.Leader.Set(0)
+	}
+	metrics.LeaderChanges.Inc()
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// CurrentStatus asks etcd for the current leader when this replica isn't the one
+func CurrentStatus(ctx context.Context) (Status, error) {
+	state.Lock()
+	status := Status{
+		Enabled:     state.enabled,
+		ReplicaId:   state.replicaId,
+		IsLeader:    state.leaderSince != nil,
+		LeaderSince: state.leaderSince,
+	}
+	election := state.election
+	state.Unlock()
+	if status.IsLeader {
+		status.Leader = status.ReplicaId
+		return status, nil
+	}
+	if election == nil {
+		return status, nil
+	}
+	leader, err := election.Leader(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.Leader = leader
+	return status, nil
+}
@@ -0,0 +1,179 @@
+package log_excerpt
+
+import (
+	"ActQABot/conf"
+	"regexp"
+	"strings"
+)
+
+const (
+	KindPythonTraceback = "python traceback"
+	KindGoPanic         = "go panic"
+	KindErrorLines      = "error lines"
+	KindTail            = "log tail"
+)
+
+var goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[`)
+
+type Excerpt struct {
+	Kind  string
+	Lines []string
+	// true when a failure signal (traceback, panic or error pattern) was found
+	Failed bool
+}
+
+func (e *Excerpt) Text() string {
+	return strings.Join(e.Lines, "\n")
+}
+
+type Heuristics struct {
+	TailLines     int
+	ContextLines  int
+	MaxLines      int
+	ErrorPatterns []*regexp.Regexp
+}
+
+func NewHeuristics(env conf.LogExcerptEnvironment) (*Heuristics, error) {
+	h := &Heuristics{
+		TailLines:    env.TailLines,
+		ContextLines: env.ContextLines,
+		MaxLines:     env.MaxLines,
+	}
+	for _, p := range env.ErrorPatterns {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		h.ErrorPatterns = append(h.ErrorPatterns, re)
+	}
+	return h, nil
+}
+
+// Extract picks the most relevant failure section of the log: the last traceback or panic,
+// then lines matching error patterns with their context, and the plain tail otherwise.
+func (h *Heuristics) Extract(lines []string) *Excerpt {
+	if tb := h.lastPythonTraceback(lines); tb != nil {
+		return &Excerpt{Kind: KindPythonTraceback, Lines: h.limit(tb), Failed: true}
+	}
+	if p := h.lastGoPanic(lines); p != nil {
+		return &Excerpt{Kind: KindGoPanic, Lines: h.limit(p), Failed: true}
+	}
+	if el := h.errorLines(lines); el != nil {
+		return &Excerpt{Kind: KindErrorLines, Lines: el, Failed: true}
+	}
+	return &Excerpt{Kind: KindTail, Lines: tail(lines, h.TailLines), Failed: false}
+}
+
+// limit keeps the head of the section, where the origin of a trace is.
+func (h *Heuristics) limit(lines []string) []string {
+	if h.MaxLines > 0 && len(lines) > h.MaxLines {
+		return append(lines[:h.MaxLines:h.MaxLines], "...")
+	}
+	return lines
+}
+
+func (h *Heuristics) lastPythonTraceback(lines []string) []string {
+	start := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], "Traceback (most recent call last):") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	// the traceback lives in the header column; act prefixes every line with its job label
+	prefix := lines[start][:strings.Index(lines[start], "Traceback")]
+	end := start + 1
+	for ; end < len(lines); end++ {
+		body := strings.TrimPrefix(lines[end], prefix)
+		if body == "" || body[0] == ' ' || body[0] == '\t' {
+			continue
+		}
+		// first non-indented line is the exception itself
+		end++
+		break
+	}
+	return lines[start:min(end, len(lines))]
+}
+
+func (h *Heuristics) lastGoPanic(lines []string) []string {
+	start := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], "panic: ") || strings.Contains(lines[i], "fatal error: ") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	end := start + 1
+	sawGoroutine := false
+	for ; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if goroutineHeader.MatchString(trimmed) {
+			sawGoroutine = true
+			continue
+		}
+		if trimmed == "" && sawGoroutine {
+			break
+		}
+		if strings.HasPrefix(trimmed, "exit status ") {
+			end++
+			break
+		}
+	}
+	if !sawGoroutine {
+		return nil
+	}
+	return lines[start:min(end, len(lines))]
+}
+
+func (h *Heuristics) errorLines(lines []string) []string {
+	if len(h.ErrorPatterns) == 0 {
+		return nil
+	}
+	selected := make([]bool, len(lines))
+	found := false
+	for i, line := range lines {
+		for _, re := range h.ErrorPatterns {
+			if !re.MatchString(line) {
+				continue
+			}
+			found = true
+			for j := max(0, i-h.ContextLines); j <= min(len(lines)-1, i+h.ContextLines); j++ {
+				selected[j] = true
+			}
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	var res []string
+	prev := -1
+	for i, ok := range selected {
+		if !ok {
+			continue
+		}
+		if prev >= 0 && i != prev+1 {
+			res = append(res, "...")
+		}
+		res = append(res, lines[i])
+		prev = i
+	}
+	// the last errors are usually the ones that failed the job
+	return tail(res, h.MaxLines)
+}
+
+func tail(lines []string, n int) []string {
+	if n > 0 && len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package log_excerpt
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+var FetchJobLogTailFunc = fetchJobLogTail
+
+// ringBuffer keeps the last n lines appended to it
+type ringBuffer struct {
+	lines []string
+	next  int
+	full  bool
+}
+
+func newRingBuffer(n int) *ringBuffer {
+	return &ringBuffer{lines: make([]string, max(n, 1))}
+}
+
+func (r *ringBuffer) push(line string) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ringBuffer) slice() []string {
+	if !r.full {
+		return append([]string{}, r.lines[:r.next]...)
+	}
+	return append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+func archivedLogPath(archiveDir, hostName, jobId string) (string, bool) {
+	if archiveDir == "" {
+		return "", false
+	}
+	for _, candidate := range []string{
+		filepath.Join(archiveDir, hostName, jobId+".log"),
+		filepath.Join(archiveDir, jobId+".log"),
+	} {
+		if st, err := os.Stat(candidate); err == nil && !st.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func readArchivedTail(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	buf := newRingBuffer(n)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		buf.push(scanner.Text())
+	}
+	return buf.slice(), scanner.Err()
+}
+
+func streamTail(ctx context.Context, hostName, jobId string, n int) ([]string, error) {
+	host, ok := conf.Hosts.Hosts[hostName]
+	if !ok {
+		return nil, fmt.Errorf("host %s not found", hostName)
+	}
+	grpcConn, err := grpc_utils.NewGRPCConn(host)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := actservice.NewActServiceClient(grpcConn).JobLogStream(
+		ctx, &actservice.JobLogRequest{JobId: jobId, LastOffset: 0},
+	)
+	if err != nil {
+		return nil, err
+	}
+	buf := newRingBuffer(n)
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return buf.slice(), nil
+		} else if err != nil {
+			// a running job never reaches EOF; what we have so far is still the tail
+			if ctx.Err() != nil {
+				slog.DebugContext(ctx, "log tail cut by deadline", "error", err)
+				return buf.slice(), nil
+			}
+			return nil, err
+		}
+		buf.push(msg.Line)
+	}
+}
+
+func fetchJobLogTail(ctx context.Context, hostName, jobId string, n int) ([]string, error) {
+	if path, ok := archivedLogPath(conf.LogExcerptEnv.ArchiveDir, hostName, jobId); ok {
+		slog.DebugContext(ctx, "reading log tail from archive", "path", path)
+		return readArchivedTail(path, n)
+	}
+	return streamTail(ctx, hostName, jobId, n)
+}
+
+// ForReport returns the log excerpt to embed into the report of a job, or nil when none is due.
+// Jobs that aren't known to have failed only get one when the log shows a failure signal.
+func ForReport(ctx context.Context, hostName, jobId string, failed bool) (*Excerpt, error) {
+	env := conf.LogExcerptEnv
+	if !env.Enabled {
+		return nil, nil
+	}
+	heuristics, err := NewHeuristics(env)
+	if err != nil {
+		return nil, err
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, env.FetchTimeout)
+	defer cancel()
+	lines, err := FetchJobLogTailFunc(fetchCtx, hostName, jobId, env.ScanLines)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	excerpt := heuristics.Extract(lines)
+	if !excerpt.Failed && !failed {
+		return nil, nil
+	}
+	return excerpt, nil
+}
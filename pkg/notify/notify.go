@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/logging"
+	"ActQABot/templates"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+var SendFunc = sendWebhook
+
+// Event is a job lifecycle change worth a chat message
+type Event struct {
+	Kind        string // templates.NotificationJobStarted or templates.NotificationJobFinished
+	Owner       string
+	Repo        string
+	IssueNumber int
+	Sender      string
+	Host        string
+	JobId       string
+	Status      string
+	Command     string
+	ReportText  string
+}
+
+func (e *Event) repository() string {
+	return e.Owner + "/" + e.Repo
+}
+
+// SlackMessage is the incoming webhook payload understood by Slack and Mattermost
+type SlackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+	IconURL  string `json:"icon_url,omitempty"`
+}
+
+func matches(filter []string, value string) bool {
+	return len(filter) == 0 || slices.Contains(filter, value)
+}
+
+// sinks returns the names of the sinks routed for the event, each one once
+func sinks(notifications *conf.NotificationsEnvironment, event *Event) []string {
+	names := make([]string, 0)
+	for _, route := range notifications.Routes {
+		if !matches(route.Events, event.Kind) ||
+			!matches(route.Repositories, event.repository()) ||
+			!matches(route.Hosts, event.Host) ||
+			!matches(route.Users, event.Sender) {
+			continue
+		}
+		for _, sink := range route.Sinks {
+			if !slices.Contains(names, sink) {
+				names = append(names, sink)
+			}
+		}
+	}
+	return names
+}
+
+// Notify renders the event and posts it to every routed sink in the background.
+// Chat is best effort: failures are logged and never affect the job.
+func Notify(event Event) {
+	notifications := conf.Notifications
+	if notifications == nil {
+		return
+	}
+	names := sinks(notifications, &event)
+	if len(names) == 0 {
+		return
+	}
+	tmplCtx := templates.NewNotificationContext(event.Kind)
+	tmplCtx.Repository = event.repository()
+	tmplCtx.IssueNumber = event.IssueNumber
+	tmplCtx.Sender = event.Sender
+	tmplCtx.Host = event.Host
+	tmplCtx.JobId = event.JobId
+	tmplCtx.Status = event.Status
+	tmplCtx.Command = event.Command
+	tmplCtx.ReportText = event.ReportText
+	txt, err := tmplCtx.GenText()
+	if err != nil {
+		slog.Error("notify: failed to render notification", "kind", event.Kind, logging.KeyJob, event.JobId, "error", err)
+		return
+	}
+	for _, name := range names {
+		sink := notifications.Sinks[name]
+		msg := SlackMessage{Text: txt, Channel: sink.Channel, Username: sink.Username, IconURL: sink.IconURL}
+		go func(name string) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifications.Timeout)
+			defer cancel()
+			if err := SendFunc(ctx, sink.URL, &msg); err != nil {
+				slog.Error("notify: sink failed", "sink", name, logging.KeyJob, event.JobId, "error", err)
+			}
+		}(name)
+	}
+}
+
+func sendWebhook(ctx context.Context, url string, msg *SlackMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
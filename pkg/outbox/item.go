@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"fmt"
+	"time"
+)
+
+const (
+	OutboxQueuePrefix = "/github-outbox/queue/"
+	OutboxDeadPrefix  = "/github-outbox/dead/"
+)
+
+type Kind string
+
+const (
+	KindPostComment   Kind = "post_comment"
+	KindUpdateComment Kind = "update_comment"
+)
+
+type Attempt struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// Item is a single outgoing forge write
+type Item struct {
+	Id          string    `json:"id"`
+	Kind        Kind      `json:"kind"`
+	Forge       string    `json:"forge,omitempty"`
+	Owner       string    `json:"owner"`
+	Repo        string    `json:"repo"`
+	IssueNumber int       `json:"issue_number"`
+	CommentId   *int      `json:"comment_id,omitempty"`
+	Text        string    `json:"text"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+	Attempts    []Attempt `json:"attempts"`
+	// trace context of the request or report the write belongs to
+	Trace tracing.Carrier `json:"trace,omitempty"`
+}
+
+func NewCommentItem(resp *gh_api.BotResponse) *Item {
+	item := &Item{
+		Kind:        KindPostComment,
+		Forge:       resp.Forge,
+		Owner:       resp.Owner,
+		Repo:        resp.Repo,
+		IssueNumber: resp.IssueNumber,
+		CommentId:   resp.CommentId,
+		Text:        resp.Text,
+	}
+	if resp.CommentId != nil {
+		item.Kind = KindUpdateComment
+	}
+	return item
+}
+
+func (i *Item) BotResponse() *gh_api.BotResponse {
+	return &gh_api.BotResponse{
+		Forge:       i.Forge,
+		Owner:       i.Owner,
+		Repo:        i.Repo,
+		IssueNumber: i.IssueNumber,
+		CommentId:   i.CommentId,
+		Text:        i.Text,
+	}
+}
+
+func (i *Item) forgeName() string {
+	if i.Forge == "" {
+		return forge.GitHub
+	}
+	return i.Forge
+}
+
+// ownerKey is what rate limits apply to: a GitHub installation or a GitLab token
+func (i *Item) ownerKey() string {
+	return i.forgeName() + "/" + i.Owner
+}
+
+// issueKey groups the items that must be delivered in order
+func (i *Item) issueKey() string {
+	return fmt.Sprintf("%s/%s/%s/%d", i.forgeName(), i.Owner, i.Repo, i.IssueNumber)
+}
+
+// queueKey sorts by enqueue time within an issue
+func (i *Item) queueKey() string {
+	return fmt.Sprintf("%s%s/%020d-%s", OutboxQueuePrefix, i.issueKey(), i.EnqueuedAt.UnixNano(), i.Id)
+}
+
+func (i *Item) deadKey() string {
+	return OutboxDeadPrefix + i.Id
+}
@@ -0,0 +1,289 @@
+package outbox
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/leader"
+	"ActQABot/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var DeliverFunc = deliver
+
+var NotFoundError = errors.New("outbox item not found")
+
+// wake shortens the poll interval after a local Enqueue
+var wake = make(chan struct{}, 1)
+
+func Enqueue(ctx context.Context, item *Item) error {
+	item.Id = uuid.NewString()
+	item.EnqueuedAt = time.Now()
+	item.NextAttempt = item.EnqueuedAt
+	item.Attempts = nil
+	item.Trace = tracing.Inject(ctx)
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err = storage.Default().Put(ctx, item.queueKey(), data, storage.NoLease); err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "outbox: enqueued", "kind", item.Kind, "item", item.Id, "target", item.issueKey())
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func deliver(ctx context.Context, item *Item) error {
+	target, err := forge.Get(item.Forge)
+	if err != nil {
+		return err
+	}
+	switch item.Kind {
+	case KindPostComment:
+		return target.PostReply(ctx, item.BotResponse())
+	case KindUpdateComment:
+		return target.UpdateReply(ctx, item.BotResponse())
+	default:
+		return fmt.Errorf("unknown outbox item kind %s", item.Kind)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	env := conf.OutboxEnv
+	delay := env.BaseBackoff
+	for i := 1; i < attempts && delay < env.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, env.MaxBackoff)
+}
+
+// isPermanent tells the forge answers a retry can't change: a bad request, missing permissions, a deleted
+// issue or a rejected body. Rate limits, timeouts, conflicts and expired tokens are retried.
+func isPermanent(err error) bool {
+	var apiErr *forge.APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter > 0 {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
+
+type worker struct {
+	// installations are rate limited per owner; a limited owner is paused as a whole.
+	// Keyed by Item.ownerKey
+	pausedUntil map[string]time.Time
+}
+
+// Worker delivers queued items until ctx is done, deliveries in flight are completed first.
+// Items of the same issue are delivered one by one in enqueue order.
+func Worker(ctx context.Context) {
+	slog.Debug("outbox worker started...")
+	defer slog.Debug("outbox worker finished...")
+	w := &worker{pausedUntil: make(map[string]time.Time)}
+	ticker := time.NewTicker(conf.OutboxEnv.PollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		w.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *worker) deliverDue(ctx context.Context) {
+	kvs, _, err := storage.Default().List(ctx, OutboxQueuePrefix)
+	if err != nil {
+		slog.ErrorContext(ctx, "outbox: list failed", "error", err)
+		return
+	}
+	// head of every issue queue
+	heads := make(map[string]storage.KeyValue)
+	for _, kv := range kvs {
+		issue := kv.Key[:strings.LastIndex(kv.Key, "/")]
+		if head, ok := heads[issue]; !ok || kv.Key < head.Key {
+			heads[issue] = kv
+		}
+	}
+	if len(heads) == 0 {
+		return
+	}
+	// a replica that lost the election must not post anymore, even before its context is cancelled
+	if err = leader.Fence(ctx); err != nil {
+		slog.ErrorContext(ctx, "outbox: not delivering", "error", err)
+		return
+	}
+	now := time.Now()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, head := range heads {
+		var item Item
+		if err := json.Unmarshal(head.Value, &item); err != nil {
+			// it can't be delivered nor replayed, the log keeps what it was
+			slog.ErrorContext(
+				ctx, "outbox: dropping malformed item", "key", head.Key, "value", string(head.Value), "error", err,
+			)
+			if err = storage.Default().Delete(ctx, head.Key); err != nil {
+				slog.ErrorContext(ctx, "outbox: failed to drop malformed item", "key", head.Key, "error", err)
+			}
+			continue
+		}
+		mu.Lock()
+		paused := w.pausedUntil[item.ownerKey()].After(now)
+		mu.Unlock()
+		if paused || item.NextAttempt.After(now) {
+			continue
+		}
+		wg.Add(1)
+		go func(key string, item *Item) {
+			defer wg.Done()
+			pause := w.attempt(context.WithoutCancel(ctx), key, item)
+			if pause > 0 {
+				mu.Lock()
+				w.pausedUntil[item.ownerKey()] = time.Now().Add(pause)
+				mu.Unlock()
+			}
+		}(head.Key, &item)
+	}
+	wg.Wait()
+}
+
+// attempt delivers a single item and returns how long its owner should be paused
+func (w *worker) attempt(ctx context.Context, key string, item *Item) time.Duration {
+	deliverCtx, span := tracing.Start(
+		tracing.Extract(ctx, item.Trace), "outbox.deliver", trace.WithAttributes(
+			attribute.String("outbox.kind", string(item.Kind)),
+			attribute.String("outbox.issue", item.issueKey()),
+			attribute.Int("outbox.attempt", len(item.Attempts)+1),
+		),
+	)
+	logger := slog.With("kind", item.Kind, "item", item.Id, "target", item.issueKey())
+	err := DeliverFunc(deliverCtx, item)
+	tracing.End(span, err)
+	if err == nil {
+		logger.DebugContext(deliverCtx, "outbox: delivered")
+		if err = storage.Default().Delete(ctx, key); err != nil {
+			logger.ErrorContext(deliverCtx, "outbox: failed to delete delivered item", "error", err)
+		}
+		return 0
+	}
+	logger.ErrorContext(deliverCtx, "outbox: delivery failed", "attempt", len(item.Attempts)+1, "error", err)
+	item.Attempts = append(item.Attempts, Attempt{At: time.Now(), Error: err.Error()})
+
+	var pause time.Duration
+	var apiErr *forge.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		pause = apiErr.RetryAfter
+	}
+	permanent := isPermanent(err)
+	if permanent || len(item.Attempts) >= conf.OutboxEnv.MaxAttempts {
+		data, err := json.Marshal(item)
+		if err == nil {
+			err = storage.Default().Move(ctx, key, item.deadKey(), data)
+		}
+		switch {
+		case err != nil:
+			logger.ErrorContext(deliverCtx, "outbox: failed to dead-letter", "error", err)
+		case permanent:
+			logger.ErrorContext(deliverCtx, "outbox: rejected by the forge, moved to dead letters")
+		default:
+			logger.ErrorContext(deliverCtx, "outbox: retries exhausted, moved to dead letters")
+		}
+		return pause
+	}
+	item.NextAttempt = time.Now().Add(max(pause, backoff(len(item.Attempts))))
+	data, err := json.Marshal(item)
+	if err == nil {
+		err = storage.Default().Put(ctx, key, data, storage.NoLease)
+	}
+	if err != nil {
+		logger.ErrorContext(deliverCtx, "outbox: failed to reschedule", "error", err)
+	}
+	return pause
+}
+
+// Dead letters
+
+func ListDead(ctx context.Context) ([]*Item, error) {
+	kvs, _, err := storage.Default().List(ctx, OutboxDeadPrefix)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Item, 0, len(kvs))
+	for _, kv := range kvs {
+		var item Item
+		if err := json.Unmarshal(kv.Value, &item); err != nil {
+			slog.ErrorContext(ctx, "outbox: malformed dead letter", "key", kv.Key, "error", err)
+			continue
+		}
+		items = append(items, &item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].EnqueuedAt.Before(items[j].EnqueuedAt) })
+	return items, nil
+}
+
+func GetDead(ctx context.Context, id string) (*Item, error) {
+	kv, err := storage.Default().Get(ctx, OutboxDeadPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, NotFoundError
+	}
+	var item Item
+	if err = json.Unmarshal(kv.Value, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ReplayDead puts a dead letter back with a fresh retry budget. It keeps its enqueue time, so it is delivered
+// before the items of its issue enqueued after it that are still queued.
+func ReplayDead(ctx context.Context, id string) (*Item, error) {
+	item, err := GetDead(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	item.NextAttempt = time.Now()
+	item.Attempts = nil
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	if err = storage.Default().Move(ctx, item.deadKey(), item.queueKey(), data); err != nil {
+		return nil, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return item, nil
+}
+
+func PurgeDead(ctx context.Context, id string) error {
+	if _, err := GetDead(ctx, id); err != nil {
+		return err
+	}
+	return storage.Default().Delete(ctx, OutboxDeadPrefix+id)
+}
@@ -0,0 +1,199 @@
+package redact
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/secrets"
+	"context"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Sources of the masked text, the metric label
+const (
+	SourceLogStream = "log_stream"
+	SourceReport    = "report"
+)
+
+// Kinds of redaction, the metric label
+const (
+	KindSecret  = "secret"
+	KindPattern = "pattern"
+	KindEntropy = "entropy"
+)
+
+// secret values shorter than this would mask unrelated text, act leaves them alone as well
+const minSecretLength = 4
+
+// token is the unit of the entropy detection: base64 and hex alphabets, = only as padding so KEY=value splits
+var token = regexp.MustCompile(`[A-Za-z0-9+_-]+=*`)
+
+type rules struct {
+	env      conf.RedactEnvironment
+	patterns []*regexp.Regexp
+}
+
+var current = struct {
+	sync.RWMutex
+	rules *rules
+}{}
+
+// Init compiles the redaction patterns, only the job secrets are masked until it succeeds
+func Init(redactEnv conf.RedactEnvironment) error {
+	r := &rules{env: redactEnv}
+	if r.env.Mask == "" {
+		r.env.Mask = "***"
+	}
+	for _, p := range redactEnv.Patterns {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	current.Lock()
+	defer current.Unlock()
+	current.rules = r
+	return nil
+}
+
+func currentRules() *rules {
+	current.RLock()
+	defer current.RUnlock()
+	if current.rules == nil {
+		return &rules{env: conf.RedactEnvironment{Mask: "***"}}
+	}
+	return current.rules
+}
+
+// Redactor masks the secrets of a job and the sensitive patterns in the text it is given
+type Redactor struct {
+	source string
+	rules  *rules
+	// longest first, so a secret containing another one is masked whole
+	values []string
+}
+
+// New returns the redactor of text from source, masking values on top of the configured rules
+func New(source string, values []string) *Redactor {
+	r := &Redactor{source: source, rules: currentRules()}
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			r.values = append(r.values, value)
+		}
+	}
+	slices.SortFunc(r.values, func(a, b string) int { return len(b) - len(a) })
+	return r
+}
+
+// ForJob returns the redactor of a job, masking the secrets it was given. The configured rules still apply
+// when the secrets can't be read.
+func ForJob(ctx context.Context, source, forgeName, repository, host string) *Redactor {
+	values, err := secrets.ForJob(ctx, forgeName, repository, host)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to load the job secrets to mask them", "error", err)
+	}
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return New(source, list)
+}
+
+// Text masks the secret values, then the pattern matches and the high entropy tokens
+func (r *Redactor) Text(text string) string {
+	if text == "" {
+		return text
+	}
+	mask := r.rules.env.Mask
+	for _, value := range r.values {
+		if n := strings.Count(text, value); n > 0 {
+			text = strings.ReplaceAll(text, value, mask)
+			r.count(KindSecret, n)
+		}
+	}
+	if !r.rules.env.Enabled {
+		return text
+	}
+	for _, re := range r.rules.patterns {
+		text = r.maskPattern(re, text)
+	}
+	if r.rules.env.EntropyThreshold > 0 {
+		n := 0
+		text = token.ReplaceAllStringFunc(
+			text, func(candidate string) string {
+				if !r.highEntropy(candidate) {
+					return candidate
+				}
+				n++
+				return mask
+			},
+		)
+		r.count(KindEntropy, n)
+	}
+	return text
+}
+
+// maskPattern masks the first group of the matches, only the token after "Bearer" is sensitive for instance
+func (r *Redactor) maskPattern(re *regexp.Regexp, text string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var masked strings.Builder
+	last := 0
+	for _, loc := range matches {
+		start, end := loc[0], loc[1]
+		if len(loc) > 2 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		masked.WriteString(text[last:start])
+		masked.WriteString(r.rules.env.Mask)
+		last = end
+	}
+	masked.WriteString(text[last:])
+	r.count(KindPattern, len(matches))
+	return masked.String()
+}
+
+func (r *Redactor) count(kind string, n int) {
+	if n > 0 {
+		metrics.Redactions.WithLabelValues(r.source, kind).Add(float64(n))
+	}
+}
+
+// highEntropy tells random looking tokens, words and hex digests have too few distinct characters
+func (r *Redactor) highEntropy(candidate string) bool {
+	if len(candidate) < r.rules.env.EntropyMinLength || candidate == r.rules.env.Mask {
+		return false
+	}
+	hasLetter := strings.IndexFunc(candidate, unicode.IsLetter) >= 0
+	hasDigit := strings.IndexFunc(candidate, unicode.IsDigit) >= 0
+	if !hasLetter || !hasDigit {
+		return false
+	}
+	return entropy(candidate) >= r.rules.env.EntropyThreshold
+}
+
+// entropy is the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	var bits float64
+	length := float64(len(s))
+	for _, n := range counts {
+		p := float64(n) / length
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/hosts"
+	"ActQABot/pkg/leader"
+	"ActQABot/pkg/storage"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ScheduleLastPrefix keeps the last time each schedule was evaluated, a new leader resumes from it
+const ScheduleLastPrefix = "/schedule-last/"
+
+// pollInterval bounds the sleep between two evaluations, leadership may move in between
+const pollInterval = time.Minute
+
+var StartFunc = issues.StartScheduled
+
+type entry struct {
+	name     string
+	schedule conf.Schedule
+	cron     *Cron
+	catchUp  string
+}
+
+type Scheduler struct {
+	entries    []*entry
+	location   *time.Location
+	maxCatchUp int
+	grace      time.Duration
+}
+
+// New parses the schedules, the hosts they refer to must exist
+func New(schedulesEnv *conf.SchedulesEnvironment, hostsEnv *conf.HostsEnvironment) (*Scheduler, error) {
+	location, err := time.LoadLocation(schedulesEnv.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scheduler{location: location, maxCatchUp: schedulesEnv.MaxCatchUp, grace: schedulesEnv.Grace}
+	for _, name := range slices.Sorted(maps.Keys(schedulesEnv.Schedules)) {
+		schedule := schedulesEnv.Schedules[name]
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", name, err)
+		}
+		if _, ok := hostsEnv.Hosts[schedule.Host]; schedule.Host != "" && !ok {
+			return nil, fmt.Errorf("schedule %s: unknown host %s", name, schedule.Host)
+		}
+		if schedule.HostLabel != "" && !hasLabel(hostsEnv, schedule.HostLabel) {
+			return nil, fmt.Errorf("schedule %s: no host labeled %s", name, schedule.HostLabel)
+		}
+		catchUp := schedule.CatchUp
+		if catchUp == "" {
+			catchUp = schedulesEnv.CatchUp
+		}
+		s.entries = append(s.entries, &entry{name: name, schedule: schedule, cron: cron, catchUp: catchUp})
+	}
+	return s, nil
+}
+
+func hasLabel(hostsEnv *conf.HostsEnvironment, label string) bool {
+	for _, host := range hostsEnv.Hosts {
+		if slices.Contains(host.Labels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run fires the schedules until ctx is done, it belongs on the leader only
+func (s *Scheduler) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "scheduler started", "schedules", len(s.entries), "timezone", s.location.String())
+	for {
+		s.Tick(ctx, time.Now())
+		wait := pollInterval
+		now := time.Now().In(s.location)
+		for _, e := range s.entries {
+			if next := e.cron.Next(now); !next.IsZero() && next.Sub(now) < wait {
+				wait = next.Sub(now)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Tick fires every run due since the previous evaluation, according to the catch-up policy
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) {
+	now = now.In(s.location)
+	for _, e := range s.entries {
+		if ctx.Err() != nil {
+			return
+		}
+		logger := slog.With("schedule", e.name)
+		last, err := s.last(ctx, e.name)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to read the last evaluation", "error", err)
+			continue
+		}
+		// a new schedule starts from now, there is nothing to catch up
+		if last.IsZero() {
+			if err = s.setLast(ctx, e.name, now); err != nil {
+				logger.ErrorContext(ctx, "failed to record the evaluation", "error", err)
+			}
+			continue
+		}
+		due := s.due(ctx, logger, e, last, now)
+		if len(due) == 0 {
+			continue
+		}
+		// left to the new leader, it catches up from the last evaluation
+		if err = leader.Fence(ctx); err != nil {
+			logger.ErrorContext(ctx, "not firing the due runs", "error", err)
+			return
+		}
+		// recorded first: a run is rather lost than fired twice by a crashed leader and its successor
+		if err = s.setLast(ctx, e.name, now); err != nil {
+			logger.ErrorContext(ctx, "failed to record the evaluation, postponing", "error", err)
+			continue
+		}
+		for _, at := range due {
+			s.fire(ctx, logger, e, at)
+		}
+	}
+}
+
+// due picks the runs of (last, now] to fire: on time ones always, missed ones as the policy says
+func (s *Scheduler) due(ctx context.Context, logger *slog.Logger, e *entry, last, now time.Time) []time.Time {
+	var onTime, missed []time.Time
+	for at := e.cron.Next(last.In(s.location)); !at.IsZero() && !at.After(now); at = e.cron.Next(at) {
+		if now.Sub(at) <= s.grace {
+			onTime = append(onTime, at)
+		} else {
+			missed = append(missed, at)
+		}
+	}
+	if len(missed) > 0 {
+		logger.WarnContext(ctx, "missed scheduled runs", "missed", len(missed), "catch_up", e.catchUp)
+	}
+	var caughtUp []time.Time
+	switch {
+	case len(missed) == 0 || e.catchUp == conf.CatchUpSkip:
+	case e.catchUp == conf.CatchUpLatest && len(onTime) == 0:
+		caughtUp = missed[len(missed)-1:]
+	case e.catchUp == conf.CatchUpAll:
+		caughtUp = missed[max(len(missed)-s.maxCatchUp, 0):]
+	}
+	metrics.ScheduledRunsSkipped.WithLabelValues(e.name).Add(float64(len(missed) - len(caughtUp)))
+	return append(caughtUp, onTime...)
+}
+
+func (s *Scheduler) fire(ctx context.Context, logger *slog.Logger, e *entry, at time.Time) {
+	var err error
+	defer func() {
+		metrics.ScheduledRuns.WithLabelValues(e.name, metrics.Outcome(err)).Inc()
+	}()
+	host := e.schedule.Host
+	if e.schedule.HostLabel != "" {
+		if host, err = hosts.HostAvbl.PickByLabel(e.schedule.HostLabel); err != nil {
+			logger.ErrorContext(ctx, "no host for the scheduled run", "at", at, "error", err)
+			return
+		}
+	}
+	var extraFlags []string
+	for _, key := range slices.Sorted(maps.Keys(e.schedule.Env)) {
+		extraFlags = append(extraFlags, "-e", key+"="+e.schedule.Env[key])
+	}
+	jobId, err := StartFunc(
+		ctx, issues.ScheduledStart{
+			Schedule:      e.name,
+			Forge:         e.schedule.Forge,
+			Repository:    e.schedule.Repository,
+			Ref:           e.schedule.Ref,
+			Workflow:      e.schedule.Workflow,
+			Host:          host,
+			ExtraFlags:    extraFlags,
+			Inputs:        e.schedule.Inputs,
+			TrackingIssue: e.schedule.TrackingIssue,
+			Timeout:       e.schedule.Timeout,
+		},
+	)
+	if err != nil {
+		logger.ErrorContext(ctx, "scheduled run failed", "at", at, logging.KeyHost, host, "error", err)
+		return
+	}
+	logger.InfoContext(ctx, "scheduled run started", "at", at, logging.KeyHost, host, logging.KeyJob, jobId)
+}
+
+func (s *Scheduler) last(ctx context.Context, name string) (time.Time, error) {
+	kv, err := storage.Default().Get(ctx, ScheduleLastPrefix+name)
+	if err != nil || kv == nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, string(kv.Value))
+}
+
+func (s *Scheduler) setLast(ctx context.Context, name string, at time.Time) error {
+	return storage.Default().Put(ctx, ScheduleLastPrefix+name, []byte(at.Format(time.RFC3339Nano)), storage.NoLease)
+}
@@ -0,0 +1,313 @@
+package secrets
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/storage"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretsPrefix keys the sealed secrets by forge, repository, host scope and name
+const SecretsPrefix = "/secrets/"
+
+// allHosts is the host scope of secrets given to jobs on any host
+const allHosts = "*"
+
+var (
+	NotFoundError = errors.New("secret not found")
+	DisabledError = errors.New("secret store is disabled, SECRETS_KEY is not set")
+)
+
+// InvalidError rejects a secret the store does not accept
+type InvalidError struct {
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return e.Reason
+}
+
+// act secret names follow the GitHub rules
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var sealer = struct {
+	sync.RWMutex
+	aead cipher.AEAD
+}{}
+
+// Init loads the server key, the store stays disabled when none is configured
+func Init(secretsEnv conf.SecretsEnvironment) error {
+	encoded := secretsEnv.Key
+	if encoded == "" && secretsEnv.KeyFile != "" {
+		data, err := os.ReadFile(secretsEnv.KeyFile)
+		if err != nil {
+			return fmt.Errorf("secrets key file: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	var aead cipher.AEAD
+	if encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("secrets key is not base64: %w", err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("secrets key must be 32 bytes, got %d", len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+	sealer.Lock()
+	defer sealer.Unlock()
+	sealer.aead = aead
+	return nil
+}
+
+// Enabled tells whether a server key was loaded
+func Enabled() bool {
+	sealer.RLock()
+	defer sealer.RUnlock()
+	return sealer.aead != nil
+}
+
+func currentAEAD() (cipher.AEAD, error) {
+	sealer.RLock()
+	defer sealer.RUnlock()
+	if sealer.aead == nil {
+		return nil, DisabledError
+	}
+	return sealer.aead, nil
+}
+
+// Scope selects the jobs a secret is given to, an empty Host stands for all the hosts
+type Scope struct {
+	Forge      string `json:"forge,omitempty" example:"github"`
+	Repository string `json:"repository" example:"owner/repo"`
+	Host       string `json:"host,omitempty" example:"h200"`
+}
+
+func (s Scope) normalized() (Scope, error) {
+	if s.Forge == "" {
+		s.Forge = forge.GitHub
+	}
+	if s.Forge != forge.GitHub && s.Forge != forge.GitLab {
+		return s, &InvalidError{Reason: fmt.Sprintf("unknown forge %s", s.Forge)}
+	}
+	if strings.Count(s.Repository, "/") < 1 || strings.HasPrefix(s.Repository, "/") || strings.HasSuffix(s.Repository, "/") {
+		return s, &InvalidError{Reason: "repository must be owner/repo"}
+	}
+	if strings.Contains(s.Host, "/") || s.Host == allHosts {
+		return s, &InvalidError{Reason: fmt.Sprintf("invalid host %s", s.Host)}
+	}
+	return s, nil
+}
+
+func (s Scope) repositoryPrefix() string {
+	return SecretsPrefix + s.Forge + "/" + url.PathEscape(s.Repository) + "/"
+}
+
+func (s Scope) key(name string) string {
+	host := s.Host
+	if host == "" {
+		host = allHosts
+	}
+	return s.repositoryPrefix() + host + "/" + name
+}
+
+// Secret is what the store tells about a secret, the value never leaves it but through ForJob
+type Secret struct {
+	Scope
+	Name      string    `json:"name" example:"HF_TOKEN"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// sealedSecret is the stored form, the key is authenticated along the value so a sealed value can't be moved
+// to another scope
+type sealedSecret struct {
+	Secret
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (s *sealedSecret) open(aead cipher.AEAD, key string) (string, error) {
+	value, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt secret %s, was the server key changed?", s.Name)
+	}
+	return string(value), nil
+}
+
+func checkName(name string) error {
+	switch {
+	case !namePattern.MatchString(name):
+		return &InvalidError{Reason: fmt.Sprintf("invalid secret name %s, use letters, digits and _", name)}
+	case strings.HasPrefix(strings.ToUpper(name), "GITHUB_"):
+		return &InvalidError{Reason: "secret names must not start with GITHUB_"}
+	}
+	return nil
+}
+
+// Put seals and stores the value, replacing the secret of the same name and scope
+func Put(ctx context.Context, scope Scope, name, value string) (*Secret, error) {
+	aead, err := currentAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if scope, err = scope.normalized(); err != nil {
+		return nil, err
+	}
+	if err = checkName(name); err != nil {
+		return nil, err
+	}
+	// a typo would leave the secret unused silently
+	if scope.Host != "" && conf.Hosts != nil {
+		if _, ok := conf.Hosts.Hosts[scope.Host]; !ok {
+			return nil, &InvalidError{Reason: fmt.Sprintf("unknown host %s", scope.Host)}
+		}
+	}
+	if value == "" {
+		return nil, &InvalidError{Reason: "secret value is empty"}
+	}
+	key := scope.key(name)
+	sealed := sealedSecret{
+		Secret: Secret{Scope: scope, Name: name, UpdatedAt: time.Now()},
+		Nonce:  make([]byte, aead.NonceSize()),
+	}
+	if _, err = rand.Read(sealed.Nonce); err != nil {
+		return nil, err
+	}
+	sealed.Ciphertext = aead.Seal(nil, sealed.Nonce, []byte(value), []byte(key))
+	data, err := json.Marshal(&sealed)
+	if err != nil {
+		return nil, err
+	}
+	if err = storage.Default().Put(ctx, key, data, storage.NoLease); err != nil {
+		return nil, err
+	}
+	return &sealed.Secret, nil
+}
+
+// Delete removes the secret of the scope, the all hosts one when scope.Host is empty
+func Delete(ctx context.Context, scope Scope, name string) error {
+	scope, err := scope.normalized()
+	if err != nil {
+		return err
+	}
+	key := scope.key(name)
+	kv, err := storage.Default().Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if kv == nil {
+		return NotFoundError
+	}
+	return storage.Default().Delete(ctx, key)
+}
+
+type storedSecret struct {
+	key    string
+	sealed sealedSecret
+}
+
+func list(ctx context.Context, prefix string) ([]storedSecret, error) {
+	kvs, _, err := storage.Default().List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]storedSecret, 0, len(kvs))
+	for _, kv := range kvs {
+		var s sealedSecret
+		if err = json.Unmarshal(kv.Value, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", kv.Key, err)
+		}
+		sealed = append(sealed, storedSecret{key: kv.Key, sealed: s})
+	}
+	return sealed, nil
+}
+
+// List returns the secrets matching the filter, without their values; empty filter fields match everything
+func List(ctx context.Context, filter Scope) ([]Secret, error) {
+	prefix := SecretsPrefix
+	if filter.Repository != "" {
+		if filter.Forge == "" {
+			filter.Forge = forge.GitHub
+		}
+		prefix = filter.repositoryPrefix()
+	}
+	stored, err := list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Secret, 0, len(stored))
+	for _, s := range stored {
+		if (filter.Forge != "" && s.sealed.Forge != filter.Forge) || (filter.Host != "" && s.sealed.Host != filter.Host) {
+			continue
+		}
+		result = append(result, s.sealed.Secret)
+	}
+	return result, nil
+}
+
+// ForJob returns the secret values given to a job of the repository on the host: the secrets of all the hosts,
+// overridden by the ones of the host. Nothing is returned while the store is disabled.
+func ForJob(ctx context.Context, forgeName, repository, host string) (map[string]string, error) {
+	aead, err := currentAEAD()
+	if errors.Is(err, DisabledError) {
+		return nil, nil
+	}
+	if forgeName == "" {
+		forgeName = forge.GitHub
+	}
+	stored, err := list(ctx, Scope{Forge: forgeName, Repository: repository}.repositoryPrefix())
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	// the secrets of the host override the ones of all the hosts
+	for _, scopeHost := range []string{"", host} {
+		for _, stored := range stored {
+			if stored.sealed.Host != scopeHost {
+				continue
+			}
+			if values[stored.sealed.Name], err = stored.sealed.open(aead, stored.key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// Flags turns the values into act -s flags, sorted by name. ActService takes no other way to pass them: they are
+// in the argv of act, readable in the process list of the host, and in the ActService log at -v=1 or DEBUG.
+func Flags(values map[string]string) []string {
+	var flags []string
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		flags = append(flags, "-s", name+"="+values[name])
+	}
+	return flags
+}
+
+// Names lists the secret names, sorted, to log what a job got
+func Names(values map[string]string) []string {
+	return slices.Sorted(maps.Keys(values))
+}
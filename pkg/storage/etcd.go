@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/etcd_utils"
+	"context"
+	"errors"
+	"fmt"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"time"
+)
+
+type etcdStore struct {
+	client *clientv3.Client
+}
+
+// OpenEtcd connects to the cluster from ETCD_* variables
+func OpenEtcd() (Store, error) {
+	if _, err := conf.NewEtcdConfFromEnv(); err != nil {
+		return nil, err
+	}
+	return NewEtcd(etcd_utils.EtcdStoreInstance.Client), nil
+}
+
+func NewEtcd(client *clientv3.Client) Store {
+	return &etcdStore{client: client}
+}
+
+func (s *etcdStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	kv := resp.Kvs[0]
+	return &KeyValue{Key: string(kv.Key), Value: kv.Value, ModRevision: kv.ModRevision}, nil
+}
+
+func (s *etcdStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	resp, err := s.client.Get(
+		ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	kvs := make([]KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{Key: string(kv.Key), Value: kv.Value, ModRevision: kv.ModRevision})
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+func (s *etcdStore) Count(ctx context.Context, prefix string) (int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+func (s *etcdStore) Put(ctx context.Context, key string, value []byte, lease LeaseID) error {
+	var opts []clientv3.OpOption
+	if lease != NoLease {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(lease)))
+	}
+	_, err := s.client.Put(ctx, key, string(value), opts...)
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return LeaseNotFoundError
+	}
+	return err
+}
+
+func (s *etcdStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Delete(ctx, key)
+	return err
+}
+
+func (s *etcdStore) DeleteAt(ctx context.Context, key string, modRevision int64) (bool, error) {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (s *etcdStore) Move(ctx context.Context, fromKey, toKey string, value []byte) error {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(fromKey), ">", 0)).
+		Then(clientv3.OpDelete(fromKey), clientv3.OpPut(toKey, string(value))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("move failed: %s does not exist", fromKey)
+	}
+	return nil
+}
+
+func (s *etcdStore) Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	watch := s.client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(fromRevision))
+	go func() {
+		defer close(out)
+		for wresp := range watch {
+			resp := WatchResponse{Err: wresp.Err()}
+			if wresp.CompactRevision != 0 {
+				resp.Err = fmt.Errorf("%w: compacted at %d", CompactedError, wresp.CompactRevision)
+			}
+			if wresp.Canceled && resp.Err == nil {
+				resp.Err = errors.New("watch canceled")
+			}
+			for _, ev := range wresp.Events {
+				event := Event{
+					Type:     EventPut,
+					KeyValue: KeyValue{Key: string(ev.Kv.Key), Value: ev.Kv.Value, ModRevision: ev.Kv.ModRevision},
+				}
+				if ev.Type == clientv3.EventTypeDelete {
+					event.Type = EventDelete
+				}
+				resp.Events = append(resp.Events, event)
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return
+			}
+			if resp.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (s *etcdStore) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	resp, err := s.client.Lease.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return NoLease, err
+	}
+	return LeaseID(resp.ID), nil
+}
+
+func (s *etcdStore) Revoke(ctx context.Context, lease LeaseID) error {
+	_, err := s.client.Lease.Revoke(ctx, clientv3.LeaseID(lease))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return LeaseNotFoundError
+	}
+	return err
+}
+
+func (s *etcdStore) Close() error {
+	return etcd_utils.Close()
+}
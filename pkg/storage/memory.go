@@ -0,0 +1,433 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// history kept for watches starting at a past revision
+const memoryHistorySize = 1024
+
+var memorySweepInterval = time.Second
+
+var closedError = errors.New("storage is closed")
+
+type memoryEntry struct {
+	Value       []byte  `json:"value"`
+	ModRevision int64   `json:"mod_revision"`
+	Lease       LeaseID `json:"lease,omitempty"`
+}
+
+type memorySnapshot struct {
+	Revision  int64                  `json:"revision"`
+	LastLease LeaseID                `json:"last_lease"`
+	Entries   map[string]memoryEntry `json:"entries"`
+	Leases    map[LeaseID]time.Time  `json:"leases"`
+}
+
+type memoryWatcher struct {
+	prefix  string
+	pending []WatchResponse
+	notify  chan struct{}
+}
+
+// Memory keeps the state in process, optionally persisted to a snapshot file after every change
+type Memory struct {
+	mu      sync.Mutex
+	state   memorySnapshot
+	history []Event
+	// last revision missing from history, dropped or from before the snapshot was loaded
+	compacted int64
+	watchers  map[*memoryWatcher]struct{}
+	path      string
+	closed    chan struct{}
+}
+
+// NewMemory loads the snapshot at path when it exists, path may be empty
+func NewMemory(path string) (*Memory, error) {
+	m := &Memory{
+		state: memorySnapshot{
+			Entries: make(map[string]memoryEntry),
+			Leases:  make(map[LeaseID]time.Time),
+		},
+		watchers: make(map[*memoryWatcher]struct{}),
+		path:     path,
+		closed:   make(chan struct{}),
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &m.state); err != nil {
+				return nil, fmt.Errorf("invalid storage file %s: %w", path, err)
+			}
+			if m.state.Entries == nil {
+				m.state.Entries = make(map[string]memoryEntry)
+			}
+			if m.state.Leases == nil {
+				m.state.Leases = make(map[LeaseID]time.Time)
+			}
+			m.compacted = m.state.Revision
+		}
+	}
+	go m.sweep()
+	return m, nil
+}
+
+func (m *Memory) Get(_ context.Context, key string) (*KeyValue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return nil, closedError
+	}
+	entry, ok := m.state.Entries[key]
+	if !ok {
+		return nil, nil
+	}
+	return &KeyValue{Key: key, Value: entry.Value, ModRevision: entry.ModRevision}, nil
+}
+
+func (m *Memory) List(_ context.Context, prefix string) ([]KeyValue, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return nil, 0, closedError
+	}
+	var kvs []KeyValue
+	for key, entry := range m.state.Entries {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, KeyValue{Key: key, Value: entry.Value, ModRevision: entry.ModRevision})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, m.state.Revision, nil
+}
+
+func (m *Memory) Count(_ context.Context, prefix string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return 0, closedError
+	}
+	var count int64
+	for key := range m.state.Entries {
+		if strings.HasPrefix(key, prefix) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) Put(_ context.Context, key string, value []byte, lease LeaseID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return closedError
+	}
+	if lease != NoLease {
+		if _, ok := m.state.Leases[lease]; !ok {
+			return LeaseNotFoundError
+		}
+	}
+	m.commit(m.put(m.next(), key, value, lease))
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return closedError
+	}
+	if _, ok := m.state.Entries[key]; ok {
+		m.commit(m.delete(m.next(), key))
+	}
+	return nil
+}
+
+func (m *Memory) DeleteAt(_ context.Context, key string, modRevision int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return false, closedError
+	}
+	entry, ok := m.state.Entries[key]
+	if !ok || entry.ModRevision != modRevision {
+		return false, nil
+	}
+	m.commit(m.delete(m.next(), key))
+	return true, nil
+}
+
+func (m *Memory) Move(_ context.Context, fromKey, toKey string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return closedError
+	}
+	if _, ok := m.state.Entries[fromKey]; !ok {
+		return fmt.Errorf("move failed: %s does not exist", fromKey)
+	}
+	// a single revision, like the etcd txn
+	rev := m.next()
+	m.commit(m.delete(rev, fromKey), m.put(rev, toKey, value, NoLease))
+	return nil
+}
+
+func (m *Memory) Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	w := &memoryWatcher{prefix: prefix, notify: make(chan struct{}, 1)}
+
+	m.mu.Lock()
+	if m.isClosed() {
+		m.mu.Unlock()
+		go func() {
+			defer close(out)
+			select {
+			case out <- WatchResponse{Err: closedError}:
+			case <-ctx.Done():
+			}
+		}()
+		return out
+	}
+	if fromRevision > 0 && fromRevision <= m.compacted {
+		compacted := m.compacted
+		m.mu.Unlock()
+		go func() {
+			defer close(out)
+			select {
+			case out <- WatchResponse{Err: fmt.Errorf("%w: compacted at %d", CompactedError, compacted)}:
+			case <-ctx.Done():
+			}
+		}()
+		return out
+	}
+	if fromRevision > 0 {
+		w.pending = groupByRevision(m.history, prefix, fromRevision)
+		if len(w.pending) > 0 {
+			w.notify <- struct{}{}
+		}
+	}
+	m.watchers[w] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer func() {
+			m.mu.Lock()
+			delete(m.watchers, w)
+			m.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.closed:
+				select {
+				case out <- WatchResponse{Err: closedError}:
+				case <-ctx.Done():
+				}
+				return
+			case <-w.notify:
+			}
+			m.mu.Lock()
+			pending := w.pending
+			w.pending = nil
+			m.mu.Unlock()
+			for _, resp := range pending {
+				select {
+				case out <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (m *Memory) Grant(_ context.Context, ttl time.Duration) (LeaseID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return NoLease, closedError
+	}
+	m.state.LastLease++
+	lease := m.state.LastLease
+	m.state.Leases[lease] = time.Now().Add(ttl)
+	m.commit()
+	return lease, nil
+}
+
+func (m *Memory) Revoke(_ context.Context, lease LeaseID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return closedError
+	}
+	if _, ok := m.state.Leases[lease]; !ok {
+		return LeaseNotFoundError
+	}
+	m.commit(m.revoke(lease)...)
+	return nil
+}
+
+// Close stops the lease sweeper and ends the watches
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed() {
+		return nil
+	}
+	close(m.closed)
+	return nil
+}
+
+func (m *Memory) isClosed() bool {
+	select {
+	case <-m.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// next starts a revision, the changes made by put, delete and revoke at it must be followed by commit
+// under the lock
+func (m *Memory) next() int64 {
+	m.state.Revision++
+	return m.state.Revision
+}
+
+func (m *Memory) put(rev int64, key string, value []byte, lease LeaseID) Event {
+	entry := memoryEntry{Value: value, ModRevision: rev, Lease: lease}
+	m.state.Entries[key] = entry
+	return Event{Type: EventPut, KeyValue: KeyValue{Key: key, Value: value, ModRevision: entry.ModRevision}}
+}
+
+func (m *Memory) delete(rev int64, key string) Event {
+	delete(m.state.Entries, key)
+	return Event{Type: EventDelete, KeyValue: KeyValue{Key: key, ModRevision: rev}}
+}
+
+func (m *Memory) revoke(lease LeaseID) []Event {
+	delete(m.state.Leases, lease)
+	var keys []string
+	for key, entry := range m.state.Entries {
+		if entry.Lease == lease {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	// the keys of a lease go away in a single revision, like in etcd
+	rev := m.next()
+	events := make([]Event, 0, len(keys))
+	for _, key := range keys {
+		events = append(events, m.delete(rev, key))
+	}
+	return events
+}
+
+// commit records events for the watchers and persists the snapshot
+func (m *Memory) commit(events ...Event) {
+	m.history = append(m.history, events...)
+	if overflow := len(m.history) - memoryHistorySize; overflow > 0 {
+		// a revision is kept whole or not at all
+		for overflow < len(m.history) && m.history[overflow].ModRevision == m.history[overflow-1].ModRevision {
+			overflow++
+		}
+		m.compacted = m.history[overflow-1].ModRevision
+		m.history = append([]Event(nil), m.history[overflow:]...)
+	}
+	for w := range m.watchers {
+		responses := groupByRevision(events, w.prefix, 0)
+		if len(responses) == 0 {
+			continue
+		}
+		w.pending = append(w.pending, responses...)
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+	if m.path != "" {
+		if err := m.persist(); err != nil {
+			slog.Error("failed to persist storage", "file", m.path, "error", err)
+		}
+	}
+}
+
+func (m *Memory) persist() error {
+	data, err := json.Marshal(m.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// sweep deletes the keys of expired leases
+func (m *Memory) sweep() {
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.closed:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			var events []Event
+			for lease, expires := range m.state.Leases {
+				if now.After(expires) {
+					events = append(events, m.revoke(lease)...)
+				}
+			}
+			if len(events) > 0 {
+				m.commit(events...)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// groupByRevision keeps the events under prefix from fromRevision on, one response per revision
+func groupByRevision(events []Event, prefix string, fromRevision int64) []WatchResponse {
+	var responses []WatchResponse
+	for _, event := range events {
+		if event.ModRevision < fromRevision || !strings.HasPrefix(event.Key, prefix) {
+			continue
+		}
+		last := len(responses) - 1
+		if last >= 0 && responses[last].Events[0].ModRevision == event.ModRevision {
+			responses[last].Events = append(responses[last].Events, event)
+			continue
+		}
+		responses = append(responses, WatchResponse{Events: []Event{event}})
+	}
+	return responses
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"ActQABot/conf"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Backends
+const (
+	BackendEtcd   = "etcd"
+	BackendMemory = "memory"
+)
+
+var LeaseNotFoundError = errors.New("lease not found")
+
+// CompactedError ends a watch starting at a revision the store no longer has the history of,
+// the caller must list the prefix again and watch from the revision of the list
+var CompactedError = errors.New("required revision has been compacted")
+
+// LeaseID ties keys to a TTL, they are deleted together when it expires or is revoked
+type LeaseID int64
+
+// NoLease keeps a key until it is deleted
+const NoLease LeaseID = 0
+
+type KeyValue struct {
+	Key   string
+	Value []byte
+	// revision of the last change of the key, see Store.DeleteAt
+	ModRevision int64
+}
+
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+func (t EventType) String() string {
+	if t == EventDelete {
+		return "DELETE"
+	}
+	return "PUT"
+}
+
+type Event struct {
+	Type EventType
+	KeyValue
+}
+
+// WatchResponse carries the events of a single revision; with Err set the watch is over and the channel closes
+type WatchResponse struct {
+	Events []Event
+	Err    error
+}
+
+// Store is the state shared by the replicas: job meta, the worker report queue and the outbox
+type Store interface {
+	// Get returns nil when the key doesn't exist
+	Get(ctx context.Context, key string) (*KeyValue, error)
+	// List returns the keys under prefix sorted by key, and the store revision they were read at
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+	Count(ctx context.Context, prefix string) (int64, error)
+	// Put attaches the key to lease unless it is NoLease
+	Put(ctx context.Context, key string, value []byte, lease LeaseID) error
+	Delete(ctx context.Context, key string) error
+	// DeleteAt deletes the key only if it is unchanged since modRevision
+	DeleteAt(ctx context.Context, key string, modRevision int64) (bool, error)
+	// Move atomically replaces fromKey with toKey in a single revision, it fails when fromKey doesn't exist
+	Move(ctx context.Context, fromKey, toKey string, value []byte) error
+	// Watch streams the changes under prefix starting at fromRevision until ctx is done, CompactedError
+	// when fromRevision is older than the history kept
+	Watch(ctx context.Context, prefix string, fromRevision int64) <-chan WatchResponse
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	Revoke(ctx context.Context, lease LeaseID) error
+	Close() error
+}
+
+var current = struct {
+	sync.RWMutex
+	store Store
+}{}
+
+// Open connects the configured backend and makes it the default store
+func Open(storageEnv conf.StorageEnvironment) (Store, error) {
+	var store Store
+	var err error
+	switch storageEnv.Backend {
+	case BackendEtcd, "":
+		store, err = OpenEtcd()
+	case BackendMemory:
+		store, err = NewMemory(storageEnv.File)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", storageEnv.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	SetDefault(store)
+	return store, nil
+}
+
+// Default is the store opened at startup
+func Default() Store {
+	current.RLock()
+	defer current.RUnlock()
+	if current.store == nil {
+		panic("storage is not opened")
+	}
+	return current.store
+}
+
+// SetDefault replaces the default store and returns the previous one
+func SetDefault(store Store) Store {
+	current.Lock()
+	defer current.Unlock()
+	previous := current.store
+	current.store = store
+	return previous
+}
+
+// Close closes the default store
+func Close() error {
+	current.Lock()
+	defer current.Unlock()
+	if current.store == nil {
+		return nil
+	}
+	err := current.store.Close()
+	current.store = nil
+	return err
+}
@@ -0,0 +1,232 @@
+package watchdog
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/leader"
+	"ActQABot/pkg/webhooks"
+	"ActQABot/pkg/worker_report"
+	"context"
+	"errors"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cancelTimeout bounds a CancelActJob call, an unreachable host is retried on the next tick
+const cancelTimeout = 30 * time.Second
+
+// Limit returns the maximum duration of a job on the host: its max_job_duration or the one of the hosts
+// file, lowered by the workflow limits matching the workflow path. Jobs aren't limited when it is 0.
+func Limit(hostsEnv *conf.HostsEnvironment, hostName, workflowFile string) time.Duration {
+	if hostsEnv == nil {
+		return 0
+	}
+	limit := hostsEnv.MaxJobDuration
+	if host, ok := hostsEnv.Hosts[hostName]; ok && host.MaxJobDuration > 0 {
+		limit = host.MaxJobDuration
+	}
+	for _, pattern := range slices.Sorted(maps.Keys(hostsEnv.WorkflowMaxJobDuration)) {
+		workflowLimit := hostsEnv.WorkflowMaxJobDuration[pattern]
+		if matched, _ := path.Match(pattern, workflowFile); matched && (limit == 0 || workflowLimit < limit) {
+			limit = workflowLimit
+		}
+	}
+	return limit
+}
+
+// Effective applies the duration asked for with --timeout, it can't exceed the limit.
+// capped tells that the requested duration was lowered to the limit.
+func Effective(limit, requested time.Duration) (effective time.Duration, capped bool) {
+	switch {
+	case requested <= 0:
+		return limit, false
+	case limit > 0 && requested > limit:
+		return limit, true
+	}
+	return requested, false
+}
+
+// Format writes 2h instead of 2h0m0s
+func Format(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Watch records the deadline of a job that just started, the leader cancels it once the deadline is past
+func Watch(ctx context.Context, jobId, hostName string, limit time.Duration) error {
+	if limit <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return worker_report.SaveJobDeadline(
+		ctx, &worker_report.JobDeadline{
+			JobId: jobId, Host: hostName, Limit: limit, StartedAt: now, Deadline: now.Add(limit),
+		},
+	)
+}
+
+// Run cancels the jobs past their deadline until ctx is done, it belongs on the leader only.
+// The deadlines are stored, a new leader or a restarted bot picks them up.
+func Run(ctx context.Context, interval time.Duration) {
+	slog.InfoContext(ctx, "job watchdog started", "interval", interval)
+	for {
+		Tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Tick cancels every job whose deadline is before now
+func Tick(ctx context.Context, now time.Time) {
+	deadlines, err := worker_report.ListJobDeadlines(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list the job deadlines", "error", err)
+		return
+	}
+	for _, deadline := range deadlines {
+		if ctx.Err() != nil {
+			return
+		}
+		if now.Before(deadline.Deadline) {
+			continue
+		}
+		expire(logging.With(ctx, logging.KeyHost, deadline.Host, logging.KeyJob, deadline.JobId), deadline)
+	}
+}
+
+func expire(ctx context.Context, deadline *worker_report.JobDeadline) {
+	if err := leader.Fence(ctx); err != nil {
+		slog.ErrorContext(ctx, "job past its deadline left to the leader", "error", err)
+		return
+	}
+	err := cancelJob(ctx, deadline)
+	switch {
+	case jobGone(err, deadline.JobId):
+		// the job ended without a final report, there is nothing left to cancel
+		slog.InfoContext(ctx, "job past its deadline has already ended", "error", err)
+		if _, err = worker_report.ClaimJobDeadline(ctx, deadline); err != nil {
+			slog.ErrorContext(ctx, "failed to drop the job deadline", "error", err)
+		}
+		return
+	case err != nil:
+		// the host couldn't be asked or failed the cancel: retried until the entry expires,
+		// JobDeadlineGrace past the deadline, unless the job reports its end meanwhile
+		metrics.JobTimeouts.WithLabelValues(deadline.Host, metrics.OutcomeError).Inc()
+		slog.ErrorContext(
+			ctx, "unable to cancel the job past its deadline, retrying", "error", err,
+			"given_up_at", deadline.Deadline.Add(worker_report.JobDeadlineGrace),
+		)
+		return
+	}
+	// the last report of the job may have been consumed meanwhile
+	claimed, err := worker_report.ClaimJobDeadline(ctx, deadline)
+	if err != nil || !claimed {
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to claim the job deadline", "error", err)
+		}
+		return
+	}
+	slog.WarnContext(
+		ctx, "job cancelled for exceeding its maximum duration",
+		"limit", deadline.Limit, "started_at", deadline.StartedAt,
+	)
+	report := worker_report.JobReport{
+		JobId:  deadline.JobId,
+		Status: worker_report.JobStatusTimeout,
+		JobReportText: fmt.Sprintf(
+			":hourglass: The job exceeded its maximum duration of %s and was cancelled.", Format(deadline.Limit),
+		),
+	}
+	if err = report.SendEvent(ctx); err != nil {
+		metrics.JobTimeouts.WithLabelValues(deadline.Host, metrics.OutcomeError).Inc()
+		slog.ErrorContext(ctx, "failed to send the timeout report, retrying", "error", err)
+		// cancelling again is harmless, the notice must not be lost
+		if err = worker_report.SaveJobDeadline(ctx, deadline); err != nil {
+			slog.ErrorContext(ctx, "failed to restore the job deadline", "error", err)
+		}
+		return
+	}
+	worker_report.PublishJobCancelled(
+		ctx, deadline.JobId, deadline.Host,
+		&webhooks.Report{Text: report.JobReportText, Status: report.Status},
+	)
+	metrics.JobTimeouts.WithLabelValues(deadline.Host, metrics.OutcomeOK).Inc()
+}
+
+func cancelJob(ctx context.Context, deadline *worker_report.JobDeadline) error {
+	hostConf, ok := conf.Hosts.Hosts[deadline.Host]
+	if !ok {
+		return fmt.Errorf("%w: host %s", unknownHostError, deadline.Host)
+	}
+	grpcConn, err := grpc_utils.NewGRPCConn(hostConf)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cancelTimeout)
+	defer cancel()
+	result, err := actservice.NewActServiceClient(grpcConn).CancelActJob(
+		tracing.OutgoingGRPC(ctx), &actservice.CancelJob{JobId: deadline.JobId},
+	)
+	if err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "job cancelled", "result", result.GetStatus())
+	return nil
+}
+
+var unknownHostError = errors.New("unknown host")
+
+// jobGone tells the errors meaning the job no longer runs: a host removed from the configuration can't be
+// asked, and an ActService forgot the job. ActService answers an unknown job with a plain error, code Unknown,
+// only its exact message tells it from the other failures.
+func jobGone(err error, jobId string) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, unknownHostError) || status.Code(err) == codes.NotFound {
+		return true
+	}
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.Unknown && st.Message() == fmt.Sprintf("CancelJob: Job %s not found", jobId)
+}
+
+// Validate checks the job duration limits of the hosts configuration
+func Validate(hostsEnv *conf.HostsEnvironment) error {
+	if hostsEnv.MaxJobDuration < 0 {
+		return errors.New("max_job_duration can't be negative")
+	}
+	for name, host := range hostsEnv.Hosts {
+		if host.MaxJobDuration < 0 {
+			return fmt.Errorf("host %s max_job_duration can't be negative", name)
+		}
+	}
+	for pattern, limit := range hostsEnv.WorkflowMaxJobDuration {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("workflow_max_job_duration %s: %w", pattern, err)
+		}
+		if limit <= 0 {
+			return fmt.Errorf("workflow_max_job_duration %s must be positive", pattern)
+		}
+	}
+	return nil
+}
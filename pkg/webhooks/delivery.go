@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"ActQABot/conf"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-QABot-Signature-256"
+	EventHeader     = "X-QABot-Event"
+	DeliveryHeader  = "X-QABot-Delivery"
+)
+
+var SendFunc = send
+
+// Delivery is a single attempt to deliver an event to an endpoint
+type Delivery struct {
+	EventId    string        `json:"event_id"`
+	EventType  string        `json:"event_type"`
+	Endpoint   string        `json:"endpoint"`
+	Attempt    int           `json:"attempt"`
+	At         time.Time     `json:"at"`
+	Duration   time.Duration `json:"duration" swaggertype:"integer"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Delivered  bool          `json:"delivered"`
+}
+
+// deliveryLog keeps the latest attempts, newest last
+var deliveryLog = struct {
+	sync.Mutex
+	entries []Delivery
+}{}
+
+func record(d Delivery) {
+	size := 500
+	if conf.Webhooks != nil && conf.Webhooks.LogSize > 0 {
+		size = conf.Webhooks.LogSize
+	}
+	deliveryLog.Lock()
+	defer deliveryLog.Unlock()
+	deliveryLog.entries = append(deliveryLog.entries, d)
+	if over := len(deliveryLog.entries) - size; over > 0 {
+		deliveryLog.entries = slices.Delete(deliveryLog.entries, 0, over)
+	}
+}
+
+// Deliveries returns the logged attempts, newest first, optionally filtered by endpoint and event id
+func Deliveries(endpoint, eventId string) []Delivery {
+	deliveryLog.Lock()
+	defer deliveryLog.Unlock()
+	result := make([]Delivery, 0)
+	for i := len(deliveryLog.entries) - 1; i >= 0; i-- {
+		d := deliveryLog.entries[i]
+		if (endpoint == "" || d.Endpoint == endpoint) && (eventId == "" || d.EventId == eventId) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// Sign returns the signature header value: "sha256=" + hex HMAC-SHA256 of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish delivers the event to every endpoint subscribed to its type in the background
+func Publish(event *Event) {
+	webhooks := conf.Webhooks
+	if webhooks == nil {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("webhooks: failed to marshal event", "event", event.Type, "error", err)
+		return
+	}
+	for name, endpoint := range webhooks.Endpoints {
+		if len(endpoint.Events) > 0 && !slices.Contains(endpoint.Events, event.Type) {
+			continue
+		}
+		go deliver(webhooks, name, endpoint, event, body)
+	}
+}
+
+func backoff(webhooks *conf.WebhooksEnvironment, attempts int) time.Duration {
+	delay := webhooks.BaseBackoff
+	for i := 1; i < attempts && delay < webhooks.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, webhooks.MaxBackoff)
+}
+
+// retryable tells transport errors, 429 and 5xx apart from answers retrying won't change
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func deliver(webhooks *conf.WebhooksEnvironment, name string, endpoint conf.WebhookEndpoint, event *Event, body []byte) {
+	logger := slog.With("event", event.Type, "event_id", event.Id, "endpoint", name)
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), webhooks.Timeout)
+		start := time.Now()
+		statusCode, err := SendFunc(ctx, endpoint, event, body)
+		cancel()
+		d := Delivery{
+			EventId:    event.Id,
+			EventType:  event.Type,
+			Endpoint:   name,
+			Attempt:    attempt,
+			At:         start,
+			Duration:   time.Since(start),
+			StatusCode: statusCode,
+			Delivered:  err == nil,
+		}
+		if err != nil {
+			d.Error = err.Error()
+		}
+		record(d)
+		if err == nil {
+			logger.Debug("webhooks: delivered", "attempt", attempt)
+			return
+		}
+		if !retryable(statusCode) || attempt >= webhooks.MaxAttempts {
+			logger.Error("webhooks: giving up", "attempt", attempt, "status", statusCode, "error", err)
+			return
+		}
+		logger.Warn("webhooks: delivery failed", "attempt", attempt, "status", statusCode, "error", err)
+		time.Sleep(backoff(webhooks, attempt))
+	}
+}
+
+func send(ctx context.Context, endpoint conf.WebhookEndpoint, event *Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.Id)
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
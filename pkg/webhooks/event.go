@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Job lifecycle event types
+const (
+	// the bot asked the host to run the job
+	EventJobScheduled = "job.scheduled"
+	// the host accepted the job: ActService gives no signal of the run actually starting
+	EventJobStarted = "job.started"
+	// every worker report, progress included
+	EventJobReport = "job.report"
+	// cancelled on request or by the watchdog past the maximum duration
+	EventJobCancelled = "job.cancelled"
+	// the worker report carrying the job status
+	EventJobFinished = "job.finished"
+)
+
+// Job identifies the job and the conversation it was requested in
+type Job struct {
+	Id          string `json:"id"`
+	Host        string `json:"host"`
+	Forge       string `json:"forge,omitempty"`
+	Owner       string `json:"owner"`
+	Repository  string `json:"repository"`
+	IssueNumber int    `json:"issue_number"`
+	Sender      string `json:"sender"`
+	Command     string `json:"command,omitempty"`
+	// job this one re-runs
+	RerunOf string `json:"rerun_of,omitempty"`
+}
+
+type Report struct {
+	Text   string `json:"text"`
+	Status string `json:"status,omitempty"`
+}
+
+// Event is the JSON body POSTed to the endpoints
+type Event struct {
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Job        Job       `json:"job"`
+	Report     *Report   `json:"report,omitempty"`
+}
+
+func NewEvent(eventType string, job Job) *Event {
+	return &Event{
+		Id:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Job:        job,
+	}
+}
@@ -0,0 +1,122 @@
+package worker_report
+
+import (
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const JobReportDeadPrefix = "/job-report-dead/"
+
+var NotFoundError = errors.New("dead-lettered job report not found")
+
+// ConflictError is returned on replay while another report of the job is queued, it would be overwritten
+var ConflictError = errors.New("a report of this job is already queued")
+
+// ConsumerStoppedError is the nack reason of reports left unprocessed at shutdown
+var ConsumerStoppedError = errors.New("report consumer stopped")
+
+// DeadReport is a worker report that exhausted its retries
+type DeadReport struct {
+	Id     string     `json:"id" example:"0d7f6c44-8a4e-4d2b-9a57-3c1f1a6b2d10"`
+	Report *JobReport `json:"report"`
+	// error of the last attempt, the whole history is in Report.Attempts
+	Reason string    `json:"reason" example:"job 5b1c3f0e does not exist"`
+	DeadAt time.Time `json:"dead_at"`
+}
+
+func (d *DeadReport) deadKey() string {
+	return JobReportDeadPrefix + d.Id
+}
+
+// deadLetter moves the queued report at key out of the queue
+func deadLetter(ctx context.Context, key string, report *JobReport, reason error) error {
+	dead := &DeadReport{Id: uuid.NewString(), Report: report, Reason: reason.Error(), DeadAt: time.Now()}
+	data, err := json.Marshal(dead)
+	if err != nil {
+		return err
+	}
+	if err = storage.Default().Move(ctx, key, dead.deadKey(), data); err != nil {
+		return err
+	}
+	metrics.JobReportDeadLettered.Inc()
+	slog.ErrorContext(
+		ctx, "job report was rejected too many times, moved to dead letters",
+		logging.KeyJob, report.JobId, "dead_letter", dead.Id, "reason", dead.Reason,
+	)
+	return nil
+}
+
+func ListDead(ctx context.Context) ([]*DeadReport, error) {
+	kvs, _, err := storage.Default().List(ctx, JobReportDeadPrefix)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*DeadReport, 0, len(kvs))
+	for _, kv := range kvs {
+		var dead DeadReport
+		if err := json.Unmarshal(kv.Value, &dead); err != nil {
+			slog.ErrorContext(ctx, "malformed dead-lettered job report", "key", kv.Key, "error", err)
+			continue
+		}
+		reports = append(reports, &dead)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].DeadAt.Before(reports[j].DeadAt) })
+	return reports, nil
+}
+
+func GetDead(ctx context.Context, id string) (*DeadReport, error) {
+	kv, err := storage.Default().Get(ctx, JobReportDeadPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, NotFoundError
+	}
+	var dead DeadReport
+	if err = json.Unmarshal(kv.Value, &dead); err != nil {
+		return nil, err
+	}
+	return &dead, nil
+}
+
+// ReplayDead puts a dead-lettered report back on the queue with a fresh retry budget
+func ReplayDead(ctx context.Context, id string) (*JobReport, error) {
+	dead, err := GetDead(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	queueKey := string(JobReportChannel) + dead.Report.JobId
+	queued, err := storage.Default().Get(ctx, queueKey)
+	if err != nil {
+		return nil, err
+	}
+	if queued != nil {
+		return nil, ConflictError
+	}
+	report := dead.Report
+	report.Retried = nil
+	report.Attempts = nil
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	if err = storage.Default().Move(ctx, dead.deadKey(), queueKey, data); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func PurgeDead(ctx context.Context, id string) error {
+	if _, err := GetDead(ctx, id); err != nil {
+		return err
+	}
+	return storage.Default().Delete(ctx, JobReportDeadPrefix+id)
+}
@@ -0,0 +1,73 @@
+package worker_report
+
+import (
+	"ActQABot/pkg/storage"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// JobDeadlinePrefix keeps the running jobs with a maximum duration, by job ID, until their last report
+const JobDeadlinePrefix = "/job-deadline/"
+
+// JobDeadline is a job the watchdog cancels once Deadline is past
+type JobDeadline struct {
+	JobId     string        `json:"job_id"`
+	Host      string        `json:"host"`
+	Limit     time.Duration `json:"limit"`
+	StartedAt time.Time     `json:"started_at"`
+	Deadline  time.Time     `json:"deadline"`
+	// mod revision of the stored entry, set by ListJobDeadlines
+	Revision int64 `json:"-"`
+}
+
+// JobDeadlineGrace is how long past its deadline the watchdog keeps trying to cancel a job: the lease of the
+// entry expires then, a job whose end was missed or whose host can't be reached isn't retried forever
+const JobDeadlineGrace = time.Hour
+
+// SaveJobDeadline starts watching the job. The lease lives in the store, the deadline outlives restarts.
+func SaveJobDeadline(ctx context.Context, deadline *JobDeadline) error {
+	data, err := json.Marshal(deadline)
+	if err != nil {
+		return err
+	}
+	lease, err := storage.Default().Grant(ctx, max(time.Until(deadline.Deadline)+JobDeadlineGrace, time.Second))
+	if err != nil {
+		return err
+	}
+	if err = storage.Default().Put(ctx, JobDeadlinePrefix+deadline.JobId, data, lease); err != nil {
+		_ = storage.Default().Revoke(ctx, lease)
+		return err
+	}
+	return nil
+}
+
+// DeleteJobDeadline stops watching the job, it ran to its end or was cancelled
+func DeleteJobDeadline(ctx context.Context, jobId string) error {
+	return storage.Default().Delete(ctx, JobDeadlinePrefix+jobId)
+}
+
+// ClaimJobDeadline deletes the deadline unless it changed since it was listed, only one caller wins
+func ClaimJobDeadline(ctx context.Context, deadline *JobDeadline) (bool, error) {
+	return storage.Default().DeleteAt(ctx, JobDeadlinePrefix+deadline.JobId, deadline.Revision)
+}
+
+// ListJobDeadlines returns the watched jobs, entries that can't be read are skipped
+func ListJobDeadlines(ctx context.Context) ([]*JobDeadline, error) {
+	kvs, _, err := storage.Default().List(ctx, JobDeadlinePrefix)
+	if err != nil {
+		return nil, err
+	}
+	deadlines := make([]*JobDeadline, 0, len(kvs))
+	for _, kv := range kvs {
+		var deadline JobDeadline
+		if err = json.Unmarshal(kv.Value, &deadline); err != nil {
+			slog.ErrorContext(ctx, "failed to unmarshal job deadline", "key", kv.Key, "error", err)
+			continue
+		}
+		deadline.Revision = kv.ModRevision
+		deadlines = append(deadlines, &deadline)
+	}
+	return deadlines, nil
+}
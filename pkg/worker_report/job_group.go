@@ -0,0 +1,263 @@
+package worker_report
+
+import (
+	"ActQABot/internal/logging"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/log_excerpt"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/redact"
+	"ActQABot/pkg/storage"
+	"ActQABot/templates"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// JobGroupPrefix holds the matrix groups: the member list, a result per reported job and
+// an open marker deleted by whoever posts the summary
+const JobGroupPrefix = "/job-group/"
+
+// JobGroup is the set of jobs a single /wf_start --matrix expanded into
+type JobGroup struct {
+	Id        string     `json:"id"`
+	Jobs      []GroupJob `json:"jobs"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type GroupJob struct {
+	// empty when scheduling failed
+	JobId string `json:"job_id,omitempty"`
+	Host  string `json:"host"`
+	// matrix values of the job, AXIS=value
+	Axes  []string `json:"axes"`
+	Error string   `json:"error,omitempty"`
+}
+
+// GroupJobResult aggregates the reports of a group member
+type GroupJobResult struct {
+	Status string `json:"status,omitempty"`
+	// in arrival order, a retried report replaces its previous attempt
+	Reports        []GroupJobReport `json:"reports"`
+	LogExcerpt     string           `json:"log_excerpt,omitempty"`
+	LogExcerptKind string           `json:"log_excerpt_kind,omitempty"`
+	ReportedAt     time.Time        `json:"reported_at"`
+}
+
+type GroupJobReport struct {
+	Id   string `json:"id,omitempty"`
+	Text string `json:"text"`
+}
+
+// ReportText joins the reports of the member
+func (r *GroupJobResult) ReportText() string {
+	texts := make([]string, 0, len(r.Reports))
+	for _, report := range r.Reports {
+		texts = append(texts, report.Text)
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// addReport records the report of the member, once however many times it is retried
+func (r *GroupJobResult) addReport(report *JobReport) {
+	if report.Status != "" {
+		r.Status = report.Status
+	}
+	for i := range r.Reports {
+		if report.Id != "" && r.Reports[i].Id == report.Id {
+			r.Reports[i].Text = report.JobReportText
+			return
+		}
+	}
+	r.Reports = append(r.Reports, GroupJobReport{Id: report.Id, Text: report.JobReportText})
+}
+
+func groupKey(groupId string) string {
+	return JobGroupPrefix + groupId + "/jobs"
+}
+
+func groupOpenKey(groupId string) string {
+	return JobGroupPrefix + groupId + "/open"
+}
+
+func groupResultsPrefix(groupId string) string {
+	return JobGroupPrefix + groupId + "/results/"
+}
+
+// Scheduled lists the members that run a job
+func (g *JobGroup) Scheduled() []GroupJob {
+	scheduled := make([]GroupJob, 0, len(g.Jobs))
+	for _, job := range g.Jobs {
+		if job.JobId != "" {
+			scheduled = append(scheduled, job)
+		}
+	}
+	return scheduled
+}
+
+// Rows renders the members for the matrix templates, results may be nil
+func (g *JobGroup) Rows(results map[string]*GroupJobResult) []templates.MatrixJobRow {
+	rows := make([]templates.MatrixJobRow, 0, len(g.Jobs))
+	for _, job := range g.Jobs {
+		row := templates.MatrixJobRow{
+			Host:  job.Host,
+			Axes:  templates.TableCell(strings.Join(job.Axes, ", ")),
+			JobId: job.JobId,
+			Error: templates.TableCell(job.Error),
+		}
+		if result, ok := results[job.JobId]; ok {
+			row.Status = result.Status
+			row.ReportText = result.ReportText()
+			row.LogExcerpt = result.LogExcerpt
+			row.LogExcerptKind = result.LogExcerptKind
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// storeGroup writes the member list and the open marker once, later calls keep them as they are
+func storeGroup(ctx context.Context, group *JobGroup, lease storage.LeaseID) error {
+	existing, err := storage.Default().Get(ctx, groupKey(group.Id))
+	if err != nil || existing != nil {
+		return err
+	}
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	if err = storage.Default().Put(ctx, groupKey(group.Id), data, lease); err != nil {
+		return err
+	}
+	return storage.Default().Put(ctx, groupOpenKey(group.Id), nil, lease)
+}
+
+func retrieveGroup(ctx context.Context, groupId string) (*JobGroup, error) {
+	kv, err := storage.Default().Get(ctx, groupKey(groupId))
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("job group %s does not exist", groupId)
+	}
+	var group JobGroup
+	if err = json.Unmarshal(kv.Value, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func retrieveGroupResults(ctx context.Context, groupId string) (map[string]*GroupJobResult, error) {
+	prefix := groupResultsPrefix(groupId)
+	kvs, _, err := storage.Default().List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]*GroupJobResult, len(kvs))
+	for _, kv := range kvs {
+		var result GroupJobResult
+		if err := json.Unmarshal(kv.Value, &result); err != nil {
+			return nil, err
+		}
+		results[strings.TrimPrefix(kv.Key, prefix)] = &result
+	}
+	return results, nil
+}
+
+// processGroupReport records the report of a matrix job, the report completing the group posts the summary
+func processGroupReport(ctx context.Context, job *GithubIssueMeta, report *JobReport, redactor *redact.Redactor) error {
+	groupId := *job.GroupId
+	ctx = logging.With(ctx, logging.KeyGroup, groupId)
+	lease := storage.NoLease
+	if job.MyLeaseID != nil {
+		lease = *job.MyLeaseID
+	}
+
+	resultKey := groupResultsPrefix(groupId) + report.JobId
+	result := GroupJobResult{}
+	previous, err := storage.Default().Get(ctx, resultKey)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		if err = json.Unmarshal(previous.Value, &result); err != nil {
+			return err
+		}
+	}
+	// reports without a status are progress, they are kept in order
+	result.addReport(report)
+	result.ReportedAt = time.Now()
+	if failedStatus(report.Status) {
+		excerpt, err := log_excerpt.ForReport(ctx, job.Host, report.JobId, true)
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to build log excerpt", "error", err)
+		} else if excerpt != nil {
+			result.LogExcerpt = redactor.Text(excerpt.Text())
+			result.LogExcerptKind = excerpt.Kind
+		}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err = storage.Default().Put(ctx, resultKey, data, lease); err != nil {
+		return err
+	}
+	// only the report carrying the job status completes the member
+	if report.Status == "" {
+		return nil
+	}
+
+	group, err := retrieveGroup(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	results, err := retrieveGroupResults(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	for _, member := range group.Scheduled() {
+		if memberResult, ok := results[member.JobId]; !ok || memberResult.Status == "" {
+			slog.DebugContext(ctx, "job group is still running", "waiting_for", member.JobId)
+			return nil
+		}
+	}
+
+	// several replicas or goroutines may see the group complete, only one deletes the marker
+	open, err := storage.Default().Get(ctx, groupOpenKey(groupId))
+	if err != nil || open == nil {
+		return err
+	}
+	claimed, err := storage.Default().DeleteAt(ctx, open.Key, open.ModRevision)
+	if err != nil || !claimed {
+		return err
+	}
+	summary, err := templates.NewMatrixReportContext(
+		job.Body, *job.AnswerCommentBody, groupId, group.Rows(results),
+	).GenText()
+	if err == nil {
+		err = outbox.Enqueue(
+			ctx, outbox.NewCommentItem(
+				&gh_api.BotResponse{
+					Forge:       job.Forge,
+					Owner:       job.Owner,
+					Repo:        job.Repository,
+					IssueNumber: job.IssueId,
+					Text:        summary,
+				},
+			),
+		)
+	}
+	if err != nil {
+		// reopen so that the retried report posts the summary
+		if reopenErr := storage.Default().Put(ctx, groupOpenKey(groupId), nil, lease); reopenErr != nil {
+			err = errors.Join(err, reopenErr)
+		}
+		return err
+	}
+	slog.InfoContext(ctx, "job group finished, summary queued", "jobs", len(group.Jobs))
+	return nil
+}
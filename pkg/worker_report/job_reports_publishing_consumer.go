@@ -1,11 +1,19 @@
 package worker_report
 
 import (
-	"ActQABot/conf"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/tracing"
 	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/log_excerpt"
+	"ActQABot/pkg/notify"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/webhooks"
 	"ActQABot/templates"
 	"context"
-	"github.com/golang/glog"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"sync"
 )
 
@@ -14,25 +22,32 @@ type jobReportsConsumerState struct {
 	perIdent map[string]chan any
 }
 
+// JobReportsConsumer processes job reports until ctx is done, then waits for the reports in flight:
+// started ones run to completion, the ones still queued behind another report of their job are nacked.
 func JobReportsConsumer(ctx context.Context, jobReportEventLoop <-chan *JobReportEvent) {
 	perJobExec := jobReportsConsumerState{perIdent: make(map[string]chan any), mu: &sync.Mutex{}}
-	defer glog.V(1).Infof("JobReportsConsumer end.")
+	var inFlight sync.WaitGroup
+	defer slog.DebugContext(ctx, "JobReportsConsumer end.")
+	defer inFlight.Wait()
 	for {
-		glog.V(1).Infof("JobReportsConsumer start...")
+		slog.DebugContext(ctx, "JobReportsConsumer start...")
 		select {
-		case jobReportEvent := <-jobReportEventLoop:
+		case jobReportEvent, ok := <-jobReportEventLoop:
+			if !ok {
+				return
+			}
 			{
 				report := jobReportEvent.Report
-				glog.V(1).Infof("JobReportsConsumer received job report: %s", report.JobId)
+				jobCtx := logging.With(ctx, logging.KeyJob, report.JobId)
+				slog.DebugContext(jobCtx, "JobReportsConsumer received job report")
 				// single task per ID
 				// Do not block the whole loop waiting for the semaphore inside the lock.
 				getSyncChannel := func() chan any {
-					glog.V(2).Infof("JobReportsConsumer is waiting for the map lock")
+					slog.Log(jobCtx, logging.LevelTrace, "JobReportsConsumer is waiting for the map lock")
 					perJobExec.mu.Lock()
 					defer perJobExec.mu.Unlock()
-					defer glog.V(2).Infof("JobReportsConsumer released the map lock")
+					defer slog.Log(jobCtx, logging.LevelTrace, "JobReportsConsumer released the map lock")
 
-					glog.V(1).Infof("JobReportsConsumer Received jobReportEvent jobReportEvent: %s", report.JobId)
 					syncExec, found := perJobExec.perIdent[report.JobId]
 					if !found {
 						syncExec = make(chan any, 1)
@@ -44,19 +59,30 @@ func JobReportsConsumer(ctx context.Context, jobReportEventLoop <-chan *JobRepor
 				syncExec := getSyncChannel()
 
 				// async execution per channel, but sync per ID
-				go func(syncExec chan any, jobId string) {
+				inFlight.Add(1)
+				go func(ctx context.Context, syncExec chan any, jobId string) {
+					defer inFlight.Done()
 					// Acquire semaphore outside of the map mutex to avoid blocking other jobs
-					glog.V(1).Infof("JobReportsConsumer is waiting for semaphore >>%s<<...", jobId)
+					slog.DebugContext(ctx, "JobReportsConsumer is waiting for the job semaphore...")
 					select {
 					case syncExec <- struct{}{}:
-						glog.V(1).Infof("JobReportsConsumer acquired the semaphore >>%s<<", jobId)
+						slog.DebugContext(ctx, "JobReportsConsumer acquired the job semaphore")
 					case <-ctx.Done():
+						jobReportEvent.Finish.Do(
+							func() {
+								if err := jobReportEvent.Nack(context.WithoutCancel(ctx), ConsumerStoppedError); err != nil {
+									slog.ErrorContext(ctx, "JobReportsConsumer - error during nack on shutdown", "error", err)
+								}
+							},
+						)
 						return
 					}
+					// a started report is finished even when the consumer is stopped meanwhile
+					ctx = context.WithoutCancel(ctx)
 
 					// unlock current jobID
 					defer func() {
-						glog.V(2).Infof("defer JobReportsConsumer released the map lock")
+						slog.Log(ctx, logging.LevelTrace, "defer JobReportsConsumer is waiting for the map lock")
 						perJobExec.mu.Lock()
 						<-syncExec
 						// This prevents memory leaks while avoiding "stealing" channels from new arrivals
@@ -64,90 +90,171 @@ func JobReportsConsumer(ctx context.Context, jobReportEventLoop <-chan *JobRepor
 							delete(perJobExec.perIdent, jobId)
 						}
 
-						glog.V(1).Infof("defer JobReportsConsumer released the semaphore >>%s<<", jobId)
+						slog.DebugContext(ctx, "defer JobReportsConsumer released the job semaphore")
 						perJobExec.mu.Unlock()
 					}()
 
+					ctx, span := tracing.Start(
+						ctx, "JobReportsConsumer.report", trace.WithAttributes(
+							attribute.String("job.id", report.JobId),
+							attribute.String("job.status", report.Status),
+						),
+					)
+					defer span.End()
+
+					// the job is over, whether its report can be posted or not
+					if report.Status != "" {
+						if err := DeleteJobDeadline(ctx, report.JobId); err != nil {
+							slog.ErrorContext(ctx, "JobReportsConsumer - unable to stop the job watchdog", "error", err)
+						}
+					}
+
 					// retrieve github meta
 					job, err := RetrieveGithubJobMetaFunc(ctx, report.JobId)
 					if err != nil {
-						glog.Errorf("JobReportsConsumer - error during retrieval: %v", err)
+						slog.ErrorContext(ctx, "JobReportsConsumer - error during retrieval", "error", err)
+						tracing.Fail(span, err)
 
 						// nack on error
 						jobReportEvent.Finish.Do(
 							func() {
-								if err := jobReportEvent.Nack(ctx); err != nil {
-									glog.Errorf("JobReportsConsumer - error during nack of %s: %v", report.JobId, err)
+								if err := jobReportEvent.Nack(ctx, fmt.Errorf("job meta retrieval: %w", err)); err != nil {
+									slog.ErrorContext(ctx, "JobReportsConsumer - error during nack", "error", err)
 								}
 							},
 						)
 						return
 					}
 					if job == nil || job.AnswerCommentBody == nil {
-						glog.Errorf("JobReportsConsumer - job %v does not exist", report.JobId)
+						slog.ErrorContext(ctx, "JobReportsConsumer - job does not exist")
+						missing := fmt.Errorf("job %s does not exist", report.JobId)
+						tracing.Fail(span, missing)
 						jobReportEvent.Finish.Do(
 							func() {
-								if err := jobReportEvent.Nack(ctx); err != nil {
-									glog.Errorf("JobReportsConsumer - error during nack of %s: %v", report.JobId, err)
+								if err := jobReportEvent.Nack(ctx, missing); err != nil {
+									slog.ErrorContext(ctx, "JobReportsConsumer - error during nack", "error", err)
 								}
 							},
 						)
 						return
 					}
-					// authorize github
-					tok, err := gh_api.Authorize(
-						conf.GithubEnvironment, job.Owner, job.Repository,
+					ctx = logging.With(
+						ctx,
+						logging.KeyRepo, job.Owner+"/"+job.Repository,
+						logging.KeyIssue, job.IssueId,
+						logging.KeySender, job.Sender,
+						logging.KeyHost, job.Host,
 					)
-
-					// generate response
-					generated, err := templates.NewWorkerReportContext(
-						job.Body, *job.AnswerCommentBody, report.JobReportText,
-					).GenText()
-					if err != nil {
-						glog.Errorf("JobReportsConsumer - error during token generation: %v", err)
-						jobReportEvent.Finish.Do(
-							func() {
-								if err := jobReportEvent.Nack(ctx); err != nil {
-									glog.Errorf("JobReportsConsumer - error during nack of %s: %v", report.JobId, err)
-								}
-							},
+					// the report is caused by the scheduling request but isn't part of it
+					tracing.Link(span, job.Trace)
+					// whatever follows posts or publishes the report, the secrets it echoes must not leave
+					redactor := job.redactor(ctx)
+					report.JobReportText = redactor.Text(report.JobReportText)
+					if job.GroupId != nil {
+						// matrix jobs are summarized once the whole group reported
+						if err = processGroupReport(ctx, job, report, redactor); err != nil {
+							slog.ErrorContext(ctx, "JobReportsConsumer - error during group report", "error", err)
+							tracing.Fail(span, err)
+							jobReportEvent.Finish.Do(
+								func() {
+									if err := jobReportEvent.Nack(ctx, fmt.Errorf("group report: %w", err)); err != nil {
+										slog.ErrorContext(ctx, "JobReportsConsumer - error during nack", "error", err)
+									}
+								},
+							)
+							return
+						}
+					} else {
+						// generate response
+						reportContext := templates.NewWorkerReportContext(
+							job.Body, *job.AnswerCommentBody, report.JobReportText,
 						)
-						return
+						// fetching the log holds the job semaphore: only the final report of a failed job waits for it
+						if failedStatus(report.Status) {
+							excerpt, err := log_excerpt.ForReport(ctx, job.Host, report.JobId, true)
+							if err != nil {
+								slog.ErrorContext(ctx, "JobReportsConsumer - unable to build log excerpt", "error", err)
+							} else if excerpt != nil {
+								reportContext.LogExcerpt = redactor.Text(excerpt.Text())
+								reportContext.LogExcerptKind = excerpt.Kind
+							}
+						}
+						generated, err := reportContext.GenText()
+						if err != nil {
+							slog.ErrorContext(ctx, "JobReportsConsumer - error during report generation", "error", err)
+							tracing.Fail(span, err)
+							jobReportEvent.Finish.Do(
+								func() {
+									if err := jobReportEvent.Nack(ctx, fmt.Errorf("report generation: %w", err)); err != nil {
+										slog.ErrorContext(ctx, "JobReportsConsumer - error during nack", "error", err)
+									}
+								},
+							)
+							return
+						}
+
+						// post comment
+						if err = outbox.Enqueue(
+							ctx,
+							outbox.NewCommentItem(
+								&gh_api.BotResponse{
+									Forge:       job.Forge,
+									Owner:       job.Owner,
+									Repo:        job.Repository,
+									IssueNumber: job.IssueId,
+									Text:        generated,
+								},
+							),
+						); err != nil {
+							slog.ErrorContext(ctx, "JobReportsConsumer - error during enqueueing issue comment", "error", err)
+							tracing.Fail(span, err)
+							jobReportEvent.Finish.Do(
+								func() {
+									if err := jobReportEvent.Nack(ctx, fmt.Errorf("comment enqueue: %w", err)); err != nil {
+										slog.ErrorContext(ctx, "JobReportsConsumer - error during nack", "error", err)
+									}
+								},
+							)
+							return
+						}
 					}
 
-					// post comment
-					if err = gh_api.PostIssueCommentFunc(
-						&gh_api.BotResponse{
-							Owner:       job.Owner,
-							Repo:        job.Repository,
-							IssueNumber: job.IssueId,
-							Text:        generated,
-						},
-						*tok.Token,
-					); err != nil {
-						glog.Errorf("JobReportsConsumer - error during posting issue comment: %v", err)
-						jobReportEvent.Finish.Do(
-							func() {
-								if err := jobReportEvent.Nack(ctx); err != nil {
-									glog.Errorf("JobReportsConsumer - error during nack of %s: %v", report.JobId, err)
-								}
+					reportEvent := webhooks.NewEvent(webhooks.EventJobReport, job.WebhookJob(report.JobId))
+					reportEvent.Report = &webhooks.Report{Text: report.JobReportText, Status: report.Status}
+					webhooks.Publish(reportEvent)
+					// a report carrying a status is the last one of the job
+					if report.Status != "" {
+						finishedEvent := webhooks.NewEvent(webhooks.EventJobFinished, job.WebhookJob(report.JobId))
+						finishedEvent.Report = reportEvent.Report
+						webhooks.Publish(finishedEvent)
+						notify.Notify(
+							notify.Event{
+								Kind:        templates.NotificationJobFinished,
+								Owner:       job.Owner,
+								Repo:        job.Repository,
+								IssueNumber: job.IssueId,
+								Sender:      job.Sender,
+								Host:        job.Host,
+								JobId:       report.JobId,
+								Status:      report.Status,
+								Command:     job.Body,
+								ReportText:  report.JobReportText,
 							},
 						)
-						return
 					}
 
 					// ack
 					jobReportEvent.Finish.Do(
 						func() {
 							if err = jobReportEvent.Ack(ctx); err != nil {
-								glog.Errorf("JobReportsConsumer - error during ack of %s: %v", report.JobId, err)
+								slog.ErrorContext(ctx, "JobReportsConsumer - error during ack", "error", err)
 								return
 							}
 						},
 					)
 					// we don't delete the job because we might have some additional worker reports
 					// let's just trust the Lease.
-				}(syncExec, report.JobId)
+				}(jobCtx, syncExec, report.JobId)
 				continue
 			}
 
@@ -0,0 +1,98 @@
+package worker_report
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	JobSpecPrefix = "/job-spec/"
+	// last job scheduled from an issue, by forge/owner/repo/issue
+	IssueLastJobPrefix = "/issue-last-job/"
+)
+
+var JobSpecNotFoundError = errors.New("job not found")
+
+// JobSpec is everything needed to schedule a job again, it outlives the job meta
+type JobSpec struct {
+	JobId string `json:"job_id"`
+	// generated by the bot before scheduling, the RunId of the custom_flags templates
+	RunId       string `json:"run_id,omitempty"`
+	Forge       string `json:"forge,omitempty"`
+	Owner       string `json:"owner"`
+	Repository  string `json:"repository"`
+	IssueNumber int    `json:"issue_number"`
+	Host        string `json:"host"`
+	// ref as written in the command and the commit it resolved to
+	Ref          string   `json:"ref"`
+	Commit       string   `json:"commit"`
+	WorkflowFile string   `json:"workflow_file"`
+	ExtraFlags   []string `json:"extra_flags"`
+	// workflow_dispatch inputs with their defaults applied
+	Inputs    map[string]string `json:"inputs,omitempty"`
+	Requester string            `json:"requester"`
+	CreatedAt time.Time         `json:"created_at"`
+	// job this one re-runs
+	RerunOf string `json:"rerun_of,omitempty"`
+	// maximum duration asked for with --timeout, a re-run keeps it
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+func issueLastJobKey(forgeName, owner, repo string, issue int) string {
+	if forgeName == "" {
+		forgeName = "github"
+	}
+	return fmt.Sprintf("%s%s/%s/%s/%d", IssueLastJobPrefix, forgeName, owner, repo, issue)
+}
+
+// SaveJobSpec stores the spec for conf.GeneralEnvironments.JobSpecTTL and makes it the last job of its issue
+func SaveJobSpec(ctx context.Context, spec *JobSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	lease := storage.NoLease
+	if ttl := conf.GeneralEnvironments.JobSpecTTL; ttl > 0 {
+		if lease, err = storage.Default().Grant(ctx, ttl); err != nil {
+			return err
+		}
+	}
+	if err = storage.Default().Put(ctx, JobSpecPrefix+spec.JobId, data, lease); err != nil {
+		return err
+	}
+	return storage.Default().Put(
+		ctx, issueLastJobKey(spec.Forge, spec.Owner, spec.Repository, spec.IssueNumber), []byte(spec.JobId), lease,
+	)
+}
+
+func GetJobSpec(ctx context.Context, jobId string) (*JobSpec, error) {
+	kv, err := storage.Default().Get(ctx, JobSpecPrefix+jobId)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, JobSpecNotFoundError
+	}
+	var spec JobSpec
+	if err = json.Unmarshal(kv.Value, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// LastJobSpec returns the spec of the last job scheduled from the issue
+func LastJobSpec(ctx context.Context, forgeName, owner, repo string, issue int) (*JobSpec, error) {
+	kv, err := storage.Default().Get(ctx, issueLastJobKey(forgeName, owner, repo, issue))
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, JobSpecNotFoundError
+	}
+	return GetJobSpec(ctx, string(kv.Value))
+}
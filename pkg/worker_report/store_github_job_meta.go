@@ -1,51 +1,99 @@
 package worker_report
 
 import (
-	"ActQABot/internal/etcd_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/tracing"
+	"ActQABot/pkg/redact"
+	"ActQABot/pkg/storage"
+	"ActQABot/pkg/webhooks"
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/golang/glog"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"time"
 )
 
 const GithubIssueMetaPrefix = "/github-issue-meta/"
 
 type GithubIssueMeta struct {
-	Sender            string            `json:"sender"`
-	Body              string            `json:"body"`
-	Owner             string            `json:"owner"`
-	Repository        string            `json:"repository"`
-	AnswerCommentBody *string           `json:"answer_comment_body"`
-	IssueId           int               `json:"issue_id"`
-	Host              string            `json:"host"`
-	MyLeaseID         *clientv3.LeaseID `json:"lease"`
-	JobId             *string           `json:"job_id"`
+	Forge             string           `json:"forge,omitempty"`
+	Sender            string           `json:"sender"`
+	Body              string           `json:"body"`
+	Owner             string           `json:"owner"`
+	Repository        string           `json:"repository"`
+	AnswerCommentBody *string          `json:"answer_comment_body"`
+	IssueId           int              `json:"issue_id"`
+	Host              string           `json:"host"`
+	MyLeaseID         *storage.LeaseID `json:"lease"`
+	JobId             *string          `json:"job_id"`
+	// trace context of the request that scheduled the job
+	Trace tracing.Carrier `json:"trace,omitempty"`
+	// matrix group the job belongs to, its reports are posted as a single summary
+	GroupId *string `json:"group_id,omitempty"`
+	// job re-run by this one
+	RerunOf *string `json:"rerun_of,omitempty"`
+	// jobs of a matrix command, set instead of JobId until StoreJobs
+	Group *JobGroup `json:"-"`
 }
 
-func (g *GithubIssueMeta) Store(ctx context.Context, jobId string, retries int64) error {
+// StoreJobs stores the meta of the job or of every job of the matrix group, the group shares a lease
+func (g *GithubIssueMeta) StoreJobs(ctx context.Context, retries int64) error {
+	if g.Group == nil {
+		if g.JobId == nil {
+			return nil
+		}
+		return g.Store(ctx, *g.JobId, retries)
+	}
+	if g.MyLeaseID == nil {
+		leaseID, err := storage.Default().Grant(ctx, jobMetaTTL)
+		if err != nil {
+			return err
+		}
+		g.MyLeaseID = &leaseID
+	}
+	if err := storeGroup(ctx, g.Group, *g.MyLeaseID); err != nil {
+		return err
+	}
+	var errs []error
+	for _, member := range g.Group.Scheduled() {
+		jobMeta := *g
+		jobMeta.Group = nil
+		jobMeta.GroupId = &g.Group.Id
+		jobMeta.JobId = &member.JobId
+		jobMeta.Host = member.Host
+		errs = append(errs, jobMeta.Store(ctx, member.JobId, retries))
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GithubIssueMeta) Store(ctx context.Context, jobId string, retries int64) (err error) {
+	ctx, span := tracing.Start(ctx, "GithubIssueMeta.Store", trace.WithAttributes(attribute.String("job.id", jobId)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	ctx = logging.With(ctx, logging.KeyHost, g.Host, logging.KeyJob, jobId)
 	metaCreated := false
 	for retries++; retries > 0; retries-- {
 		if g.MyLeaseID == nil {
-			leaseID, err := GithubJobMetaLeaseCreateFunc(ctx)
+			leaseID, err := storage.Default().Grant(ctx, jobMetaTTL)
 			if err != nil {
-				glog.Errorf("failed to store job meta on lease creation: %v, retries left: %d", err, retries-1)
+				slog.ErrorContext(ctx, "failed to store job meta on lease creation", "error", err, "retries_left", retries-1)
 				time.Sleep(10)
 				continue
 			}
-			g.MyLeaseID = new(clientv3.LeaseID)
-			*g.MyLeaseID = *leaseID
+			g.MyLeaseID = &leaseID
 		}
 		data, err := json.Marshal(g)
 		if err != nil {
-			GithubJobMetaLeaseRevokeFunc(ctx, *g.MyLeaseID)
+			_ = storage.Default().Revoke(ctx, *g.MyLeaseID)
 			g.MyLeaseID = nil
 			return err
 		}
-		_, err = StoreGithubJobMetaFunc(ctx, jobId, data, *g.MyLeaseID)
+		err = storage.Default().Put(ctx, GithubIssueMetaPrefix+jobId, data, *g.MyLeaseID)
 		if err != nil {
-			glog.Errorf("failed to store job meta: %v, retries left: %d", err, retries-1)
+			slog.ErrorContext(ctx, "failed to store job meta", "error", err, "retries_left", retries-1)
 			time.Sleep(10)
 			continue
 		}
@@ -54,43 +102,64 @@ func (g *GithubIssueMeta) Store(ctx context.Context, jobId string, retries int64
 	}
 	if !metaCreated {
 		if g.MyLeaseID != nil {
-			GithubJobMetaLeaseRevokeFunc(ctx, *g.MyLeaseID)
+			_ = storage.Default().Revoke(ctx, *g.MyLeaseID)
 		}
 		return errors.New("failed to store job meta")
 	}
-	glog.V(1).Infof("successfully stored job meta: %v", g)
+	slog.DebugContext(ctx, "stored job meta", logging.KeyRepo, g.Owner+"/"+g.Repository, logging.KeyIssue, g.IssueId)
 	return nil
 }
 
-func etcdRetrieveJobMeta(ctx context.Context, jobId string) (*GithubIssueMeta, error) {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
+// WebhookJob describes the job in outbound webhook events
+func (g *GithubIssueMeta) WebhookJob(jobId string) webhooks.Job {
+	var rerunOf string
+	if g.RerunOf != nil {
+		rerunOf = *g.RerunOf
 	}
-	resp, err := etcd_utils.EtcdStoreInstance.Client.Get(ctx, GithubIssueMetaPrefix+jobId)
+	return webhooks.Job{
+		Id:          jobId,
+		Host:        g.Host,
+		Forge:       g.Forge,
+		Owner:       g.Owner,
+		Repository:  g.Repository,
+		IssueNumber: g.IssueId,
+		Sender:      g.Sender,
+		Command:     g.Body,
+		RerunOf:     rerunOf,
+	}
+}
+
+// PublishJobCancelled tells the webhooks the job was cancelled, with the conversation it was requested in when
+// its meta is still there
+func PublishJobCancelled(ctx context.Context, jobId, hostName string, report *webhooks.Report) {
+	cancelledJob := webhooks.Job{Id: jobId, Host: hostName}
+	if meta, err := RetrieveGithubJobMetaFunc(ctx, jobId); err != nil {
+		slog.ErrorContext(ctx, "unable to retrieve meta of cancelled job", "error", err)
+	} else if meta != nil {
+		cancelledJob = meta.WebhookJob(jobId)
+	}
+	event := webhooks.NewEvent(webhooks.EventJobCancelled, cancelledJob)
+	event.Report = report
+	webhooks.Publish(event)
+}
+
+// redactor masks the secrets the job got in its reports
+func (g *GithubIssueMeta) redactor(ctx context.Context) *redact.Redactor {
+	return redact.ForJob(ctx, redact.SourceReport, g.Forge, g.Owner+"/"+g.Repository, g.Host)
+}
+
+func retrieveJobMeta(ctx context.Context, jobId string) (*GithubIssueMeta, error) {
+	kv, err := storage.Default().Get(ctx, GithubIssueMetaPrefix+jobId)
 	if err != nil {
 		return nil, err
 	}
-	if len(resp.Kvs) == 0 {
+	if kv == nil {
 		return nil, nil
 	}
 	githubIssueMeta := &GithubIssueMeta{}
-	err = json.Unmarshal(resp.Kvs[0].Value, githubIssueMeta)
+	err = json.Unmarshal(kv.Value, githubIssueMeta)
 	if err != nil {
 		return nil, err
 	}
 	return githubIssueMeta, nil
 }
-
-func etcdDeleteJobMeta(ctx context.Context, jobId string, leaseID *clientv3.LeaseID) error {
-	if etcd_utils.EtcdStoreInstance == nil {
-		panic("etcd_store instance is nil")
-	}
-	_, err := etcd_utils.EtcdStoreInstance.Client.Delete(ctx, GithubIssueMetaPrefix+jobId, nil)
-	if err != nil {
-		return err
-	}
-	if leaseID != nil {
-		GithubJobMetaLeaseRevokeFunc(ctx, *leaseID)
-	}
-	return nil
-}
@@ -1,11 +1,14 @@
 package worker_report
 
 import (
-	"ActQABot/internal/etcd_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/storage"
 	"context"
 	"encoding/json"
-	"github.com/golang/glog"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"errors"
+	"github.com/google/uuid"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -14,99 +17,195 @@ type JobKeys string
 
 const JobReportChannel JobKeys = "/job-report-chan/"
 
+// Status of a job, carried by its last report only. Workers must send it with their final report: the job
+// counts as running until then, the reports without a status are progress.
+const (
+	JobStatusSuccess = "success"
+	JobStatusFailure = "failure"
+	// the job was stopped before its end
+	JobStatusCancelled = "cancelled"
+	// sent by the watchdog when it cancelled a job past its maximum duration
+	JobStatusTimeout = "timeout"
+)
+
+var UnknownStatusError = errors.New("unknown job status, expected success, failure, cancelled or timeout")
+
+// ValidStatus tells the statuses a report may carry, none for a progress report
+func ValidStatus(status string) bool {
+	switch status {
+	case "", JobStatusSuccess, JobStatusFailure, JobStatusCancelled, JobStatusTimeout:
+		return true
+	}
+	return false
+}
+
+// failedStatus tells the final statuses whose report gets the log excerpt
+func failedStatus(status string) bool {
+	return status == JobStatusFailure || status == JobStatusCancelled || status == JobStatusTimeout
+}
+
 type JobReport struct {
+	// set when the report is queued, a retried report keeps it
+	Id            string `json:"id,omitempty"`
 	JobId         string `json:"job_id"`
 	JobReportText string `json:"report_text"`
-	Retried       *int32 `json:"retried"`
+	// marks the last report of the job, empty for a progress report
+	Status  string `json:"status,omitempty" enums:"success,failure,cancelled,timeout" example:"failure"`
+	Retried *int32 `json:"retried"`
+	// why the report was put back, one entry per nack
+	Attempts []ReportAttempt `json:"attempts,omitempty"`
+}
+
+type ReportAttempt struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error" example:"job 5b1c3f0e does not exist"`
 }
 
 type JobReportEvent struct {
 	Report *JobReport
 	Ack    func(context.Context) error
-	Nack   func(context.Context) error
+	// Nack puts the report back for another attempt, reason ends up in its attempt history
+	Nack func(ctx context.Context, reason error) error
 
 	Finish sync.Once
 }
 
 func (j *JobReport) SendEvent(ctx context.Context) error {
+	if j.Id == "" {
+		j.Id = uuid.NewString()
+	}
 	data, err := json.Marshal(j)
 	if err != nil {
 		return err
 	}
-	err = JobReportSendEventFunc(ctx, string(JobReportChannel)+j.JobId, string(data))
-	return err
+	return storage.Default().Put(ctx, string(JobReportChannel)+j.JobId, data, storage.NoLease)
+}
+
+func unmarshalJobReport(ctx context.Context, kv storage.KeyValue) (*JobReport, bool) {
+	var jr JobReport
+	if err := json.Unmarshal(kv.Value, &jr); err != nil {
+		slog.ErrorContext(ctx, "failed to unmarshal job report", "key", kv.Key, "error", err)
+		return nil, false
+	}
+	return &jr, true
 }
 
-func etcdFetchJobReports(ctx context.Context) ([]*JobReport, int64, error) {
-	resp, err := etcd_utils.EtcdStoreInstance.Client.Get(ctx, string(JobReportChannel), clientv3.WithPrefix())
+// resendMissedReports sends the queued reports changed after seenRev and returns the revision to watch from
+func resendMissedReports(
+	ctx context.Context, out chan<- *JobReportEvent, seenRev int64, wrap func(string, *JobReport, int64) *JobReportEvent,
+) (int64, error) {
+	queued, rev, err := storage.Default().List(ctx, string(JobReportChannel))
 	if err != nil {
-		return nil, 0, err
+		return seenRev, err
 	}
-	jobReports := make([]*JobReport, 0, len(resp.Kvs))
-	for _, v := range resp.Kvs {
-		var jr JobReport
-		err := json.Unmarshal(v.Value, &jr)
-		if err != nil {
-			glog.Errorf("failed to unmarshal job report: %v", err)
+	for _, kv := range queued {
+		if kv.ModRevision <= seenRev {
 			continue
 		}
-		jobReports = append(jobReports, &jr)
+		if jr, ok := unmarshalJobReport(ctx, kv); ok {
+			select {
+			case out <- wrap(kv.Key, jr, kv.ModRevision):
+			case <-ctx.Done():
+				return seenRev, ctx.Err()
+			}
+		}
 	}
-	return jobReports, resp.Header.Revision, nil
+	return rev, nil
 }
 
 func SubscribeJobReports(ctx context.Context) (<-chan *JobReportEvent, error) {
 
 	wrapJobReportIntoEvent := func(k string, v *JobReport, rev int64) *JobReportEvent {
-		ack := JobMakeAckFunc(k, rev)
-		nack := JobMakeNackFunc(k, v, 10)
+		ack := makeAckFn(k, rev)
+		nack := makeNackFunc(k, v, 10)
 
 		event := &JobReportEvent{
 			Report: v,
-			Ack:    ack,
-			Nack:   nack,
+			Ack: func(ctx context.Context) error {
+				err := ack(ctx)
+				metrics.JobReportAcks.WithLabelValues(metrics.Outcome(err)).Inc()
+				return err
+			},
+			Nack: func(ctx context.Context, reason error) error {
+				err := nack(ctx, reason)
+				metrics.JobReportNacks.WithLabelValues(metrics.Outcome(err)).Inc()
+				return err
+			},
 		}
 		return event
 	}
 
 	out := make(chan *JobReportEvent)
+	metrics.SetReportQueueDepthSource(
+		func() float64 {
+			countCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			depth, err := countJobReports(countCtx)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to count queued job reports", "error", err)
+			}
+			return float64(depth)
+		},
+	)
+	metrics.SetDeadReportsSource(
+		func() float64 {
+			countCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			dead, err := storage.Default().Count(countCtx, JobReportDeadPrefix)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to count dead-lettered job reports", "error", err)
+			}
+			return float64(dead)
+		},
+	)
 
 	go func() {
-		glog.V(1).Info("SubscribeJobReports started...")
-		defer glog.V(1).Info("SubscribeJobReports finished...")
+		slog.DebugContext(ctx, "SubscribeJobReports started...")
+		defer slog.DebugContext(ctx, "SubscribeJobReports finished...")
 		defer close(out)
 
-		oldJobReports, activeRev, err := JobReportFetchFunc(ctx)
-
+		queued, activeRev, err := storage.Default().List(ctx, string(JobReportChannel))
 		if err != nil {
-			glog.Errorf("failed to fetch job reports: %v", err)
-		} else {
-			for _, oldJobReport := range oldJobReports {
-				ev := wrapJobReportIntoEvent(oldJobReport.JobId, oldJobReport, activeRev)
-				out <- ev
+			slog.ErrorContext(ctx, "failed to fetch job reports", "error", err)
+		}
+		for _, kv := range queued {
+			if jr, ok := unmarshalJobReport(ctx, kv); ok {
+				select {
+				case out <- wrapJobReportIntoEvent(kv.Key, jr, kv.ModRevision):
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 		for {
-			rch := JobReportInitWatchFunc(ctx, activeRev+1).GetWatchResponseChannel(ctx)
-			for wresp := range rch {
-				if wresp.Canceled {
-					glog.Error("watch canceled, reconnecting:", wresp)
+			for wresp := range storage.Default().Watch(ctx, string(JobReportChannel), activeRev+1) {
+				if errors.Is(wresp.Err, storage.CompactedError) {
+					// the missed reports are still queued, the ones already seen are left to their consumer
+					slog.WarnContext(ctx, "watch history compacted, listing the job reports again", "error", wresp.Err)
+					if activeRev, err = resendMissedReports(ctx, out, activeRev, wrapJobReportIntoEvent); err != nil {
+						slog.ErrorContext(ctx, "failed to list the job reports", "error", err)
+					}
+					break
+				}
+				if wresp.Err != nil {
+					slog.ErrorContext(ctx, "watch canceled, reconnecting", "error", wresp.Err)
 					break
 				}
 
 				for _, ev := range wresp.Events {
-					if ev.Type != clientv3.EventTypePut {
-						glog.V(2).Infof("SubscribeJobReports - event watch response received for event %v", ev.Type)
+					// resume after the last seen change when the watch is reconnected
+					activeRev = ev.ModRevision
+					if ev.Type != storage.EventPut {
+						slog.Log(ctx, logging.LevelTrace, "SubscribeJobReports - skipping watch event", "type", ev.Type.String())
 						continue
 					}
 
-					var jr JobReport
-					if err := json.Unmarshal(ev.Kv.Value, &jr); err != nil {
-						glog.Error("failed to unmarshal JobReport:", err)
+					jr, ok := unmarshalJobReport(ctx, ev.KeyValue)
+					if !ok {
 						continue
 					}
 
-					event := wrapJobReportIntoEvent(string(ev.Kv.Key), &jr, ev.Kv.ModRevision)
+					event := wrapJobReportIntoEvent(ev.Key, jr, ev.ModRevision)
 					select {
 					case out <- event:
 					case <-ctx.Done():
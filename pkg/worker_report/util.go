@@ -1,106 +1,35 @@
 package worker_report
 
 import (
-	"ActQABot/internal/etcd_utils"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/storage"
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/golang/glog"
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"time"
 )
 
 // github meta
 
-var GithubJobMetaLeaseCreateFunc = leaseCreate
-var GithubJobMetaLeaseRevokeFunc = leaseRevoke
-var StoreGithubJobMetaFunc = storeGithubJobMeta
-var RetrieveGithubJobMetaFunc = etcdRetrieveJobMeta
-
-// var DeleteGithubJobMetaFunc = etcdDeleteJobMeta
-
-// Job report
-
-var JobReportInitWatchFunc = initWatch
-var JobReportFetchFunc = etcdFetchJobReports
-var JobReportSendEventFunc = putEtcdReport
-var JobMakeAckFunc = makeAckFn
-var JobMakeNackFunc = makeNackFunc
+var RetrieveGithubJobMetaFunc = retrieveJobMeta
 
 const maxNacks = 10
 
-// Realization
-
-func leaseRevoke(ctx context.Context, leaseID clientv3.LeaseID) {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	_, _ = etcd_utils.EtcdStoreInstance.Client.Lease.Revoke(ctx, leaseID)
-}
+// job meta outlives any job, the lease only cleans up after forgotten ones
+const jobMetaTTL = 10 * time.Hour
 
-func leaseCreate(ctx context.Context) (*clientv3.LeaseID, error) {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	resp, err := etcd_utils.EtcdStoreInstance.Client.Lease.Grant(ctx, int64((10 * time.Hour).Seconds()))
-	if err != nil {
-		return nil, err
-	}
-	return &resp.ID, nil
-}
-
-func storeGithubJobMeta(ctx context.Context, jobId string, data []byte, leaseID clientv3.LeaseID) (interface{}, error) {
-	if etcd_utils.EtcdStoreInstance == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	return etcd_utils.EtcdStoreInstance.Client.Put(
-		ctx, GithubIssueMetaPrefix+jobId, string(data), clientv3.WithLease(leaseID),
-	)
-}
-
-func initWatch(ctx context.Context, revision int64) WatchWorkerReport {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	rawWatch := etcd_utils.EtcdStoreInstance.Client.Watch(
-		ctx,
-		string(JobReportChannel),
-		clientv3.WithPrefix(),
-		clientv3.WithRev(revision),
-	)
-	return NewEtcdWatchWorkerReport(rawWatch)
-}
-
-func putEtcdReport(ctx context.Context, key string, value string) error {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	_, err := etcd_utils.EtcdStoreInstance.Client.Put(
-		ctx,
-		key,
-		value,
-	)
-	return err
-}
+// Realization
 
 func makeAckFn(
 	key string,
 	modRev int64,
 ) func(ctx context.Context) error {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	cli := etcd_utils.EtcdStoreInstance.Client
 	return func(ctx context.Context) error {
-		txn := cli.Txn(ctx).
-			If(clientv3.Compare(clientv3.ModRevision(key), "=", modRev)).
-			Then(clientv3.OpDelete(key))
-
-		resp, err := txn.Commit()
+		deleted, err := storage.Default().DeleteAt(ctx, key, modRev)
 		if err != nil {
 			return err
 		}
-		if !resp.Succeeded {
+		if !deleted {
 			return fmt.Errorf("ack failed: key was modified or already acked: %s", key)
 		}
 		return nil
@@ -111,16 +40,11 @@ func makeNackFunc(
 	key string,
 	report *JobReport,
 	delay time.Duration,
-) func(ctx context.Context) error {
-	if etcd_utils.EtcdStoreInstance == nil || etcd_utils.EtcdStoreInstance.Client == nil {
-		glog.Fatal("etcd_store instance is nil")
-	}
-	cli := etcd_utils.EtcdStoreInstance.Client
-	return func(ctx context.Context) error {
+) func(ctx context.Context, reason error) error {
+	return func(ctx context.Context, reason error) error {
+		report.Attempts = append(report.Attempts, ReportAttempt{At: time.Now(), Error: reason.Error()})
 		if report.Retried != nil && *report.Retried > maxNacks {
-			glog.Errorf("job %s was rejected too many times, dropping", report.JobId)
-			_, err := etcd_utils.EtcdStoreInstance.Client.Delete(ctx, key, clientv3.WithPrevKV())
-			return err
+			return deadLetter(ctx, key, report, reason)
 		} else if report.Retried == nil {
 			report.Retried = new(int32)
 			*report.Retried = 0
@@ -139,7 +63,14 @@ func makeNackFunc(
 			return err
 		}
 		// rewrite with updated retry count → new ModRevision
-		_, err = cli.Put(ctx, key, string(data))
+		err = storage.Default().Put(ctx, key, data, storage.NoLease)
+		if err == nil {
+			metrics.JobReportRequeues.Inc()
+		}
 		return err
 	}
 }
+
+func countJobReports(ctx context.Context) (int64, error) {
+	return storage.Default().Count(ctx, string(JobReportChannel))
+}
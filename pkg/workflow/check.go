@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ValidationError lists the problems that keep a job from being scheduled
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("workflow validation failed:")
+	for _, problem := range e.Problems {
+		sb.WriteString("\n- ")
+		sb.WriteString(problem.Error())
+	}
+	return sb.String()
+}
+
+// Load fetches and parses the workflow file, or every workflow of the directory when path is one.
+// Missing and unparsable files are problems, other forge failures are returned as err.
+func Load(
+	ctx context.Context, repoForge forge.Forge, owner, repo, ref, path string,
+) (workflows []*Workflow, problems []error, err error) {
+	if path == "" {
+		path = Dir
+	}
+	paths := []string{path}
+	if !IsWorkflowFile(path) {
+		files, err := repoForge.ListFiles(ctx, owner, repo, ref, path)
+		if forge.IsNotFound(err) {
+			return nil, []error{fmt.Errorf("%s does not exist at %s", path, refName(ref))}, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		paths = slices.DeleteFunc(files, func(file string) bool { return !IsWorkflowFile(file) })
+		if len(paths) == 0 {
+			return nil, []error{fmt.Errorf("%s holds no workflow at %s", path, refName(ref))}, nil
+		}
+	}
+	for _, file := range paths {
+		data, err := repoForge.GetFile(ctx, owner, repo, ref, file)
+		if forge.IsNotFound(err) {
+			problems = append(problems, fmt.Errorf("%s does not exist at %s", file, refName(ref)))
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		wf, err := Parse(file, data)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		workflows = append(workflows, wf)
+	}
+	return workflows, problems, nil
+}
+
+func refName(ref string) string {
+	if ref == "" {
+		return "the default branch"
+	}
+	return ref
+}
+
+// Check validates the workflow(s) a job is about to run on the host and resolves its inputs, which
+// need a single workflow file. Blocking problems come back as a *ValidationError; when the forge
+// can't be reached the job goes unchecked with a warning, unless it has inputs: they are never passed unchecked.
+func Check(
+	ctx context.Context, repoForge forge.Forge, owner, repo, ref, path string, host conf.Host,
+	inputs map[string]string,
+) (warnings []string, resolved map[string]string, err error) {
+	if len(inputs) > 0 && !IsWorkflowFile(path) {
+		return nil, nil, &ValidationError{Problems: []error{errors.New("inputs need a single WORKFLOW_PATH file")}}
+	}
+	workflows, problems, err := Load(ctx, repoForge, owner, repo, ref, path)
+	if err != nil {
+		if len(inputs) > 0 {
+			return nil, nil, &ValidationError{
+				Problems: []error{fmt.Errorf("the inputs can't be checked against the workflow: %w", err)},
+			}
+		}
+		return []string{fmt.Sprintf("workflow not validated: %s", err)}, nil, nil
+	}
+	platforms := HostPlatforms(host)
+	for _, wf := range workflows {
+		wfProblems, wfWarnings := wf.Validate(platforms)
+		problems = append(problems, wfProblems...)
+		warnings = append(warnings, wfWarnings...)
+		// a whole directory runs on its triggers, only a single file is dispatched with inputs
+		if IsWorkflowFile(path) {
+			var inputProblems []error
+			resolved, inputProblems = wf.ResolveInputs(inputs)
+			problems = append(problems, inputProblems...)
+		}
+	}
+	if len(problems) > 0 {
+		return warnings, nil, &ValidationError{Problems: problems}
+	}
+	return warnings, resolved, nil
+}
+
+// UncheckedInputsError is returned when inputs are given while the workflows aren't validated
+var UncheckedInputsError = &ValidationError{
+	Problems: []error{errors.New("inputs are only accepted when the workflows are validated (VALIDATE_WORKFLOWS)")},
+}
+
+// IsValidationError tells whether err comes from Check
+func IsValidationError(err error) bool {
+	var validationErr *ValidationError
+	return errors.As(err, &validationErr)
+}
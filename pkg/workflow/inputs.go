@@ -0,0 +1,157 @@
+package workflow
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Input types of on.workflow_dispatch.inputs
+const (
+	InputString      = "string"
+	InputBoolean     = "boolean"
+	InputNumber      = "number"
+	InputChoice      = "choice"
+	InputEnvironment = "environment"
+)
+
+// Input is a declared workflow_dispatch input
+type Input struct {
+	Name        string
+	Description string
+	Type        string
+	Required    bool
+	Default     string
+	Options     []string
+}
+
+// parseTriggers finds the workflow_dispatch trigger in any of the on forms: event, list or mapping
+func parseTriggers(path string, on interface{}) (dispatch bool, inputs []Input, err error) {
+	switch v := on.(type) {
+	case string:
+		return v == "workflow_dispatch", nil, nil
+	case []interface{}:
+		return slices.Contains(stringList(v), "workflow_dispatch"), nil, nil
+	case map[interface{}]interface{}:
+		trigger, ok := v["workflow_dispatch"]
+		if !ok {
+			return false, nil, nil
+		}
+		triggerRaw, _ := trigger.(map[interface{}]interface{})
+		declared, _ := triggerRaw["inputs"].(map[interface{}]interface{})
+		for key, value := range declared {
+			input := Input{Name: fmt.Sprint(key), Type: InputString}
+			inputRaw, ok := value.(map[interface{}]interface{})
+			if !ok && value != nil {
+				return false, nil, fmt.Errorf("%s: input %s is not a mapping", path, input.Name)
+			}
+			input.Description, _ = inputRaw["description"].(string)
+			input.Required, _ = inputRaw["required"].(bool)
+			if inputType, ok := inputRaw["type"].(string); ok {
+				input.Type = inputType
+			}
+			if inputDefault, ok := inputRaw["default"]; ok && inputDefault != nil {
+				input.Default = fmt.Sprint(inputDefault)
+			}
+			input.Options = stringList(inputRaw["options"])
+			switch input.Type {
+			case InputString, InputBoolean, InputNumber, InputEnvironment:
+			case InputChoice:
+				if len(input.Options) == 0 {
+					return false, nil, fmt.Errorf("%s: choice input %s has no options", path, input.Name)
+				}
+			default:
+				return false, nil, fmt.Errorf("%s: input %s has unknown type %s", path, input.Name, input.Type)
+			}
+			inputs = append(inputs, input)
+		}
+		slices.SortFunc(inputs, func(a, b Input) int { return strings.Compare(a.Name, b.Name) })
+		return true, inputs, nil
+	}
+	return false, nil, nil
+}
+
+// ResolveInputs checks the given values against the declared inputs and fills in the defaults
+func (wf *Workflow) ResolveInputs(given map[string]string) (map[string]string, []error) {
+	var errs []error
+	if !wf.Dispatch {
+		if len(given) > 0 {
+			errs = append(errs, fmt.Errorf("%s has no workflow_dispatch trigger, it takes no inputs", wf.Path))
+		}
+		return nil, errs
+	}
+	declared := make(map[string]Input, len(wf.Inputs))
+	for _, input := range wf.Inputs {
+		declared[input.Name] = input
+	}
+	for _, name := range slices.Sorted(maps.Keys(given)) {
+		if _, ok := declared[name]; !ok {
+			errs = append(errs, fmt.Errorf("%s declares no input %s", wf.Path, name))
+		}
+	}
+	resolved := make(map[string]string, len(wf.Inputs))
+	for _, input := range wf.Inputs {
+		value, ok := given[input.Name]
+		if !ok {
+			if input.Default == "" {
+				if input.Required {
+					errs = append(errs, fmt.Errorf("input %s is required", input.Name))
+				}
+				continue
+			}
+			value = input.Default
+		}
+		if err := input.check(value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved[input.Name] = value
+	}
+	return resolved, errs
+}
+
+func (input Input) check(value string) error {
+	switch input.Type {
+	case InputBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("input %s must be true or false, got %q", input.Name, value)
+		}
+	case InputNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("input %s must be a number, got %q", input.Name, value)
+		}
+	case InputChoice:
+		if !slices.Contains(input.Options, value) {
+			return fmt.Errorf(
+				"input %s must be one of %s, got %q", input.Name, strings.Join(input.Options, ", "), value,
+			)
+		}
+	}
+	return nil
+}
+
+// DispatchEvent is the event the inputs belong to, act runs the default one otherwise and inputs.* stay empty
+const DispatchEvent = "workflow_dispatch"
+
+// InputFlags turns the inputs into act arguments: the workflow_dispatch event and --input flags sorted by name
+func InputFlags(inputs map[string]string) []string {
+	if len(inputs) == 0 {
+		return nil
+	}
+	flags := []string{DispatchEvent}
+	for _, input := range InputList(inputs) {
+		flags = append(flags, "--input", input)
+	}
+	return flags
+}
+
+// InputList renders the inputs as name=value, sorted by name
+func InputList(inputs map[string]string) []string {
+	var list []string
+	for _, name := range slices.Sorted(maps.Keys(inputs)) {
+		list = append(list, name+"="+inputs[name])
+	}
+	return list
+}
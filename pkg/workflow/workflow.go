@@ -0,0 +1,184 @@
+package workflow
+
+import (
+	"ActQABot/conf"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Dir holds the workflows of a repository, /wf_start runs all of them when given the directory
+const Dir = ".github/workflows/"
+
+// DefaultPlatforms are the runs-on labels act maps out of the box, used for hosts without -P flags
+var DefaultPlatforms = []string{"ubuntu-latest", "ubuntu-24.04", "ubuntu-22.04", "ubuntu-20.04", "ubuntu-18.04"}
+
+type Job struct {
+	Id string
+	// runs-on labels, empty for reusable workflow calls; labels holding expressions are left out
+	RunsOn []string
+	Uses   string
+	Needs  []string
+}
+
+type Workflow struct {
+	Path string
+	Name string
+	Jobs []Job
+	// triggered by workflow_dispatch, which declares the inputs
+	Dispatch bool
+	Inputs   []Input
+}
+
+// IsWorkflowFile tells whether the path names a workflow file
+func IsWorkflowFile(path string) bool {
+	return strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml")
+}
+
+// Parse decodes the parts of a workflow the bot checks, it fails on what act would refuse to load
+func Parse(path string, data []byte) (*Workflow, error) {
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: invalid yaml: %w", path, err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("%s: empty workflow", path)
+	}
+	on, ok := raw["on"]
+	if !ok {
+		// YAML 1.1 reads an unquoted on as a boolean
+		if on, ok = raw[true]; !ok {
+			return nil, fmt.Errorf("%s: no on triggers", path)
+		}
+	}
+	wf := &Workflow{Path: path}
+	var err error
+	if wf.Dispatch, wf.Inputs, err = parseTriggers(path, on); err != nil {
+		return nil, err
+	}
+	wf.Name, _ = raw["name"].(string)
+	jobs, ok := raw["jobs"].(map[interface{}]interface{})
+	if !ok || len(jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", path)
+	}
+	for key, value := range jobs {
+		id := fmt.Sprint(key)
+		jobRaw, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: job %s is not a mapping", path, id)
+		}
+		job := Job{Id: id, RunsOn: runsOnLabels(jobRaw["runs-on"]), Needs: stringList(jobRaw["needs"])}
+		job.Uses, _ = jobRaw["uses"].(string)
+		if jobRaw["runs-on"] == nil && job.Uses == "" {
+			return nil, fmt.Errorf("%s: job %s has neither runs-on nor uses", path, id)
+		}
+		wf.Jobs = append(wf.Jobs, job)
+	}
+	slices.SortFunc(wf.Jobs, func(a, b Job) int { return strings.Compare(a.Id, b.Id) })
+	return wf, nil
+}
+
+// runsOnLabels accepts a label, a list of labels or a {group, labels} mapping
+func runsOnLabels(value interface{}) []string {
+	if runsOn, ok := value.(map[interface{}]interface{}); ok {
+		value = runsOn["labels"]
+	}
+	var labels []string
+	for _, label := range stringList(value) {
+		if !strings.Contains(label, "${{") {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
+
+// Validate reports the needs pointing to unknown jobs as errors, and the jobs no platform runs as warnings:
+// act skips those jobs. A workflow where no job can run is an error.
+func (wf *Workflow) Validate(platforms []string) (errs []error, warnings []string) {
+	ids := make(map[string]bool, len(wf.Jobs))
+	for _, job := range wf.Jobs {
+		ids[job.Id] = true
+	}
+	runnable := 0
+	for _, job := range wf.Jobs {
+		for _, need := range job.Needs {
+			if !ids[need] {
+				errs = append(errs, fmt.Errorf("%s: job %s needs unknown job %s", wf.Path, job.Id, need))
+			}
+		}
+		if len(job.RunsOn) == 0 || slices.ContainsFunc(job.RunsOn, func(label string) bool {
+			return slices.Contains(platforms, label)
+		}) {
+			runnable++
+			continue
+		}
+		warnings = append(
+			warnings, fmt.Sprintf(
+				"%s: job %s is skipped, the host has no platform for runs-on %s",
+				wf.Path, job.Id, strings.Join(job.RunsOn, ", "),
+			),
+		)
+	}
+	if runnable == 0 {
+		errs = append(
+			errs, fmt.Errorf("%s: no job can run on the host platforms %s", wf.Path, strings.Join(platforms, ", ")),
+		)
+	}
+	return errs, warnings
+}
+
+// HostPlatforms returns the runs-on labels the -P/--platform flags of the host map, act defaults without any
+func HostPlatforms(host conf.Host) []string {
+	platforms := map[string]bool{}
+	flags := host.CustomFlags
+	for i := 0; i < len(flags); i++ {
+		// docker options, where -P publishes the ports
+		if strings.HasPrefix(flags[i], "--container-options") {
+			if !strings.ContainsAny(flags[i], " =") {
+				i++
+			}
+			continue
+		}
+		fields := strings.Fields(flags[i])
+		for j := 0; j < len(fields); j++ {
+			var mapping string
+			switch field := fields[j]; {
+			case field == "-P" || field == "--platform":
+				if j+1 < len(fields) {
+					j++
+					mapping = fields[j]
+				} else if i+1 < len(flags) {
+					i++
+					mapping = strings.TrimSpace(flags[i])
+				}
+			case strings.HasPrefix(field, "-P="), strings.HasPrefix(field, "--platform="):
+				_, mapping, _ = strings.Cut(field, "=")
+			case strings.HasPrefix(field, "-P"):
+				mapping = strings.TrimPrefix(field, "-P")
+			}
+			if label, _, ok := strings.Cut(mapping, "="); ok && label != "" {
+				platforms[label] = true
+			}
+		}
+	}
+	if len(platforms) == 0 {
+		return DefaultPlatforms
+	}
+	return slices.Sorted(maps.Keys(platforms))
+}
@@ -4,6 +4,25 @@ import "ActQABot/conf"
 
 type StartJobHelpContext struct {
 	StartCommand string
+	RerunCommand string
+	ListCommand  string
+}
+
+// WorkflowInputRow is a declared workflow_dispatch input, cells are escaped already
+type WorkflowInputRow struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     string
+	Description string
+}
+
+// WorkflowHelpContext replaces the general help by the inputs of a workflow
+type WorkflowHelpContext struct {
+	Path     string
+	Ref      string
+	Dispatch bool
+	Inputs   []WorkflowInputRow
 }
 
 type HelpCmdContext struct {
@@ -12,6 +31,8 @@ type HelpCmdContext struct {
 	SupportedCommands []string
 	StartHelp         StartJobHelpContext
 	Hosts             *conf.HostsEnvironment
+	// set by /help WORKFLOW_PATH
+	Workflow *WorkflowHelpContext
 }
 
 func NewHelpCmdContext(
@@ -0,0 +1,72 @@
+package templates
+
+import (
+	"ActQABot/conf"
+	"strings"
+)
+
+// MatrixJobRow is a line of the matrix tables, a job that failed to schedule only has Error
+type MatrixJobRow struct {
+	Host  string
+	Axes  string
+	JobId string
+	Error string
+	// set once the job reported
+	Status         string
+	ReportText     string
+	LogExcerpt     string
+	LogExcerptKind string
+}
+
+// TableCell keeps s on a single markdown table cell
+func TableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+type MatrixStartContext struct {
+	MultilineGithubComment
+	MyDSN   string
+	GroupId string
+	Jobs    []MatrixJobRow
+}
+
+func NewMatrixStartContext(oldText []string, groupId string, jobs []MatrixJobRow) *MatrixStartContext {
+	var serverEnv conf.ServerEnvironment
+	conf.NewEnviron(&serverEnv)
+	tmpInit()
+
+	return &MatrixStartContext{
+		MultilineGithubComment: NewMultilineGithubComment(oldText, templateEnv.MatrixStartTemplate),
+		MyDSN:                  serverEnv.StreamDSN,
+		GroupId:                groupId,
+		Jobs:                   jobs,
+	}
+}
+
+func (c *MatrixStartContext) GenText() (string, error) {
+	return GenTextFromTemplate(c.tmplFile, c)
+}
+
+type MatrixReportContext struct {
+	MultilineGithubComment
+	GroupId string
+	Jobs    []MatrixJobRow
+}
+
+func NewMatrixReportContext(
+	initialCommand string, botInitialReply string, groupId string, jobs []MatrixJobRow,
+) *MatrixReportContext {
+	tmpInit()
+	return &MatrixReportContext{
+		MultilineGithubComment: NewMultilineGithubComment(
+			[]string{initialCommand, botInitialReply}, templateEnv.MatrixReportTemplate,
+		),
+		GroupId: groupId,
+		Jobs:    jobs,
+	}
+}
+
+func (c *MatrixReportContext) GenText() (string, error) {
+	return GenTextFromTemplate(c.tmplFile, c)
+}
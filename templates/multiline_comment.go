@@ -2,7 +2,7 @@ package templates
 
 import (
 	"bytes"
-	"github.com/golang/glog"
+	"log/slog"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -17,7 +17,7 @@ func tmpl(pth string) (func(data any) (string, error), error) {
 	if err != nil {
 		return nil, err
 	}
-	glog.V(1).Infof("Using path %s", tmpFilePath)
+	slog.Debug("using template", "path", tmpFilePath)
 
 	funcMap := template.FuncMap{
 		"splitLines": func(s string) []string {
@@ -0,0 +1,45 @@
+package templates
+
+import (
+	"ActQABot/conf"
+	"strings"
+)
+
+// Notification events
+const (
+	// the host accepted the job
+	NotificationJobStarted = "started"
+	// the worker report carrying the job status arrived
+	NotificationJobFinished = "finished"
+)
+
+type NotificationContext struct {
+	MultilineGithubComment
+	Event       string
+	Repository  string // "owner/repo"
+	IssueNumber int
+	Sender      string
+	Host        string
+	JobId       string
+	Status      string
+	Command     string
+	ReportText  string
+	MyDSN       string
+}
+
+func NewNotificationContext(event string) *NotificationContext {
+	var serverEnv conf.ServerEnvironment
+	conf.NewEnviron(&serverEnv)
+	tmpInit()
+	return &NotificationContext{
+		MultilineGithubComment: NewMultilineGithubComment(make([]string, 0), templateEnv.NotificationTemplate),
+		Event:                  event,
+		MyDSN:                  serverEnv.StreamDSN,
+	}
+}
+
+// GenText renders a chat message, without the surrounding blank lines of the comment layout
+func (c *NotificationContext) GenText() (string, error) {
+	txt, err := GenTextFromTemplate(c.tmplFile, c)
+	return strings.TrimSpace(txt), err
+}
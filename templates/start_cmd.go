@@ -11,6 +11,16 @@ type StartCmdContext struct {
 	MyDSN       string
 	JobHost     string
 	CustomFlags []string
+	// job re-run by this one, empty for /wf_start
+	RerunOf string
+	// schedule that started the job, empty for commands
+	Schedule string
+	// workflow problems found before scheduling
+	Warnings []string
+	// workflow_dispatch inputs as name=value
+	Inputs []string
+	// maximum duration after which the job is cancelled, empty when unlimited
+	Timeout string
 }
 
 func NewStartCmdContext(
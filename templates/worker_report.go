@@ -3,6 +3,9 @@ package templates
 type WorkerReportContext struct {
 	MultilineGithubComment
 	ReportText string
+	// collapsible failure section of the job log, empty when none was extracted
+	LogExcerpt     string
+	LogExcerptKind string
 }
 
 func NewWorkerReportContext(initialCommand string, botInitialReply string, textReport string) *WorkerReportContext {
@@ -0,0 +1,29 @@
+package templates
+
+// WorkflowRow is a workflow of the /wf_list table, Jobs is a cell already
+type WorkflowRow struct {
+	Path string
+	Name string
+	Jobs string
+}
+
+type WorkflowListContext struct {
+	MultilineGithubComment
+	Ref       string
+	Workflows []WorkflowRow
+	Problems  []string
+}
+
+func NewWorkflowListContext(oldText []string, ref string, workflows []WorkflowRow, problems []string) *WorkflowListContext {
+	tmpInit()
+	return &WorkflowListContext{
+		MultilineGithubComment: NewMultilineGithubComment(oldText, templateEnv.WorkflowListTemplate),
+		Ref:                    ref,
+		Workflows:              workflows,
+		Problems:               problems,
+	}
+}
+
+func (c *WorkflowListContext) GenText() (string, error) {
+	return GenTextFromTemplate(c.tmplFile, c)
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/container_policy"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/tests/mocks"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestContainerPolicy_Parse(t *testing.T) {
+	options, err := container_policy.Parse(
+		[]string{"-e", "A=1", "-eB=2", "--env=C=3", "--net", "host", "-it", "--privileged", "-m8g", "--shm-size", "1g"},
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t, []container_policy.Option{
+			{Flag: "--env", Value: "A=1"},
+			{Flag: "--env", Value: "B=2"},
+			{Flag: "--env", Value: "C=3"},
+			{Flag: "--network", Value: "host"},
+			{Flag: "--interactive"},
+			{Flag: "--tty"},
+			{Flag: "--privileged"},
+			{Flag: "--memory", Value: "8g"},
+			{Flag: "--shm-size", Value: "1g"},
+		}, options,
+	)
+
+	for _, invalid := range [][]string{{"-e"}, {"--shm-size"}, {"host"}, {"-Z", "x"}} {
+		_, err = container_policy.Parse(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestContainerPolicy_Default(t *testing.T) {
+	policy := &container_policy.DefaultPolicy
+	require.NoError(t, container_policy.Check("my-vm", policy, []string{"-e", "TEST_CASE=full", "--shm-size", "8g"}))
+
+	err := container_policy.Check(
+		"my-vm", policy, []string{"--privileged", "-v", "/:/host", "--net=host", "-e", "LD_PRELOAD=/tmp/x.so"},
+	)
+	var violation *container_policy.ViolationError
+	require.True(t, errors.As(err, &violation))
+	require.Equal(t, "my-vm", violation.Host)
+	require.Len(t, violation.Problems, 4)
+	require.Contains(t, err.Error(), "container options rejected by the policy of host my-vm")
+	require.Contains(t, err.Error(), "--privileged is not allowed")
+	require.Contains(t, err.Error(), "--volume is not allowed")
+	require.Contains(t, err.Error(), "--network is not allowed")
+	require.Contains(t, err.Error(), "env variable LD_PRELOAD is not allowed")
+}
+
+func TestContainerPolicy_Configured(t *testing.T) {
+	policy := &conf.ContainerPolicy{
+		DeniedFlags:   []string{"--privileged"},
+		AllowedMounts: []string{"/data/datasets"},
+		DeniedMounts:  []string{"/data/datasets/private"},
+		AllowedEnv:    []string{"TEST_*", "HF_HOME"},
+		Limits:        conf.ContainerLimits{Memory: "64g", ShmSize: "16g", Cpus: 16, Gpus: 2, Pids: 4096},
+	}
+	accepted := [][]string{
+		{"-v", "/data/datasets/imagenet:/data:ro"},
+		{"--mount", "type=bind,source=/data/datasets,target=/data"},
+		{"-v", "hf-cache:/root/.cache"},
+		{"--mount", "type=tmpfs,target=/tmp"},
+		{"-e", "TEST_CASE=a", "-e", "HF_HOME=/cache"},
+		{"-m", "64g", "--shm-size=8GiB", "--cpus", "15.5", "--gpus", "2", "--pids-limit", "100"},
+		{"--gpus", `"device=0,1"`},
+	}
+	for _, args := range accepted {
+		require.NoError(t, container_policy.Check("h200", policy, args), args)
+	}
+	rejected := map[string][]string{
+		"mounting /etc is not allowed":                   {"-v", "/etc:/host-etc"},
+		"mounting /data/datasets/private is not allowed": {"--mount", "type=bind,src=/data/datasets/private,dst=/p"},
+		"mounting /etc/shadow is not allowed":            {"-v", "/data/datasets/../../etc/shadow:/s"},
+		"must be an absolute path":                       {"-v", "./secrets:/s"},
+		"env variable PATH is not allowed":               {"-e", "PATH=/tmp"},
+		"--env HOME has no value, give HOME=value":       {"--env", "HOME"},
+		"--memory 65g exceeds the limit of 64g":          {"--memory", "65g"},
+		"--shm-size 1t exceeds the limit of 16g":         {"--shm-size", "1t"},
+		"--cpus 32 exceeds the limit of 16":              {"--cpus", "32"},
+		"--gpus all exceeds the limit of 2":              {"--gpus", "all"},
+		"--gpus count=3 exceeds the limit of 2":          {"--gpus", "count=3"},
+		"--pids-limit -1 exceeds the limit of 4096":      {"--pids-limit", "-1"},
+		"--privileged is not allowed":                    {"--privileged"},
+		"unexpected argument host, docker options start": {"--rm", "host"},
+	}
+	for message, args := range rejected {
+		err := container_policy.Check("h200", policy, args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), message, args)
+	}
+
+	// an allow list of flags rejects the rest
+	policy = &conf.ContainerPolicy{AllowedFlags: []string{"-e"}}
+	require.NoError(t, container_policy.Check("h200", policy, []string{"--env", "A=1"}))
+	require.ErrorContains(t, container_policy.Check("h200", policy, []string{"--shm-size", "1g"}), "--shm-size is not allowed")
+}
+
+func TestContainerPolicy_Validate(t *testing.T) {
+	hostsEnv := &conf.HostsEnvironment{
+		Hosts: map[string]conf.Host{"h200": {ContainerPolicy: &conf.ContainerPolicy{AllowedMounts: []string{"data"}}}},
+	}
+	require.ErrorContains(t, container_policy.Validate(hostsEnv), "host h200 container_policy")
+	hostsEnv.Hosts["h200"] = conf.Host{ContainerPolicy: &conf.ContainerPolicy{Limits: conf.ContainerLimits{Memory: "lots"}}}
+	require.ErrorContains(t, container_policy.Validate(hostsEnv), "invalid size lots")
+	hostsEnv.Hosts["h200"] = conf.Host{}
+	hostsEnv.DefaultContainerPolicy = &conf.ContainerPolicy{DeniedFlags: []string{"privileged"}}
+	require.ErrorContains(t, container_policy.Validate(hostsEnv), "default_container_policy")
+
+	// the host policy wins over the default one, which wins over the built-in one
+	own := &conf.ContainerPolicy{}
+	require.Same(t, own, container_policy.For(hostsEnv, conf.Host{ContainerPolicy: own}))
+	require.Same(t, hostsEnv.DefaultContainerPolicy, container_policy.For(hostsEnv, conf.Host{}))
+	require.Same(t, &container_policy.DefaultPolicy, container_policy.For(&conf.HostsEnvironment{}, conf.Host{}))
+
+	example, err := conf.NewHostsEnvironment("hosts.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, container_policy.Validate(example))
+}
+
+func TestContainerPolicy_RejectedBeforeScheduling(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	postMatrixComment(
+		t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --privileged -v /:/host", issues.StartJob),
+	)
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "container options rejected by the policy of host my-vm")
+	require.True(t, strings.Contains(reply, "--privileged is not allowed"), reply)
+	require.Empty(t, scheduled())
+
+	// the host policy replaces the default one
+	host := conf.Hosts.Hosts["gpu-2"]
+	host.ContainerPolicy = &conf.ContainerPolicy{AllowedMounts: []string{"/data"}}
+	conf.Hosts.Hosts["gpu-2"] = host
+	postMatrixComment(t, fmt.Sprintf("@bot %s gpu-2 some-commit .github/workflows/gpu.yml -v /data/x:/x", issues.StartJob))
+	awaitComment(t, commentPosted)
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	require.Equal(t, []string{"--container-options", "-v /data/x:/x"}, jobs[0].flags)
+}
+
+func TestContainerPolicy_ShellWords(t *testing.T) {
+	words, err := container_policy.SplitWords("-e 'A=1 2' --label \"x\\\"y\" -v\\ x --vol\"\"ume=/:/h a\\\nb")
+	require.NoError(t, err)
+	require.Equal(t, []string{"-e", "A=1 2", "--label", `x"y`, "-v x", "--volume=/:/h", "ab"}, words)
+	for _, invalid := range []string{`-e "A=1`, `-e 'A`, `-e A\`} {
+		_, err = container_policy.SplitWords(invalid)
+		require.Error(t, err, invalid)
+	}
+	for _, value := range []string{"main", "x --privileged", "it's", `a\b"c`, "", "$(id)"} {
+		words, err = container_policy.SplitWords("--label ref=" + container_policy.QuoteWord(value))
+		require.NoError(t, err)
+		require.Equal(t, []string{"--label", "ref=" + value}, words, value)
+	}
+}
+
+func TestContainerPolicy_CheckedAsActSplits(t *testing.T) {
+	policy := &container_policy.DefaultPolicy
+	// the comment is split on spaces, act splits the joined options again as shell words
+	bypasses := map[string]string{
+		"-e X=1\t--privileged":              "--privileged is not allowed",
+		"--label a\n--volume=/:/host":       "--volume is not allowed",
+		"--label \"a\n--volume=/:/host\"":   "control characters",
+		`--vol""ume=/:/host`:                "--volume is not allowed",
+		`--privi'leged'`:                    "--privileged is not allowed",
+		"-e 'A=1":                           "unterminated quote",
+		`-e "LD_PRELOAD=/tmp/x.so"`:         "env variable LD_PRELOAD is not allowed",
+		"--label x\\\n --privileged --rm":   "--privileged is not allowed",
+		"-e A=1 --cap-add\\=SYS_ADMIN --rm": "--cap-add is not allowed",
+	}
+	for options, message := range bypasses {
+		require.ErrorContains(
+			t, container_policy.CheckContainerOptions("my-vm", policy, options, nil), message, options,
+		)
+	}
+	require.NoError(t, container_policy.CheckContainerOptions("my-vm", policy, `-e "A=1 2" --label 'k=v w'`, nil))
+	// an escaped newline joins the lines: a label value, not an option
+	require.NoError(t, container_policy.CheckContainerOptions("my-vm", policy, "--label x\\\n--privileged", nil))
+
+	// the options written by the operator are exempt, a second occurrence isn't
+	trusted := []string{"-v", "/cache/owner-repo:/cache", "--label", "run=1"}
+	require.NoError(
+		t, container_policy.CheckContainerOptions(
+			"my-vm", policy, "-v /cache/other:/cache --label run=2 -e A=1", trusted,
+		),
+	)
+	require.ErrorContains(
+		t, container_policy.CheckContainerOptions(
+			"my-vm", policy, "-v /cache/other:/cache --label run=2 -v /:/host", trusted,
+		), "--volume is not allowed",
+	)
+}
+
+func TestContainerPolicy_BypassesRejectedBeforeScheduling(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	for _, options := range []string{"-e X=1\t--privileged", "--label a\n--volume=/:/host", `--vol""ume=/:/host`} {
+		postMatrixComment(
+			t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml %s", issues.StartJob, options),
+		)
+		require.Contains(
+			t, awaitComment(t, commentPosted), "container options rejected by the policy of host my-vm", options,
+		)
+	}
+	require.Empty(t, scheduled())
+}
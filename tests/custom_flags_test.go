@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/container_policy"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/hosts"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCustomFlags_Render(t *testing.T) {
+	host := conf.Host{
+		CustomFlags: []string{
+			"--container-options",
+			"-v /cache/{{ slug .Repository }}:/cache --name pr-{{ .Issue }}-{{ .RunId }}",
+			"--env=SENDER={{ .Sender }}@{{ .Host }}",
+			"--env=REF={{ slug .Ref }}",
+		},
+	}
+	flags, err := hosts.RenderCustomFlags(
+		"my-vm", host, hosts.FlagContext{
+			Repository: "owner/repo", Issue: 7, Sender: "user", Host: "my-vm", Ref: "../../etc", RunId: "run",
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t, []string{
+			"--container-options", "-v /cache/owner-repo:/cache --name pr-7-run", "--env=SENDER=user@my-vm", "--env=REF=etc",
+		}, flags,
+	)
+}
+
+func TestCustomFlags_Validate(t *testing.T) {
+	invalid := map[string]string{
+		"unknown variable .JobId":    "--label job={{ .JobId }}",
+		"unknown variable .Sender.X": "--label {{ .Sender.X }}",
+		// skipped by the sample rendering, still rejected
+		"unknown variable .Branch":       "{{ if .Ref }}{{ .Commit }}{{ else }}{{ .Branch }}{{ end }}",
+		"host my-vm custom_flags[1]":     "{{ .Repository",
+		"function \"upper\" not defined": "{{ upper .Repo }}",
+	}
+	for message, flag := range invalid {
+		hostsEnv := &conf.HostsEnvironment{Hosts: map[string]conf.Host{"my-vm": {CustomFlags: []string{"--rm", flag}}}}
+		require.ErrorContains(t, hosts.ValidateCustomFlags(hostsEnv), message, flag)
+	}
+
+	hostsEnv := &conf.HostsEnvironment{
+		Hosts: map[string]conf.Host{"my-vm": {CustomFlags: []string{"{{ with .Workflow }}{{ . }}{{ end }}", "--rm"}}},
+	}
+	require.NoError(t, hosts.ValidateCustomFlags(hostsEnv))
+
+	example, err := conf.NewHostsEnvironment("hosts.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, hosts.ValidateCustomFlags(example))
+}
+
+func TestCustomFlags_RenderedAtSchedule(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	conf.Hosts.Hosts["gpu-2"] = conf.Host{
+		Address: "yyy:50051", MaxConcurrency: 1,
+		CustomFlags: []string{"--container-options", "--label run={{ .RunId }} --label by={{ .Sender }}"},
+	}
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s gpu-2 some-commit .github/workflows/gpu.yml -e A=1", issues.StartJob))
+	awaitComment(t, commentPosted)
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	spec, err := worker_report.GetJobSpec(context.Background(), jobs[0].jobId)
+	require.NoError(t, err)
+	require.NotEmpty(t, spec.RunId)
+	// the user options are appended to the rendered ones
+	require.Equal(
+		t, []string{"--container-options", fmt.Sprintf("--label run=%s --label by=test-user -e A=1", spec.RunId)},
+		jobs[0].flags,
+	)
+}
+
+func TestCustomFlags_HostileValuesStayQuoted(t *testing.T) {
+	host := conf.Host{
+		CustomFlags: []string{
+			"--container-options=--label ref={{ .Ref }} --label wf={{ slug .Workflow }}", "--env=REF={{ .Ref }}",
+		},
+	}
+	flags, err := hosts.RenderCustomFlags(
+		"gpu-2", host, hosts.FlagContext{Ref: "x --privileged", Workflow: ".github/workflows/gpu.yml"},
+	)
+	require.NoError(t, err)
+	// only the --container-options value is split again by act
+	require.Equal(
+		t, []string{"--container-options=--label ref='x --privileged' --label wf=github-workflows-gpu.yml", "--env=REF=x --privileged"},
+		flags,
+	)
+	value, ok := hosts.ContainerOptions(flags)
+	require.True(t, ok)
+	trusted, err := hosts.TrustedContainerOptions(
+		"gpu-2", host, hosts.FlagContext{Ref: "x --privileged", Workflow: ".github/workflows/gpu.yml"},
+	)
+	require.NoError(t, err)
+	require.NoError(t, container_policy.CheckContainerOptions("gpu-2", &container_policy.DefaultPolicy, value, trusted))
+	words, err := container_policy.SplitWords(value)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--label", "ref=x --privileged", "--label", "wf=github-workflows-gpu.yml"}, words)
+}
+
+func TestCustomFlags_TrustedForTheJob(t *testing.T) {
+	host := conf.Host{
+		CustomFlags: []string{
+			"--container-options={{ if eq .Repo \"cache\" }}-v /cache/{{ .Repo }}:/cache {{ end }}--label run={{ .RunId }}",
+		},
+	}
+	// a branch this job doesn't take exempts no user option
+	flagCtx := hosts.FlagContext{Repo: "repo", RunId: "1"}
+	flags, err := hosts.RenderCustomFlags("gpu-2", host, flagCtx)
+	require.NoError(t, err)
+	value, ok := hosts.ContainerOptions(flags)
+	require.True(t, ok)
+	trusted, err := hosts.TrustedContainerOptions("gpu-2", host, flagCtx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--label", "run=value"}, trusted)
+	require.ErrorContains(
+		t, container_policy.CheckContainerOptions(
+			"gpu-2", &container_policy.DefaultPolicy, value+" -v /:/host", trusted,
+		), "--volume is not allowed",
+	)
+
+	// the operator's own -v is exempt when the job takes the branch
+	flagCtx.Repo = "cache"
+	trusted, err = hosts.TrustedContainerOptions("gpu-2", host, flagCtx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"-v", "/cache/value:/cache", "--label", "run=value"}, trusted)
+
+	// a printed value never becomes a trusted option
+	host.CustomFlags = []string{"--container-options", "--label a {{ .Sender }}"}
+	trusted, err = hosts.TrustedContainerOptions("gpu-2", host, hosts.FlagContext{Sender: "--privileged"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"--label", "a", "value"}, trusted)
+}
+
+func TestCustomFlags_HostileRefAtSchedule(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	conf.Hosts.Hosts["gpu-2"] = conf.Host{
+		Address: "yyy:50051", MaxConcurrency: 1,
+		CustomFlags: []string{"--container-options=--label ref={{ .Ref }}"},
+	}
+
+	// a scheduled ref may hold spaces, it stays a label value
+	_, err := issues.StartScheduled(
+		context.Background(), issues.ScheduledStart{
+			Schedule: "nightly", Repository: "owner/repo", Ref: "x --privileged", Workflow: ".github/workflows/gpu.yml",
+			Host: "gpu-2", TrackingIssue: 42,
+		},
+	)
+	require.NoError(t, err)
+	awaitComment(t, commentPosted)
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	// the user options, none here, are appended after a space
+	require.Equal(t, []string{"--container-options=--label ref='x --privileged' "}, jobs[0].flags)
+
+	// the comment can't hold a space in the ref, a tab would split it without the policy
+	postMatrixComment(t, fmt.Sprintf("@bot %s gpu-2 x\t--privileged .github/workflows/gpu.yml", issues.StartJob))
+	require.Contains(t, awaitComment(t, commentPosted), "container options rejected by the policy of host gpu-2")
+	require.Len(t, scheduled(), 1)
+
+	// a value printed as a whole option isn't the operator's, the policy applies
+	conf.Hosts.Hosts["gpu-2"] = conf.Host{
+		Address: "yyy:50051", MaxConcurrency: 1, CustomFlags: []string{"--container-options", "{{ .Ref }}"},
+	}
+	_, err = issues.StartScheduled(
+		context.Background(), issues.ScheduledStart{
+			Schedule: "nightly", Repository: "owner/repo", Ref: "--privileged", Workflow: ".github/workflows/gpu.yml",
+			Host: "gpu-2", TrackingIssue: 42,
+		},
+	)
+	require.ErrorContains(t, err, "--privileged is not allowed")
+	require.Len(t, scheduled(), 1)
+}
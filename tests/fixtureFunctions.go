@@ -17,6 +17,7 @@ func setupTestEnv(t *testing.T) {
 	t.Setenv("HOST_CONF", "hosts.example.yaml")
 	t.Setenv("GITHUB_TOKEN", "test-token")
 	conf.NewEnviron(&conf.GeneralEnvironments)
+	conf.NewEnviron(&conf.LogExcerptEnv)
 
 	var err error
 	conf.Hosts, err = conf.NewHostsEnvironment(conf.GeneralEnvironments.HostConf)
@@ -3,13 +3,23 @@ package tests
 import (
 	"ActQABot/conf"
 	"ActQABot/pkg/github/gh_api"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-github/v60/github"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -24,11 +34,16 @@ func TestAuthForRepo(t *testing.T) {
 	tmpFile := t.TempDir() + "/mock.key"
 	generateRSAPrivateKeyPEM(t, tmpFile, 2048)
 	mux := http.NewServeMux()
+	var installationCalls, tokenCalls atomic.Int32
+	var shortLived atomic.Bool
+	// answer of access_tokens for the cached installation
+	var staleStatus atomic.Int32
 
 	mux.HandleFunc(
 		fmt.Sprintf("/api/v3/repos/%s/%s/installation", testOwner, testRepo),
 		func(w http.ResponseWriter, r *http.Request) {
 			require.Equal(t, "Bearer test-jwt", r.Header.Get("Authorization"))
+			installationCalls.Add(1)
 			w.WriteHeader(http.StatusOK)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"id": expectedInstall,
@@ -39,10 +54,20 @@ func TestAuthForRepo(t *testing.T) {
 		fmt.Sprintf("/api/v3/app/installations/%d/access_tokens", expectedInstall),
 		func(w http.ResponseWriter, r *http.Request) {
 			require.Equal(t, "Bearer test-jwt", r.Header.Get("Authorization"))
+			tokenCalls.Add(1)
+			if status := staleStatus.Swap(0); status != 0 {
+				w.WriteHeader(int(status))
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"message": http.StatusText(int(status))})
+				return
+			}
+			expiresIn := time.Hour
+			if shortLived.Load() {
+				expiresIn = time.Minute
+			}
 			w.WriteHeader(http.StatusCreated)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"token":      expectedToken,
-				"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+				"expires_at": time.Now().Add(expiresIn).Format(time.RFC3339),
 			})
 		},
 	)
@@ -50,8 +75,10 @@ func TestAuthForRepo(t *testing.T) {
 	origJWTGen := gh_api.GenerateJWTToken
 	origGHClientConstructor := gh_api.GHClientConstructor
 	server := httptest.NewServer(mux)
+	gh_api.ResetAuthCache()
 	t.Cleanup(func() {
 		server.Close()
+		gh_api.ResetAuthCache()
 		gh_api.GenerateJWTToken = origJWTGen
 		gh_api.GHClientConstructor = origGHClientConstructor
 	})
@@ -61,16 +88,142 @@ func TestAuthForRepo(t *testing.T) {
 		PrivateKeyPath: tmpFile,
 	}
 
-	gh_api.GenerateJWTToken = func(privateKey *rsa.PrivateKey, appID string) (string, error) {
+	gh_api.GenerateJWTToken = func(signer gh_api.JWTSigner, appID string) (string, error) {
 		return "test-jwt", nil
 	}
-	gh_api.GHClientConstructor = func(client *http.Client) *github.Client {
-		cl, err := github.NewClient(client).WithEnterpriseURLs(server.URL+"/", server.URL+"/")
-		require.NoError(t, err)
-		return cl
+	gh_api.GHClientConstructor = func(_ conf.GithubAPIEnvironment, client *http.Client) (*github.Client, error) {
+		return github.NewClient(client).WithEnterpriseURLs(server.URL+"/", server.URL+"/")
 	}
 	authorize, err := gh_api.Authorize(ghEnv, testOwner, testRepo)
 	require.NoError(t, err)
 	require.NotNil(t, authorize)
 	require.Equal(t, expectedToken, *authorize.Token)
+
+	// cached until expiry
+	authorize, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	require.Equal(t, expectedToken, *authorize.Token)
+	require.Equal(t, int32(1), installationCalls.Load())
+	require.Equal(t, int32(1), tokenCalls.Load())
+
+	// a token close to expiry is minted again; a vanished installation is looked up again after the 404
+	gh_api.ResetAuthCache()
+	shortLived.Store(true)
+	_, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	staleStatus.Store(http.StatusNotFound)
+	authorize, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	require.Equal(t, expectedToken, *authorize.Token)
+	require.Equal(t, int32(3), installationCalls.Load())
+	require.Equal(t, int32(4), tokenCalls.Load())
+
+	// a suspended installation is looked up again as well
+	staleStatus.Store(http.StatusForbidden)
+	_, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	require.Equal(t, int32(4), installationCalls.Load())
+	require.Equal(t, int32(6), tokenCalls.Load())
+
+	// the repository may have moved to another installation: looked up again past the TTL
+	gh_api.ResetAuthCache()
+	shortLived.Store(false)
+	ghEnv.InstallationIdTTL = 50 * time.Millisecond
+	_, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	_, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	require.Equal(t, int32(5), installationCalls.Load())
+	time.Sleep(100 * time.Millisecond)
+	_, err = gh_api.Authorize(ghEnv, testOwner, testRepo)
+	require.NoError(t, err)
+	require.Equal(t, int32(6), installationCalls.Load())
+}
+
+func TestGenerateJWT_KeyFormatsAndSigners(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	generateJWT := gh_api.GenerateJWTToken
+	verify := func(t *testing.T, signer gh_api.JWTSigner) {
+		t.Helper()
+		signed, err := generateJWT(signer, "42")
+		require.NoError(t, err)
+		parsed, err := jwt.ParseWithClaims(
+			signed, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+				return &privateKey.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}),
+		)
+		require.NoError(t, err)
+		issuer, err := parsed.Claims.GetIssuer()
+		require.NoError(t, err)
+		require.Equal(t, "42", issuer)
+	}
+
+	for name, encoded := range map[string]string{
+		"pkcs8 pem":        string(pkcs8PEM),
+		"pkcs8 pem base64": base64.StdEncoding.EncodeToString(pkcs8PEM),
+		"pkcs8 der base64": base64.StdEncoding.EncodeToString(pkcs8),
+		"pkcs1 pem": string(
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}),
+		),
+	} {
+		t.Run(
+			name, func(t *testing.T) {
+				parsed, err := gh_api.ParsePrivateKey([]byte(encoded))
+				require.NoError(t, err)
+				require.True(t, parsed.Equal(privateKey))
+				verify(t, gh_api.KeySigner{Key: parsed})
+			},
+		)
+	}
+
+	t.Run(
+		"signer command", func(t *testing.T) {
+			if _, err := exec.LookPath("openssl"); err != nil {
+				t.Skip("openssl is not installed")
+			}
+			// the program and its arguments contain spaces
+			dir := filepath.Join(t.TempDir(), "kms tools")
+			require.NoError(t, os.Mkdir(dir, 0o700))
+			keyPath := filepath.Join(dir, "app key.pem")
+			require.NoError(t, os.WriteFile(keyPath, pkcs8PEM, 0o600))
+			script := filepath.Join(dir, "sign.sh")
+			require.NoError(
+				t, os.WriteFile(script, []byte("#!/bin/sh\nopenssl dgst -sha256 -sign \"$1\" | base64\n"), 0o700),
+			)
+			command, err := json.Marshal([]string{script, keyPath})
+			require.NoError(t, err)
+			gh_api.ResetAuthCache()
+			t.Cleanup(gh_api.ResetAuthCache)
+			t.Cleanup(func() { gh_api.GenerateJWTToken = generateJWT })
+			gh_api.GenerateJWTToken = func(signer gh_api.JWTSigner, appID string) (string, error) {
+				verify(t, signer)
+				return "", errors.New("stop after signing")
+			}
+			_, err = gh_api.Authorize(
+				conf.GithubAPIEnvironment{AppID: "42", SignerCommand: string(command), SignerTimeout: 10 * time.Second},
+				"owner", "repo",
+			)
+			require.EqualError(t, err, "stop after signing")
+		},
+	)
+}
+
+func TestParseSignerCommand(t *testing.T) {
+	for value, expected := range map[string][]string{
+		"/usr/bin/sign --key app":            {"/usr/bin/sign", "--key", "app"},
+		`["/opt/kms tools/sign", "app key"]`: {"/opt/kms tools/sign", "app key"},
+	} {
+		command, err := gh_api.ParseSignerCommand(value)
+		require.NoError(t, err)
+		require.Equal(t, expected, command)
+	}
+	for _, value := range []string{`["/opt/sign"`, `[]`} {
+		_, err := gh_api.ParseSignerCommand(value)
+		require.Error(t, err, value)
+	}
 }
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGithubClient_EnterpriseComments(t *testing.T) {
+	var rateLimited bool
+	mux := http.NewServeMux()
+	mux.HandleFunc(
+		"POST /api/v3/repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "Bearer inst-token", r.Header.Get("Authorization"))
+			if rateLimited {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": "API rate limit exceeded"})
+				return
+			}
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "hello", body["body"])
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "body": body["body"]})
+		},
+	)
+	mux.HandleFunc(
+		"PATCH /api/v3/repos/owner/repo/issues/comments/5", func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "edited", body["body"])
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 5, "body": body["body"]})
+		},
+	)
+	server := httptest.NewServer(mux)
+	origEnv := conf.GithubEnvironment
+	t.Cleanup(
+		func() {
+			server.Close()
+			conf.GithubEnvironment = origEnv
+		},
+	)
+	conf.GithubEnvironment = conf.GithubAPIEnvironment{
+		BaseURL:        server.URL + "/api/v3/",
+		Timeout:        5 * time.Second,
+		CloneURLFormat: "https://github.example.com/%s.git",
+	}
+
+	resp := &gh_api.BotResponse{Owner: "owner", Repo: "repo", IssueNumber: 7, Text: "hello"}
+	require.NoError(t, gh_api.PostIssueCommentFunc(resp, "inst-token"))
+
+	rateLimited = true
+	err := gh_api.PostIssueCommentFunc(resp, "inst-token")
+	var apiErr *forge.APIError
+	require.True(t, errors.As(err, &apiErr), "unexpected error %v", err)
+	require.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	require.Greater(t, apiErr.RetryAfter, 30*time.Second)
+
+	commentId := 5
+	require.NoError(
+		t,
+		gh_api.UpdateIssueComment(
+			gh_api.BotResponse{Owner: "owner", Repo: "repo", CommentId: &commentId, Text: "edited"}, "inst-token",
+		),
+	)
+
+	require.Equal(
+		t,
+		"https://github.example.com/owner/repo.git",
+		gh_api.CloneURL(conf.GithubEnvironment, "owner/repo"),
+	)
+}
+
+func TestGithubClient_UsesGivenEnvironment(t *testing.T) {
+	origEnv := conf.GithubEnvironment
+	t.Cleanup(func() { conf.GithubEnvironment = origEnv })
+	conf.GithubEnvironment = conf.GithubAPIEnvironment{BaseURL: "https://api.github.com/"}
+
+	client, err := gh_api.NewClient(
+		conf.GithubAPIEnvironment{BaseURL: "https://github.example.com/api/v3/", Timeout: time.Second}, "token",
+	)
+	require.NoError(t, err)
+	require.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+
+	// no silent fallback to the public API
+	_, err = gh_api.NewClient(conf.GithubAPIEnvironment{BaseURL: "https://github.example.com:port/"}, "token")
+	require.ErrorContains(t, err, "GITHUB_API_URL")
+}
@@ -3,6 +3,7 @@ package tests
 import (
 	"ActQABot/api/github_api"
 	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/storage"
 	"ActQABot/pkg/worker_report"
 	"ActQABot/tests/mocks"
 	"bytes"
@@ -67,7 +68,7 @@ func TestWebhookHandler_IssueCommentCreated_Help(t *testing.T) {
 
 func TestWebhookHandler_IssueCommentCreated_StartJob(t *testing.T) {
 	setupTestEnv(t)
-	mocked := mocks.MockGithubMetaEtcd(mocks.MockForGithubMetaEtcd{})
+	mocks.StorageFixture(t)
 	commentPosted := mocks.PostIssueCommentFixture(t)
 	mocks.GrpcConnFixture(t)
 	payload := mocks.IssueCommentPayload{
@@ -124,8 +125,8 @@ func TestWebhookHandler_IssueCommentCreated_StartJob(t *testing.T) {
 		require.Condition(
 			t,
 			func() bool {
-				ser, ok := mocked.Jobs[jobId]
-				if !ok {
+				ser := mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+jobId)
+				if ser == nil {
 					return false
 				}
 				var deser worker_report.GithubIssueMeta
@@ -138,7 +139,7 @@ func TestWebhookHandler_IssueCommentCreated_StartJob(t *testing.T) {
 					deser.Host == "my-vm" &&
 					deser.Sender == "test-user" &&
 					*deser.JobId == jobId &&
-					*deser.MyLeaseID == *mocked.LastLease
+					deser.MyLeaseID != nil && *deser.MyLeaseID != storage.NoLease
 			},
 		)
 	case <-time.After(time.Second * 2):
@@ -149,7 +150,7 @@ func TestWebhookHandler_IssueCommentCreated_StartJob(t *testing.T) {
 
 func TestWebhookHandler_IssueCommentCreated_StartJob_Error(t *testing.T) {
 	setupTestEnv(t)
-	mocks.MockGithubMetaEtcd(mocks.MockForGithubMetaEtcd{}) // void
+	mocks.StorageFixture(t)
 	commentPosted := mocks.PostIssueCommentFixture(t)
 	mocks.GrpcConnFixture(t)
 	payload := mocks.IssueCommentPayload{
@@ -198,7 +199,7 @@ func TestWebhookHandler_IssueCommentCreated_StartJob_Error(t *testing.T) {
 
 func TestWebhookHandler_IssueCommentCreated_StartJob_NoError(t *testing.T) {
 	setupTestEnv(t)
-	mocks.MockGithubMetaEtcd(mocks.MockForGithubMetaEtcd{}) // void
+	mocks.StorageFixture(t)
 
 	commentPosted := mocks.PostIssueCommentFixture(t)
 	mocks.GrpcConnFixture(t)
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"ActQABot/api/gitlab_api"
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/issues"
+	_ "ActQABot/pkg/gitlab/gl_api"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const gitlabResolvedSHA = "0123456789abcdef0123456789abcdef01234567"
+
+func gitlabNotePayload(t *testing.T, note string) []byte {
+	t.Helper()
+	payload := map[string]interface{}{
+		"object_kind": "note",
+		"user":        map[string]string{"username": "gl-user"},
+		"project":     map[string]string{"path_with_namespace": "group/sub/project"},
+		"object_attributes": map[string]interface{}{
+			"id": 11, "note": note, "noteable_type": "MergeRequest", "action": "create",
+		},
+		"merge_request": map[string]int{"iid": 3},
+	}
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return body
+}
+
+func TestGitlabWebhook_NoteStartsJob(t *testing.T) {
+	setupTestEnv(t)
+	mocks.OutboxFixture(t)
+	mocks.GrpcConnFixture(t)
+	mocks.StorageFixture(t)
+
+	notes := make(chan string, 1)
+	resolved := make(chan string, 1)
+	gitlab := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "gl-token", r.Header.Get("PRIVATE-TOKEN"))
+				switch fmt.Sprintf("%s %s", r.Method, r.URL.EscapedPath()) {
+				case "GET /api/v4/projects/group%2Fsub%2Fproject/repository/commits/some-branch":
+					resolved <- gitlabResolvedSHA
+					_ = json.NewEncoder(w).Encode(map[string]string{"id": gitlabResolvedSHA})
+				case "GET /api/v4/projects/group%2Fsub%2Fproject/repository/tree":
+					require.Equal(t, ".github/workflows", r.URL.Query().Get("path"))
+					require.Equal(t, gitlabResolvedSHA, r.URL.Query().Get("ref"))
+					_ = json.NewEncoder(w).Encode(
+						[]map[string]string{
+							{"path": ".github/workflows/ci.yml", "type": "blob"},
+							{"path": ".github/workflows/README.md", "type": "blob"},
+						},
+					)
+				case "GET /api/v4/projects/group%2Fsub%2Fproject/repository/files/.github%2Fworkflows%2Fci.yml":
+					_ = json.NewEncoder(w).Encode(
+						map[string]string{
+							"encoding": "base64",
+							"content":  base64.StdEncoding.EncodeToString([]byte(mocks.DefaultWorkflow)),
+						},
+					)
+				case "POST /api/v4/projects/group%2Fsub%2Fproject/merge_requests/3/notes":
+					var body map[string]string
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					notes <- body["body"]
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 12, "body": body["body"]})
+				default:
+					t.Errorf("unexpected GitLab call %s %s", r.Method, r.URL.EscapedPath())
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+		),
+	)
+	origEnv := conf.GitlabEnvironment
+	t.Cleanup(
+		func() {
+			gitlab.Close()
+			conf.GitlabEnvironment = origEnv
+		},
+	)
+	conf.GitlabEnvironment = conf.GitlabAPIEnvironment{
+		URL:            gitlab.URL,
+		Token:          "gl-token",
+		WebhookToken:   "hook-secret",
+		Timeout:        5 * time.Second,
+		CloneURLFormat: "https://gitlab.example.com/%s.git",
+	}
+	router := gitlab_api.Router()
+
+	body := gitlabNotePayload(t, fmt.Sprintf("@bot %s my-vm some-branch", issues.StartJob))
+	req := httptest.NewRequest(http.MethodPost, "/events/", bytes.NewBuffer(body))
+	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/events/", bytes.NewBuffer(body))
+	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	req.Header.Set("X-Gitlab-Token", "hook-secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case sha := <-resolved:
+		require.Equal(t, gitlabResolvedSHA, sha)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ref was not resolved through GitLab")
+	}
+	var reply string
+	select {
+	case reply = <-notes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("merge request note timeout")
+	}
+	jobId := regexp.MustCompile("job_id=(.*)").FindStringSubmatch(reply)[1]
+	var meta worker_report.GithubIssueMeta
+	require.NoError(t, json.Unmarshal(mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+jobId), &meta))
+	require.Equal(t, forge.GitLab, meta.Forge)
+	require.Equal(t, "group/sub", meta.Owner)
+	require.Equal(t, "project", meta.Repository)
+	require.Equal(t, 3, meta.IssueId)
+	require.Equal(t, "gl-user", meta.Sender)
+	require.Equal(t, "my-vm", meta.Host)
+}
@@ -4,11 +4,8 @@ import (
 	"ActQABot/pkg/worker_report"
 	"ActQABot/tests/mocks"
 	"context"
-	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
-	"go.etcd.io/etcd/api/v3/mvccpb"
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"strings"
 	"testing"
 	"time"
@@ -18,15 +15,7 @@ func Test_JobReportsConsumer(t *testing.T) {
 	bg, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	setupTestEnv(t)
-	reportMocks := mocks.MockWorkerReportEtcd(nil, nil)
-	reportMockChannelGet := func(ctx context.Context, rev int64) worker_report.WatchWorkerReport {
-		return reportMocks.WorkerReportEventChannel
-	}
-	_ = mocks.MockGithubMetaEtcd(
-		mocks.MockForGithubMetaEtcd{
-			MockJobReportWatchFunc: &reportMockChannelGet,
-		},
-	)
+	mocks.StorageFixture(t)
 	commentPosted := mocks.PostIssueCommentFixture(t)
 	subscribed, err := worker_report.SubscribeJobReports(bg)
 	if err != nil {
@@ -47,29 +36,12 @@ func Test_JobReportsConsumer(t *testing.T) {
 		JobId:             &jobId,
 	}
 	report := worker_report.JobReport{JobId: jobId, JobReportText: "Some text"}
-	serializedReport, err := json.Marshal(report)
-	if err != nil {
-		t.Errorf("Failed to serilize report!")
-	}
 	if err = newJobMeta.Store(t.Context(), *newJobMeta.JobId, 1); err != nil {
 		t.Errorf("Error storing job report: %v", err)
 	}
 
-	if err = reportMocks.WorkerReportEventChannel.PushResponse(
-		bg,
-		&clientv3.WatchResponse{
-			Events: []*clientv3.Event{
-				{
-					Type: clientv3.EventTypePut,
-					Kv: &mvccpb.KeyValue{
-						Key:   []byte(jobId),
-						Value: serializedReport,
-					},
-				},
-			},
-		},
-	); err != nil {
-		t.Errorf("Error pushing event: %v", err)
+	if err = report.SendEvent(bg); err != nil {
+		t.Errorf("Error sending report: %v", err)
 	}
 	t.Log("Pushed a report")
 
@@ -88,28 +60,17 @@ func Test_JobReportsConsumer(t *testing.T) {
 			},
 		)
 	}
+	// acked reports leave the queue
+	require.Eventually(
+		t, func() bool {
+			return len(mocks.StoredKeys(t, string(worker_report.JobReportChannel))) == 0
+		}, time.Second, 10*time.Millisecond,
+	)
 	// no job created
 	jobId = uuid.New().String()
 	report = worker_report.JobReport{JobId: jobId, JobReportText: "Some text"}
-	serializedReport, err = json.Marshal(report)
-	if err != nil {
-		t.Errorf("Failed to serilize report!")
-	}
-	if err = reportMocks.WorkerReportEventChannel.PushResponse(
-		bg,
-		&clientv3.WatchResponse{
-			Events: []*clientv3.Event{
-				{
-					Type: clientv3.EventTypePut,
-					Kv: &mvccpb.KeyValue{
-						Key:   []byte(jobId),
-						Value: serializedReport,
-					},
-				},
-			},
-		},
-	); err != nil {
-		t.Errorf("Error pushing event: %v", err)
+	if err = report.SendEvent(bg); err != nil {
+		t.Errorf("Error sending report: %v", err)
 	}
 	select {
 	case <-t.Context().Done():
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/conf"
+	"ActQABot/pkg/leader"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func leaderStatus(t *testing.T) leader.Status {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/leader", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	admin_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status leader.Status
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	return status
+}
+
+func awaitTerm(t *testing.T, terms <-chan context.Context) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-terms:
+		return ctx
+	case <-time.After(2 * time.Second):
+		t.Fatal("leader work did not start")
+	}
+	return nil
+}
+
+func TestLeader_FailoverAndStatus(t *testing.T) {
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	elections := mocks.LeaderElectionFixture(t)
+	elections.SetLeader("replica-b")
+
+	terms := make(chan context.Context, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leader.Run(
+			ctx, conf.HAEnvironment{Enabled: true, ReplicaId: "replica-a", RetryInterval: 10 * time.Millisecond},
+			func(ctx context.Context) {
+				terms <- ctx
+				<-ctx.Done()
+			},
+		)
+	}()
+
+	// follower: webhooks only, the other replica processes reports
+	require.Eventually(
+		t, func() bool { return leaderStatus(t).Leader == "replica-b" }, 2*time.Second, 10*time.Millisecond,
+	)
+	status := leaderStatus(t)
+	require.True(t, status.Enabled)
+	require.Equal(t, "replica-a", status.ReplicaId)
+	require.False(t, status.IsLeader)
+	require.Empty(t, terms)
+
+	// the other replica resigns
+	elections.SetLeader("")
+	first := awaitTerm(t, terms)
+	status = leaderStatus(t)
+	require.True(t, status.IsLeader)
+	require.Equal(t, "replica-a", status.Leader)
+	require.NotNil(t, status.LeaderSince)
+
+	// the session is lost: work stops and the replica campaigns again
+	elections.ExpireSessions()
+	select {
+	case <-first.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("work kept running without leadership")
+	}
+	second := awaitTerm(t, terms)
+	require.Equal(t, "replica-a", elections.Leader())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("leader.Run did not return")
+	}
+	require.Error(t, second.Err())
+	require.Contains(t, elections.Resigned, "replica-a")
+	require.Empty(t, elections.Leader())
+	require.False(t, leaderStatus(t).IsLeader)
+}
+
+func TestLeader_DisabledRunsWork(t *testing.T) {
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leader.Run(
+			ctx, conf.HAEnvironment{ReplicaId: "single"}, func(ctx context.Context) {
+				close(started)
+				<-ctx.Done()
+			},
+		)
+	}()
+	<-started
+	status := leaderStatus(t)
+	require.False(t, status.Enabled)
+	require.True(t, status.IsLeader)
+	require.Equal(t, "single", status.Leader)
+	cancel()
+	<-done
+	require.False(t, leaderStatus(t).IsLeader)
+}
+
+func TestLeader_StepsDownWhenKeyLost(t *testing.T) {
+	elections := mocks.LeaderElectionFixture(t)
+	require.NoError(t, leader.Fence(context.Background()), "no fencing without HA")
+
+	terms := make(chan context.Context, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(
+		func() {
+			cancel()
+			<-done
+		},
+	)
+	go func() {
+		defer close(done)
+		leader.Run(
+			ctx, conf.HAEnvironment{
+				Enabled: true, ReplicaId: "replica-a", SessionTTL: 150 * time.Millisecond,
+				RetryInterval: 10 * time.Millisecond, MaxRetryInterval: 10 * time.Millisecond,
+			},
+			func(ctx context.Context) {
+				terms <- ctx
+				<-ctx.Done()
+			},
+		)
+	}()
+	first := awaitTerm(t, terms)
+	require.NoError(t, leader.Fence(context.Background()))
+
+	// another replica holds the key while this session still looks alive, e.g. after a partition
+	elections.SetLeader("replica-b")
+	require.ErrorIs(t, leader.Fence(context.Background()), leader.NotLeaderError)
+	select {
+	case <-first.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("work kept running without the leader key")
+	}
+
+	// etcd can't be reached: the leadership isn't assumed for longer than the session TTL
+	elections.SetLeader("")
+	second := awaitTerm(t, terms)
+	elections.SetCheckError(errors.New("etcdserver: request timed out"))
+	require.ErrorContains(t, leader.Fence(context.Background()), "unable to confirm the leadership")
+	select {
+	case <-second.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("work kept running while the leadership couldn't be checked")
+	}
+}
+
+func TestLeader_BackoffWhenWorkReturns(t *testing.T) {
+	mocks.LeaderElectionFixture(t)
+	var mu sync.Mutex
+	var starts []time.Time
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	leader.Run(
+		ctx, conf.HAEnvironment{
+			Enabled: true, ReplicaId: "replica-a", SessionTTL: time.Second,
+			RetryInterval: 20 * time.Millisecond, MaxRetryInterval: 80 * time.Millisecond,
+		},
+		func(ctx context.Context) {
+			mu.Lock()
+			defer mu.Unlock()
+			starts = append(starts, time.Now())
+		},
+	)
+	mu.Lock()
+	defer mu.Unlock()
+	// 20ms, 40ms, 80ms, 80ms... instead of a tight loop
+	require.GreaterOrEqual(t, len(starts), 3)
+	require.LessOrEqual(t, len(starts), 9)
+	require.GreaterOrEqual(t, starts[2].Sub(starts[1]), 40*time.Millisecond)
+}
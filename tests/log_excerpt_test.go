@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/log_excerpt"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/templates"
+	"ActQABot/tests/mocks"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestHeuristics(t *testing.T) *log_excerpt.Heuristics {
+	t.Helper()
+	setupTestEnv(t)
+	h, err := log_excerpt.NewHeuristics(conf.LogExcerptEnv)
+	require.NoError(t, err)
+	return h
+}
+
+func TestLogExcerpt_PythonTraceback(t *testing.T) {
+	h := newTestHeuristics(t)
+	lines := []string{
+		"[gpu/test] | collecting...",
+		"[gpu/test] | Traceback (most recent call last):",
+		`[gpu/test] |   File "run.py", line 3, in <module>`,
+		"[gpu/test] |     main()",
+		"[gpu/test] | ValueError: bad batch size",
+		"[gpu/test] | cleanup done",
+	}
+	excerpt := h.Extract(lines)
+	require.True(t, excerpt.Failed)
+	require.Equal(t, log_excerpt.KindPythonTraceback, excerpt.Kind)
+	require.Equal(t, lines[1:5], excerpt.Lines)
+}
+
+func TestLogExcerpt_GoPanic(t *testing.T) {
+	h := newTestHeuristics(t)
+	lines := []string{
+		"=== RUN   TestSomething",
+		"panic: runtime error: index out of range [1] with length 1",
+		"",
+		"goroutine 7 [running]:",
+		"main.f(...)",
+		"\t/src/main.go:12 +0x1d",
+		"",
+		"unrelated line",
+	}
+	excerpt := h.Extract(lines)
+	require.True(t, excerpt.Failed)
+	require.Equal(t, log_excerpt.KindGoPanic, excerpt.Kind)
+	require.Equal(t, lines[1:6], excerpt.Lines)
+}
+
+func TestLogExcerpt_ErrorLinesAndTail(t *testing.T) {
+	h := newTestHeuristics(t)
+	h.ContextLines = 1
+	lines := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("step %d ok", i))
+	}
+	excerpt := h.Extract(lines)
+	require.False(t, excerpt.Failed)
+	require.Equal(t, log_excerpt.KindTail, excerpt.Kind)
+	require.Len(t, excerpt.Lines, conf.LogExcerptEnv.TailLines)
+
+	lines[50] = "Error: CUDA out of memory"
+	lines[90] = "--- FAIL: TestKernel (0.01s)"
+	excerpt = h.Extract(lines)
+	require.True(t, excerpt.Failed)
+	require.Equal(t, log_excerpt.KindErrorLines, excerpt.Kind)
+	require.Equal(
+		t,
+		[]string{"step 49 ok", lines[50], "step 51 ok", "...", "step 89 ok", lines[90], "step 91 ok"},
+		excerpt.Lines,
+	)
+}
+
+func TestLogExcerpt_ForReportFromArchive(t *testing.T) {
+	setupTestEnv(t)
+	archive := t.TempDir()
+	conf.LogExcerptEnv.ArchiveDir = archive
+	require.NoError(t, os.MkdirAll(filepath.Join(archive, "my-vm"), 0o755))
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(archive, "my-vm", "job-1.log"),
+			[]byte("setup\nrunning\nall good\n"),
+			0o644,
+		),
+	)
+
+	excerpt, err := log_excerpt.ForReport(context.Background(), "my-vm", "job-1", false)
+	require.NoError(t, err)
+	require.Nil(t, excerpt, "no excerpt expected for a clean log of unknown status")
+
+	excerpt, err = log_excerpt.ForReport(context.Background(), "my-vm", "job-1", true)
+	require.NoError(t, err)
+	require.NotNil(t, excerpt)
+	require.Equal(t, []string{"setup", "running", "all good"}, excerpt.Lines)
+
+	reportContext := templates.NewWorkerReportContext("@bot /wf_start", "started", "report")
+	reportContext.LogExcerpt = excerpt.Text()
+	reportContext.LogExcerptKind = excerpt.Kind
+	out, err := reportContext.GenText()
+	require.NoError(t, err)
+	require.True(t, strings.Contains(out, "<details><summary>Failure log excerpt (log tail)</summary>"))
+	require.Contains(t, out, "running\nall good")
+}
+
+func TestLogExcerpt_OnlyFinalFailedReports(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	var fetched []string
+	original := log_excerpt.FetchJobLogTailFunc
+	t.Cleanup(func() { log_excerpt.FetchJobLogTailFunc = original })
+	log_excerpt.FetchJobLogTailFunc = func(_ context.Context, _, jobId string, _ int) ([]string, error) {
+		fetched = append(fetched, jobId)
+		return []string{"Error: boom"}, nil
+	}
+	bg, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribed, err := worker_report.SubscribeJobReports(bg)
+	require.NoError(t, err)
+	go worker_report.JobReportsConsumer(bg, subscribed)
+
+	answer := "Answer"
+	jobId := "job-1"
+	meta := worker_report.GithubIssueMeta{
+		Sender: "user", Body: "body", Owner: "owner", Repository: "repo", IssueId: 1,
+		AnswerCommentBody: &answer, Host: "my-vm", JobId: &jobId,
+	}
+	require.NoError(t, meta.Store(t.Context(), jobId, 1))
+	for _, status := range []string{"", worker_report.JobStatusSuccess, worker_report.JobStatusFailure} {
+		report := worker_report.JobReport{JobId: jobId, JobReportText: "report " + status, Status: status}
+		require.NoError(t, report.SendEvent(bg))
+		comment := awaitComment(t, commentPosted)
+		require.Equal(t, status == worker_report.JobStatusFailure, strings.Contains(comment, "Error: boom"))
+	}
+	require.Equal(t, []string{jobId}, fetched)
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/api/github_api"
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/internal/logging"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/tests/mocks"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the JSON records logged with the given message
+func (b *syncBuffer) records(t *testing.T, msg string) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var found []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		if record[slog.MessageKey] == msg {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+func loggingFixture(t *testing.T, format string) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	handler, err := logging.NewHandler(buf, format)
+	require.NoError(t, err)
+	original := slog.Default()
+	originalLevel := logging.Level()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(
+		func() {
+			slog.SetDefault(original)
+			logging.SetLevel(originalLevel)
+		},
+	)
+	return buf
+}
+
+func TestLogging_CorrelationFields(t *testing.T) {
+	setupTestEnv(t)
+	logs := loggingFixture(t, logging.FormatJSON)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+
+	originalConn := grpc_utils.NewGRPCConn
+	t.Cleanup(func() { grpc_utils.NewGRPCConn = originalConn })
+	grpc_utils.NewGRPCConn = func(host conf.Host) (grpc.ClientConnInterface, error) {
+		return &mocks.MockClientConn{
+			InvokeFunc: func(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+				reply.(*actservice.JobResponse).JobId = "logged-job"
+				return nil
+			},
+		}, nil
+	}
+
+	var comment issues.IssueComment
+	comment.Action = "created"
+	comment.Issue.Number = 42
+	comment.Comment.Body = fmt.Sprintf("@bot %s my-vm some-commit", issues.StartJob)
+	comment.Comment.User.Login = "octocat"
+	comment.Repository.FullName = "octo/hello"
+	comment.Repository.Name = "hello"
+	comment.Repository.Owner.Login = "octo"
+	body, _ := json.Marshal(comment)
+	req := httptest.NewRequest(http.MethodPost, "/github/events/", bytes.NewBuffer(body))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	req.Header.Set("X-GitHub-Delivery", "delivery-42")
+	w := httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	select {
+	case <-commentPosted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("comment posted timeout")
+	}
+
+	records := logs.records(t, "job scheduled")
+	require.Len(t, records, 1)
+	record := records[0]
+	require.Equal(t, "delivery-42", record[logging.KeyDelivery])
+	require.Equal(t, "octo/hello", record[logging.KeyRepo])
+	require.EqualValues(t, 42, record[logging.KeyIssue])
+	require.Equal(t, "octocat", record[logging.KeySender])
+	require.Equal(t, issues.StartJob, record[logging.KeyCommand])
+	require.Equal(t, "my-vm", record[logging.KeyHost])
+	require.Equal(t, "logged-job", record[logging.KeyJob])
+	require.Equal(t, "INFO", record[slog.LevelKey])
+}
+
+func TestLogging_WithReplacesFields(t *testing.T) {
+	logs := loggingFixture(t, logging.FormatJSON)
+	ctx := logging.With(context.Background(), logging.KeyHost, "h100", logging.KeyJob, "first")
+	ctx = logging.With(ctx, logging.KeyJob, "second")
+	slog.InfoContext(ctx, "fields")
+
+	records := logs.records(t, "fields")
+	require.Len(t, records, 1)
+	require.Equal(t, "h100", records[0][logging.KeyHost])
+	require.Equal(t, "second", records[0][logging.KeyJob])
+}
+
+func TestLogging_TextFormat(t *testing.T) {
+	buf := &syncBuffer{}
+	handler, err := logging.NewHandler(buf, logging.FormatText)
+	require.NoError(t, err)
+	ctx := logging.With(context.Background(), logging.KeyJob, "text-job")
+	slog.New(handler).InfoContext(ctx, "plain")
+	require.Contains(t, buf.buf.String(), "msg=plain")
+	require.Contains(t, buf.buf.String(), "job_id=text-job")
+
+	_, err = logging.NewHandler(buf, "xml")
+	require.Error(t, err)
+}
+
+func TestAdminAPI_LogLevel(t *testing.T) {
+	logs := loggingFixture(t, logging.FormatJSON)
+	logging.SetLevel(slog.LevelInfo)
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	call := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/log/level", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+		admin_api.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var level admin_api.LogLevel
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&level))
+	require.Equal(t, "INFO", level.Level)
+
+	slog.Debug("hidden")
+	require.Empty(t, logs.records(t, "hidden"))
+
+	w = call(http.MethodPut, `{"level": "debug"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&level))
+	require.Equal(t, "DEBUG", level.Level)
+	slog.Debug("shown")
+	require.Len(t, logs.records(t, "shown"), 1)
+
+	w = call(http.MethodPut, `{"level": "trace"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, logging.LevelTrace, logging.Level())
+
+	w = call(http.MethodPut, `{"level": "loud"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, logging.LevelTrace, logging.Level())
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"ActQABot/api/github_api"
+	"ActQABot/pkg/worker_report"
 	"ActQABot/tests/mocks"
 	"bufio"
 	"context"
@@ -18,6 +19,21 @@ func TestLogStreamer(t *testing.T) {
 
 	mocks.GrpcConnFixture(t)
 	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	require.NoError(
+		t, worker_report.SaveJobSpec(
+			context.Background(), &worker_report.JobSpec{
+				JobId: "abc", Owner: "owner", Repository: "repo", IssueNumber: 1, Host: "my-vm", CreatedAt: time.Now(),
+			},
+		),
+	)
+	require.NoError(
+		t, worker_report.SaveJobDeadline(
+			context.Background(), &worker_report.JobDeadline{
+				JobId: "abc", Host: "my-vm", Limit: time.Hour, StartedAt: time.Now(), Deadline: time.Now().Add(time.Hour),
+			},
+		),
+	)
 
 	req := httptest.NewRequest(http.MethodGet, "/job/logs/?host=my-vm&job_id=abc", nil)
 	w := httptest.NewRecorder()
@@ -78,4 +94,9 @@ DONE:
 	require.GreaterOrEqual(t, len(lines), 2, "should receive at least 2 log lines")
 	assert.Contains(t, lines[0], "line1")
 	assert.Contains(t, lines[1], "line2")
+
+	// ActService also ends a silent stream, only the final report or the lease stops the watchdog
+	deadlines, err := worker_report.ListJobDeadlines(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadlines, 1)
 }
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"ActQABot/conf"
+	"ActQABot/internal/logging"
 	"os"
 	"testing"
 )
@@ -10,5 +12,9 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic(err)
 	}
+	conf.NewEnviron(&conf.LoggingEnv)
+	if err = logging.Init(conf.LoggingEnv); err != nil {
+		panic(err)
+	}
 	os.Exit(m.Run())
 }
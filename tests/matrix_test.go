@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"ActQABot/api/github_api"
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type scheduledMatrixJob struct {
+	address string
+	jobId   string
+	flags   []string
+}
+
+// matrixFixture adds a second host and records the jobs scheduled per host address
+func matrixFixture(t *testing.T) func() []scheduledMatrixJob {
+	t.Helper()
+	conf.Hosts.Hosts["gpu-2"] = conf.Host{Address: "yyy:50051", MaxConcurrency: 1}
+	t.Cleanup(func() { delete(conf.Hosts.Hosts, "gpu-2") })
+
+	var mu sync.Mutex
+	var scheduled []scheduledMatrixJob
+	original := grpc_utils.NewGRPCConn
+	t.Cleanup(func() { grpc_utils.NewGRPCConn = original })
+	grpc_utils.NewGRPCConn = func(host conf.Host) (grpc.ClientConnInterface, error) {
+		return &mocks.MockClientConn{
+			InvokeFunc: func(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+				job := args.(*actservice.Job)
+				resp := reply.(*actservice.JobResponse)
+				resp.JobId = uuid.NewString()
+				mu.Lock()
+				defer mu.Unlock()
+				scheduled = append(scheduled, scheduledMatrixJob{address: host.Address, jobId: resp.JobId, flags: job.ExtraFlags})
+				return nil
+			},
+			NewStreamFunc: func(
+				ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption,
+			) (grpc.ClientStream, error) {
+				return nil, errors.New("no logs")
+			},
+		}, nil
+	}
+	return func() []scheduledMatrixJob {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]scheduledMatrixJob{}, scheduled...)
+	}
+}
+
+func postMatrixComment(t *testing.T, body string) {
+	t.Helper()
+	payload := mocks.IssueCommentPayload{
+		Action: "created",
+		IssueComment: mocks.MockComment{
+			Body: body,
+			User: struct {
+				Login string `json:"login"`
+			}{Login: "test-user"},
+		},
+	}
+	data, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/github/events/", bytes.NewBuffer(data))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	w := httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func awaitComment(t *testing.T, comments <-chan *gh_api.BotResponse) string {
+	t.Helper()
+	select {
+	case comment := <-comments:
+		return comment.Text
+	case <-time.After(3 * time.Second):
+		t.Fatal("no comment posted")
+	}
+	return ""
+}
+
+func TestMatrix_FanOutAndSummary(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	postMatrixComment(
+		t, fmt.Sprintf(
+			"@bot %s some-commit .github/workflows/gpu.yml --matrix host=my-vm,gpu-2 --matrix TEST_CASE=a,b",
+			issues.StartJob,
+		),
+	)
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "4 matrix jobs started")
+
+	jobs := scheduled()
+	require.Len(t, jobs, 4)
+	expected := []struct{ address, testCase string }{
+		{"xxx:50051", "TEST_CASE=a"}, {"xxx:50051", "TEST_CASE=b"},
+		{"yyy:50051", "TEST_CASE=a"}, {"yyy:50051", "TEST_CASE=b"},
+	}
+	for i, job := range jobs {
+		require.Equal(t, expected[i].address, job.address)
+		require.Equal(t, []string{"--container-options", "-e " + expected[i].testCase}, job.flags)
+		require.Contains(t, reply, job.jobId)
+	}
+	// every job meta is linked to the group and knows the reply
+	var groupId string
+	require.Eventually(
+		t, func() bool {
+			for _, job := range jobs {
+				data := mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+job.jobId)
+				if data == nil {
+					return false
+				}
+				var meta worker_report.GithubIssueMeta
+				require.NoError(t, json.Unmarshal(data, &meta))
+				if meta.GroupId == nil || meta.AnswerCommentBody == nil {
+					return false
+				}
+				groupId = *meta.GroupId
+			}
+			return true
+		}, 2*time.Second, 20*time.Millisecond,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := worker_report.SubscribeJobReports(ctx)
+	require.NoError(t, err)
+	go worker_report.JobReportsConsumer(ctx, events)
+
+	sendReport := func(report *worker_report.JobReport) {
+		require.NoError(t, report.SendEvent(ctx))
+		require.Eventually(
+			t, func() bool {
+				return len(mocks.StoredKeys(t, string(worker_report.JobReportChannel))) == 0
+			}, 2*time.Second, 10*time.Millisecond,
+		)
+	}
+	send := func(jobId, text, status string) *worker_report.JobReport {
+		report := &worker_report.JobReport{JobId: jobId, JobReportText: text, Status: status}
+		sendReport(report)
+		return report
+	}
+	send(jobs[0].jobId, "first passed", worker_report.JobStatusSuccess)
+	send(jobs[1].jobId, "second passed", worker_report.JobStatusSuccess)
+	send(jobs[2].jobId, "third passed", worker_report.JobStatusSuccess)
+	progress := send(jobs[3].jobId, "halfway there", "")
+	// a report delivered again is recorded once
+	sendReport(progress)
+	select {
+	case comment := <-commentPosted:
+		t.Fatalf("summary posted before the group finished: %s", comment.Text)
+	case <-time.After(200 * time.Millisecond):
+	}
+	send(jobs[3].jobId, "fourth broke", worker_report.JobStatusFailure)
+
+	summary := awaitComment(t, commentPosted)
+	require.Contains(t, summary, fmt.Sprintf("Matrix group `%s` finished", groupId))
+	for _, job := range jobs {
+		require.Contains(t, summary, job.jobId)
+	}
+	require.Equal(t, 3, strings.Count(summary, ":white_check_mark: success"))
+	require.Contains(t, summary, ":x: failure")
+	require.Contains(t, summary, "halfway there\n\nfourth broke")
+	require.Equal(t, 1, strings.Count(summary, "halfway there"))
+	require.Contains(t, summary, "| gpu-2 | host=gpu-2, TEST_CASE=b |")
+}
+
+func TestMatrix_InvalidAxes(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	conf.GeneralEnvironments.MaxMatrixJobs = 3
+
+	for _, tc := range []struct{ matrix, expected string }{
+		{"--matrix TEST_CASE=", "invalid matrix axis"},
+		{"--matrix TEST_CASE=a --matrix TEST_CASE=b", "given twice"},
+		{"--matrix host=my-vm,unknown", "Unknown host unknown"},
+		{"--matrix host=my-vm,gpu-2 --matrix TEST_CASE=a,b", "at most 3 are allowed"},
+	} {
+		postMatrixComment(t, fmt.Sprintf("@bot %s some-commit %s", issues.StartJob, tc.matrix))
+		require.Contains(t, awaitComment(t, commentPosted), tc.expected)
+	}
+	require.Empty(t, scheduled())
+}
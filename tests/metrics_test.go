@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"ActQABot/api/github_api"
+	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/tests/mocks"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics_WebhookCommandsAndGithubCalls(t *testing.T) {
+	setupTestEnv(t)
+	postIssueComment := gh_api.PostIssueCommentFunc
+	mocks.PostIssueCommentFixture(t)
+
+	webhookOK := metrics.WebhookEvents.WithLabelValues("github", "issue_comment", metrics.OutcomeOK)
+	helpOK := metrics.Commands.WithLabelValues(issues.HelpCommand, metrics.OutcomeOK)
+	webhooksBefore, helpBefore := testutil.ToFloat64(webhookOK), testutil.ToFloat64(helpOK)
+
+	payload := mocks.IssueCommentPayload{
+		Action:       "created",
+		IssueComment: mocks.MockComment{Body: fmt.Sprintf("@bot %s", issues.HelpCommand)},
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/github/events/", bytes.NewBuffer(body))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	w := httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, webhooksBefore+1, testutil.ToFloat64(webhookOK))
+	require.Equal(t, helpBefore+1, testutil.ToFloat64(helpOK))
+
+	// GitHub calls and rate limit are observed on the shared transport
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Remaining", "4321")
+				w.Header().Set("X-RateLimit-Resource", "core")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+		),
+	)
+	origEnv := conf.GithubEnvironment
+	t.Cleanup(
+		func() {
+			server.Close()
+			conf.GithubEnvironment = origEnv
+		},
+	)
+	conf.GithubEnvironment = conf.GithubAPIEnvironment{BaseURL: server.URL + "/api/v3/", Timeout: 5 * time.Second}
+	created := metrics.GithubAPICalls.WithLabelValues(http.MethodPost, "201")
+	createdBefore := testutil.ToFloat64(created)
+	require.NoError(
+		t, postIssueComment(&gh_api.BotResponse{Owner: "o", Repo: "r", IssueNumber: 1, Text: "hi"}, "token"),
+	)
+	require.Equal(t, createdBefore+1, testutil.ToFloat64(created))
+	require.Equal(t, float64(4321), testutil.ToFloat64(metrics.GithubRateLimitRemaining.WithLabelValues("core")))
+
+	w = httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), "qabot_webhook_events_total")
+	require.Contains(t, w.Body.String(), "qabot_job_report_queue_depth")
+}
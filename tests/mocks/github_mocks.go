@@ -3,20 +3,38 @@ package mocks
 import (
 	"ActQABot/conf"
 	"ActQABot/pkg/github/gh_api"
+	"context"
 	"github.com/google/go-github/v60/github"
 	"testing"
 )
 
 var testToken = "test-token"
 
-func mockGithub() {
+// mockGithub stands in for the GitHub API until the end of the test
+func mockGithub(t *testing.T) {
+	authorize, resolveRef, getFile, listFiles := gh_api.Authorize, gh_api.ResolveRefFunc, gh_api.GetFileFunc, gh_api.ListFilesFunc
+	t.Cleanup(
+		func() {
+			gh_api.Authorize, gh_api.ResolveRefFunc, gh_api.GetFileFunc, gh_api.ListFilesFunc = authorize, resolveRef, getFile, listFiles
+		},
+	)
 	gh_api.Authorize = func(ghEnv conf.GithubAPIEnvironment, owner, repo string) (*github.InstallationToken, error) {
 		return &github.InstallationToken{Token: &testToken}, nil
 	}
+	gh_api.ResolveRefFunc = func(ctx context.Context, owner, repo, ref string) (string, error) {
+		return ref, nil
+	}
+	gh_api.GetFileFunc = func(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+		return []byte(DefaultWorkflow), nil
+	}
+	gh_api.ListFilesFunc = func(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+		return []string{".github/workflows/ci.yml"}, nil
+	}
 }
 
 func PostIssueCommentFixture(t *testing.T) chan *gh_api.BotResponse {
-	mockGithub()
+	mockGithub(t)
+	OutboxFixture(t)
 	original := gh_api.PostIssueCommentFunc
 	call := make(chan *gh_api.BotResponse, 1)
 	gh_api.PostIssueCommentFunc = func(botComment *gh_api.BotResponse, token string) error {
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"fmt"
 	"github.com/D1-3105/ActService/api/gen/ActService"
 	"google.golang.org/grpc"
@@ -12,10 +13,26 @@ type MockClientStream struct {
 	grpc.ClientStream
 	recvCount int
 	logs      []*actservice.JobLogMessage
+	// a running job: once the logs are sent the stream waits for hold instead of ending
+	hold context.Context
+}
+
+// NewJobStream sends logs then ends like the stream of a finished job
+func NewJobStream(logs ...*actservice.JobLogMessage) *MockClientStream {
+	return &MockClientStream{logs: logs}
+}
+
+// NewRunningJobStream sends logs, then blocks until ctx is done like the stream of a job still running
+func NewRunningJobStream(ctx context.Context, logs ...*actservice.JobLogMessage) *MockClientStream {
+	return &MockClientStream{logs: logs, hold: ctx}
 }
 
 func (m *MockClientStream) RecvMsg(msg interface{}) error {
 	if m.recvCount >= len(m.logs) {
+		if m.hold != nil {
+			<-m.hold.Done()
+			return m.hold.Err()
+		}
 		return io.EOF
 	}
 	orig := m.logs[m.recvCount]
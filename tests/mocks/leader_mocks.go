@@ -0,0 +1,147 @@
+package mocks
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/leader"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// MemoryElections is an in-process election; other replicas are played through SetLeader
+type MemoryElections struct {
+	mu       sync.Mutex
+	leader   string
+	changed  chan struct{}
+	sessions []*memoryElection
+	checkErr error
+	Resigned []string
+}
+
+type memoryElection struct {
+	parent    *MemoryElections
+	done      chan struct{}
+	closeOnce sync.Once
+	value     string
+}
+
+func LeaderElectionFixture(t *testing.T) *MemoryElections {
+	t.Helper()
+	elections := &MemoryElections{changed: make(chan struct{})}
+	original := leader.NewElectionFunc
+	leader.NewElectionFunc = func(haEnv conf.HAEnvironment) (leader.Election, error) {
+		elections.mu.Lock()
+		defer elections.mu.Unlock()
+		e := &memoryElection{parent: elections, done: make(chan struct{})}
+		elections.sessions = append(elections.sessions, e)
+		return e, nil
+	}
+	t.Cleanup(func() { leader.NewElectionFunc = original })
+	return elections
+}
+
+// setLocked changes the leader, m.mu must be held
+func (m *MemoryElections) setLocked(value string) {
+	m.leader = value
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *MemoryElections) SetLeader(value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(value)
+}
+
+func (m *MemoryElections) Leader() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leader
+}
+
+// SetCheckError makes the leadership checks fail, like an unreachable etcd, nil restores them
+func (m *MemoryElections) SetCheckError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkErr = err
+}
+
+// ExpireSessions loses the lease of every open session, like a network partition from etcd
+func (m *MemoryElections) ExpireSessions() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = nil
+	m.mu.Unlock()
+	for _, e := range sessions {
+		_ = e.Close()
+	}
+}
+
+func (e *memoryElection) Campaign(ctx context.Context, value string) error {
+	for {
+		e.parent.mu.Lock()
+		if e.parent.leader == "" {
+			e.value = value
+			e.parent.setLocked(value)
+			e.parent.mu.Unlock()
+			return nil
+		}
+		changed := e.parent.changed
+		e.parent.mu.Unlock()
+		select {
+		case <-changed:
+		case <-e.done:
+			return errors.New("session expired")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *memoryElection) Resign(ctx context.Context) error {
+	e.parent.mu.Lock()
+	defer e.parent.mu.Unlock()
+	e.parent.Resigned = append(e.parent.Resigned, e.value)
+	if e.value != "" && e.parent.leader == e.value {
+		e.parent.setLocked("")
+	}
+	return nil
+}
+
+func (e *memoryElection) Leader(ctx context.Context) (string, error) {
+	return e.parent.Leader(), nil
+}
+
+func (e *memoryElection) IsLeader(ctx context.Context) (bool, error) {
+	e.parent.mu.Lock()
+	defer e.parent.mu.Unlock()
+	if e.parent.checkErr != nil {
+		return false, e.parent.checkErr
+	}
+	select {
+	case <-e.done:
+		return false, nil
+	default:
+	}
+	return e.value != "" && e.parent.leader == e.value, nil
+}
+
+func (e *memoryElection) Done() <-chan struct{} {
+	return e.done
+}
+
+// Close revokes the lease, the leader key goes away with it
+func (e *memoryElection) Close() error {
+	e.closeOnce.Do(
+		func() {
+			close(e.done)
+			e.parent.mu.Lock()
+			defer e.parent.mu.Unlock()
+			if e.value != "" && e.parent.leader == e.value {
+				e.parent.setLocked("")
+			}
+		},
+	)
+	return nil
+}
@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/storage"
+	"context"
+	"testing"
+	"time"
+)
+
+// OutboxFixture backs the outbox with the test store and runs its worker for the duration of the test
+func OutboxFixture(t *testing.T) *storage.Memory {
+	store := StorageFixture(t)
+	origEnv := conf.OutboxEnv
+	conf.OutboxEnv = conf.OutboxEnvironment{
+		PollInterval: 50 * time.Millisecond,
+		MaxAttempts:  3,
+		BaseBackoff:  10 * time.Millisecond,
+		MaxBackoff:   50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		outbox.Worker(ctx)
+	}()
+	t.Cleanup(
+		func() {
+			cancel()
+			<-done
+			conf.OutboxEnv = origEnv
+		},
+	)
+	return store
+}
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"ActQABot/pkg/storage"
+	"context"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+var fixtureStores sync.Map
+
+// StorageFixture backs job meta, worker reports and the outbox with a fresh in-process store for the duration
+// of the test, later calls within the same test return the same store
+func StorageFixture(t *testing.T) *storage.Memory {
+	if store, ok := fixtureStores.Load(t); ok {
+		return store.(*storage.Memory)
+	}
+	store, err := storage.NewMemory("")
+	require.NoError(t, err)
+	previous := storage.SetDefault(store)
+	fixtureStores.Store(t, store)
+	t.Cleanup(
+		func() {
+			fixtureStores.Delete(t)
+			storage.SetDefault(previous)
+			_ = store.Close()
+		},
+	)
+	return store
+}
+
+// StoredKeys lists the keys under prefix in the test store
+func StoredKeys(t *testing.T, prefix string) []string {
+	kvs, _, err := StorageFixture(t).List(context.Background(), prefix)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+// StoredValue returns the value of key in the test store, nil when missing
+func StoredValue(t *testing.T, key string) []byte {
+	kv, err := StorageFixture(t).Get(context.Background(), key)
+	require.NoError(t, err)
+	if kv == nil {
+		return nil
+	}
+	return kv.Value
+}
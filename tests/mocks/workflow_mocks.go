@@ -0,0 +1,70 @@
+package mocks
+
+import (
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DefaultWorkflow is what the mocked GitHub repositories hold at every workflow path
+const DefaultWorkflow = `name: CI
+on: [push]
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ok
+`
+
+// WorkflowFilesFixture serves files (path to content) as the GitHub repository at any ref,
+// other paths answer 404. The refs asked for are returned by the func.
+func WorkflowFilesFixture(t *testing.T, files map[string]string) func() []string {
+	t.Helper()
+	mockGithub(t)
+	var mu sync.Mutex
+	var refs []string
+	record := func(ref string) {
+		mu.Lock()
+		defer mu.Unlock()
+		refs = append(refs, ref)
+	}
+	origGet, origList := gh_api.GetFileFunc, gh_api.ListFilesFunc
+	t.Cleanup(
+		func() {
+			gh_api.GetFileFunc, gh_api.ListFilesFunc = origGet, origList
+		},
+	)
+	gh_api.GetFileFunc = func(ctx context.Context, owner, repo, ref, filePath string) ([]byte, error) {
+		record(ref)
+		content, ok := files[filePath]
+		if !ok {
+			return nil, &forge.APIError{StatusCode: http.StatusNotFound}
+		}
+		return []byte(content), nil
+	}
+	gh_api.ListFilesFunc = func(ctx context.Context, owner, repo, ref, dir string) ([]string, error) {
+		record(ref)
+		var paths []string
+		for filePath := range files {
+			if path.Dir(filePath) == strings.TrimSuffix(dir, "/") {
+				paths = append(paths, filePath)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, &forge.APIError{StatusCode: http.StatusNotFound}
+		}
+		slices.Sort(paths)
+		return paths, nil
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, refs...)
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/notify"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/templates"
+	"ActQABot/tests/mocks"
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sentNotification struct {
+	url string
+	msg *notify.SlackMessage
+}
+
+func notifyFixture(t *testing.T) chan sentNotification {
+	t.Helper()
+	notifications, err := conf.NewNotificationsEnvironment("notify.example.yaml")
+	require.NoError(t, err)
+	sent := make(chan sentNotification, 4)
+	origSend, origNotifications := notify.SendFunc, conf.Notifications
+	t.Cleanup(
+		func() {
+			notify.SendFunc = origSend
+			conf.Notifications = origNotifications
+		},
+	)
+	conf.Notifications = notifications
+	notify.SendFunc = func(ctx context.Context, url string, msg *notify.SlackMessage) error {
+		sent <- sentNotification{url: url, msg: msg}
+		return nil
+	}
+	return sent
+}
+
+func collectNotifications(sent chan sentNotification, wait time.Duration) map[string]*notify.SlackMessage {
+	byURL := make(map[string]*notify.SlackMessage)
+	for {
+		select {
+		case n := <-sent:
+			byURL[n.url] = n.msg
+		case <-time.After(wait):
+			return byURL
+		}
+	}
+}
+
+func TestNotify_Routing(t *testing.T) {
+	setupTestEnv(t)
+	sent := notifyFixture(t)
+	gpuTeam := conf.Notifications.Sinks["gpu-team"].URL
+	mattermost := conf.Notifications.Sinks["mattermost"].URL
+
+	notify.Notify(
+		notify.Event{
+			Kind: templates.NotificationJobFinished, Owner: "owner", Repo: "repo", IssueNumber: 3,
+			Sender: "test-user", Host: "my-vm", JobId: "job-1", Status: "failure",
+		},
+	)
+	got := collectNotifications(sent, 200*time.Millisecond)
+	require.Len(t, got, 2)
+	require.Contains(t, got[gpuTeam].Text, "job-1")
+	require.Contains(t, got[gpuTeam].Text, "failure")
+	require.Contains(t, got[gpuTeam].Text, "owner/repo#3")
+	require.Equal(t, "qa-bot", got[mattermost].Channel)
+	require.Equal(t, "BeepBoop", got[mattermost].Username)
+
+	notify.Notify(
+		notify.Event{
+			Kind: templates.NotificationJobStarted, Owner: "owner", Repo: "other", IssueNumber: 1,
+			Sender: "test-user", Host: "my-vm", JobId: "job-2",
+		},
+	)
+	require.Empty(t, collectNotifications(sent, 200*time.Millisecond))
+
+	notify.Notify(
+		notify.Event{
+			Kind: templates.NotificationJobStarted, Owner: "owner", Repo: "repo", IssueNumber: 1,
+			Sender: "test-user", Host: "my-vm", JobId: "job-3",
+		},
+	)
+	got = collectNotifications(sent, 200*time.Millisecond)
+	require.Len(t, got, 1)
+	require.True(t, strings.HasPrefix(got[mattermost].Text, ":rocket:"), got[mattermost].Text)
+	require.Contains(t, got[mattermost].Text, "job_id=job-3")
+}
+
+func TestNotify_OnlyFinalReport(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	sent := notifyFixture(t)
+	gpuTeam := conf.Notifications.Sinks["gpu-team"].URL
+	bg, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribed, err := worker_report.SubscribeJobReports(bg)
+	require.NoError(t, err)
+	go worker_report.JobReportsConsumer(bg, subscribed)
+
+	answer := "Answer"
+	jobId := uuid.NewString()
+	meta := worker_report.GithubIssueMeta{
+		Sender: "someone", Body: "body", Owner: "owner", Repository: "other", IssueId: 1,
+		AnswerCommentBody: &answer, Host: "my-vm", JobId: &jobId,
+	}
+	require.NoError(t, meta.Store(t.Context(), jobId, 1))
+
+	// progress reports don't notify
+	report := worker_report.JobReport{JobId: jobId, JobReportText: "step 1 done"}
+	require.NoError(t, report.SendEvent(bg))
+	awaitComment(t, commentPosted)
+	require.Empty(t, collectNotifications(sent, 200*time.Millisecond))
+
+	report = worker_report.JobReport{JobId: jobId, JobReportText: "done", Status: worker_report.JobStatusSuccess}
+	require.NoError(t, report.SendEvent(bg))
+	awaitComment(t, commentPosted)
+	got := collectNotifications(sent, 200*time.Millisecond)
+	require.Len(t, got, 1)
+	require.Contains(t, got[gpuTeam].Text, jobId)
+}
+
+func TestNotificationsEnvironment_UnknownSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("routes:\n  - sinks: [missing]\n"), 0600))
+	_, err := conf.NewNotificationsEnvironment(path)
+	require.ErrorContains(t, err, "unknown sink missing")
+}
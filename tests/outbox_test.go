@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/outbox"
+	"ActQABot/pkg/storage"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_OutboxKeepsIssueOrderAndDeadLetters(t *testing.T) {
+	setupTestEnv(t)
+	mocks.OutboxFixture(t)
+
+	var mu sync.Mutex
+	delivered := make([]string, 0)
+	origDeliver := outbox.DeliverFunc
+	t.Cleanup(func() { outbox.DeliverFunc = origDeliver })
+	outbox.DeliverFunc = func(ctx context.Context, item *outbox.Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if item.Text == "rate-limited" && len(item.Attempts) == 0 {
+			return &forge.APIError{StatusCode: http.StatusForbidden, RetryAfter: 100 * time.Millisecond}
+		}
+		if item.Text == "broken" {
+			return &forge.APIError{StatusCode: http.StatusUnprocessableEntity}
+		}
+		if item.Text == "unavailable" {
+			return &forge.APIError{StatusCode: http.StatusServiceUnavailable}
+		}
+		delivered = append(delivered, item.Text)
+		return nil
+	}
+
+	for _, text := range []string{"rate-limited", "second", "broken", "fourth", "unavailable"} {
+		require.NoError(
+			t,
+			outbox.Enqueue(
+				context.Background(),
+				outbox.NewCommentItem(&gh_api.BotResponse{Owner: "o", Repo: "r", IssueNumber: 1, Text: text}),
+			),
+		)
+	}
+
+	require.Eventually(
+		t, func() bool {
+			return len(mocks.StoredKeys(t, outbox.OutboxQueuePrefix)) == 0
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+	mu.Lock()
+	require.Equal(t, []string{"rate-limited", "second", "fourth"}, delivered)
+	mu.Unlock()
+
+	dead, err := outbox.ListDead(context.Background())
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+	// a rejected write isn't retried, an unavailable forge is until the attempts run out
+	require.Equal(t, "broken", dead[0].Text)
+	require.Len(t, dead[0].Attempts, 1)
+	require.Equal(t, "unavailable", dead[1].Text)
+	require.Len(t, dead[1].Attempts, conf.OutboxEnv.MaxAttempts)
+	require.NoError(t, outbox.PurgeDead(context.Background(), dead[1].Id))
+
+	// admin API
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	router := admin_api.Router()
+
+	req := httptest.NewRequest(http.MethodGet, "/outbox/dead/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/outbox/dead/", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list admin_api.OutboxDeadList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list.Items, 1)
+
+	outbox.DeliverFunc = func(ctx context.Context, item *outbox.Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, item.Text)
+		return nil
+	}
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/outbox/dead/%s/replay", dead[0].Id), nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	require.Eventually(
+		t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(delivered) == 4 && delivered[3] == "broken"
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+	require.Empty(t, mocks.StoredKeys(t, outbox.OutboxDeadPrefix))
+
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/outbox/dead/%s", dead[0].Id), nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_OutboxReplayKeepsIssueOrder(t *testing.T) {
+	setupTestEnv(t)
+	mocks.OutboxFixture(t)
+	conf.OutboxEnv.MaxAttempts = 1000
+
+	var mu sync.Mutex
+	var delivered []string
+	rejectFirst, holdSecond := true, true
+	origDeliver := outbox.DeliverFunc
+	t.Cleanup(func() { outbox.DeliverFunc = origDeliver })
+	outbox.DeliverFunc = func(ctx context.Context, item *outbox.Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case item.Text == "first" && rejectFirst:
+			return &forge.APIError{StatusCode: http.StatusForbidden}
+		case item.Text == "second" && holdSecond:
+			return &forge.APIError{StatusCode: http.StatusBadGateway}
+		}
+		delivered = append(delivered, item.Text)
+		return nil
+	}
+	for _, text := range []string{"first", "second"} {
+		require.NoError(
+			t, outbox.Enqueue(
+				context.Background(),
+				outbox.NewCommentItem(&gh_api.BotResponse{Owner: "o", Repo: "r", IssueNumber: 1, Text: text}),
+			),
+		)
+	}
+	var dead []*outbox.Item
+	require.Eventually(
+		t, func() bool {
+			var err error
+			dead, err = outbox.ListDead(context.Background())
+			return err == nil && len(dead) == 1
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+
+	// replayed while the newer comment is still queued: it is posted first
+	mu.Lock()
+	rejectFirst = false
+	mu.Unlock()
+	_, err := outbox.ReplayDead(context.Background(), dead[0].Id)
+	require.NoError(t, err)
+	mu.Lock()
+	holdSecond = false
+	mu.Unlock()
+	require.Eventually(
+		t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(delivered) == 2
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+	require.Equal(t, []string{"first", "second"}, delivered)
+}
+
+func Test_OutboxDropsMalformedItems(t *testing.T) {
+	setupTestEnv(t)
+	store := mocks.OutboxFixture(t)
+	delivered := make(chan string, 1)
+	origDeliver := outbox.DeliverFunc
+	t.Cleanup(func() { outbox.DeliverFunc = origDeliver })
+	outbox.DeliverFunc = func(ctx context.Context, item *outbox.Item) error {
+		delivered <- item.Text
+		return nil
+	}
+
+	// ahead of the issue queue: it must not hold the comments behind it
+	key := outbox.OutboxQueuePrefix + "github/o/r/1/0000"
+	require.NoError(t, store.Put(context.Background(), key, []byte("{"), storage.NoLease))
+	require.NoError(
+		t, outbox.Enqueue(
+			context.Background(),
+			outbox.NewCommentItem(&gh_api.BotResponse{Owner: "o", Repo: "r", IssueNumber: 1, Text: "after"}),
+		),
+	)
+	select {
+	case text := <-delivered:
+		require.Equal(t, "after", text)
+	case <-time.After(5 * time.Second):
+		t.Fatal("comment not delivered")
+	}
+	require.Eventually(
+		t, func() bool { return len(mocks.StoredKeys(t, outbox.OutboxQueuePrefix)) == 0 },
+		time.Second, 10*time.Millisecond,
+	)
+	require.Empty(t, mocks.StoredKeys(t, outbox.OutboxDeadPrefix))
+}
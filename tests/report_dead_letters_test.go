@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/conf"
+	"ActQABot/internal/metrics"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	admin_api.Router().ServeHTTP(w, req)
+	return w
+}
+
+// exhaustReport queues a report on its last retry and nacks it once more
+func exhaustReport(t *testing.T, events <-chan *worker_report.JobReportEvent, jobId string, reason error) {
+	t.Helper()
+	retried := int32(11)
+	report := worker_report.JobReport{
+		JobId: jobId, JobReportText: "lost report", Retried: &retried,
+		Attempts: []worker_report.ReportAttempt{{At: time.Now(), Error: "earlier failure"}},
+	}
+	require.NoError(t, report.SendEvent(t.Context()))
+	select {
+	case event := <-events:
+		require.Equal(t, jobId, event.Report.JobId)
+		require.NoError(t, event.Nack(t.Context(), reason))
+	case <-time.After(time.Second):
+		t.Fatal("report was not delivered")
+	}
+}
+
+func TestReportDeadLetters_AdminAPI(t *testing.T) {
+	mocks.StorageFixture(t)
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	events, err := worker_report.SubscribeJobReports(ctx)
+	require.NoError(t, err)
+
+	deadLetteredBefore := testutil.ToFloat64(metrics.JobReportDeadLettered)
+	exhaustReport(t, events, "unknown-job", errors.New("job unknown-job does not exist"))
+	require.Empty(t, mocks.StoredKeys(t, string(worker_report.JobReportChannel)))
+	require.Equal(t, deadLetteredBefore+1, testutil.ToFloat64(metrics.JobReportDeadLettered))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), "qabot_job_report_dead_letters 1")
+
+	w = adminRequest(t, http.MethodGet, "/reports/dead/")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list admin_api.ReportDeadList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list.Reports, 1)
+	dead := list.Reports[0]
+	require.Equal(t, "job unknown-job does not exist", dead.Reason)
+	require.Equal(t, "unknown-job", dead.Report.JobId)
+	require.Len(t, dead.Report.Attempts, 2)
+	require.Equal(t, "earlier failure", dead.Report.Attempts[0].Error)
+	require.Equal(t, dead.Reason, dead.Report.Attempts[1].Error)
+
+	w = adminRequest(t, http.MethodGet, "/reports/dead/"+dead.Id)
+	require.Equal(t, http.StatusOK, w.Code)
+	var inspected worker_report.DeadReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&inspected))
+	require.Equal(t, "lost report", inspected.Report.JobReportText)
+
+	// replay puts the report back with a fresh retry budget
+	w = adminRequest(t, http.MethodPost, fmt.Sprintf("/reports/dead/%s/replay", dead.Id))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	select {
+	case event := <-events:
+		require.Equal(t, "unknown-job", event.Report.JobId)
+		require.Nil(t, event.Report.Retried)
+		require.Empty(t, event.Report.Attempts)
+		require.NoError(t, event.Ack(ctx))
+	case <-time.After(time.Second):
+		t.Fatal("replayed report was not delivered")
+	}
+	w = adminRequest(t, http.MethodGet, "/reports/dead/"+dead.Id)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// a replay never overwrites a queued report of the same job
+	exhaustReport(t, events, "busy-job", errors.New("comment enqueue: unavailable"))
+	deadList, err := worker_report.ListDead(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadList, 1)
+	queued := worker_report.JobReport{JobId: "busy-job", JobReportText: "newer report"}
+	require.NoError(t, queued.SendEvent(ctx))
+	<-events
+	w = adminRequest(t, http.MethodPost, fmt.Sprintf("/reports/dead/%s/replay", deadList[0].Id))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = adminRequest(t, http.MethodDelete, "/reports/dead/"+deadList[0].Id)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequest(t, http.MethodDelete, "/reports/dead/"+deadList[0].Id)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Empty(t, mocks.StoredKeys(t, worker_report.JobReportDeadPrefix))
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRerun_LastJobAndOverrides(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml -e A=1", issues.StartJob))
+	awaitComment(t, commentPosted)
+	require.Len(t, scheduled(), 1)
+	firstJob := scheduled()[0].jobId
+
+	spec, err := worker_report.GetJobSpec(context.Background(), firstJob)
+	require.NoError(t, err)
+	require.Equal(t, "my-vm", spec.Host)
+	require.Equal(t, ".github/workflows/gpu.yml", spec.WorkflowFile)
+	require.Equal(t, []string{"-e", "A=1"}, spec.ExtraFlags)
+	require.Equal(t, "test-user", spec.Requester)
+	require.Empty(t, spec.RerunOf)
+
+	// defaults to the last job of the issue
+	postMatrixComment(t, fmt.Sprintf("@bot %s", issues.RerunJob))
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "Re-run of job "+firstJob)
+	jobs := scheduled()
+	require.Len(t, jobs, 2)
+	require.Equal(t, "xxx:50051", jobs[1].address)
+	require.Equal(t, jobs[0].flags, jobs[1].flags)
+	secondJob := jobs[1].jobId
+
+	rerun, err := worker_report.GetJobSpec(context.Background(), secondJob)
+	require.NoError(t, err)
+	require.Equal(t, firstJob, rerun.RerunOf)
+	require.Equal(t, spec.Commit, rerun.Commit)
+	require.Equal(t, spec.ExtraFlags, rerun.ExtraFlags)
+
+	var meta worker_report.GithubIssueMeta
+	require.NoError(t, json.Unmarshal(mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+secondJob), &meta))
+	require.NotNil(t, meta.RerunOf)
+	require.Equal(t, firstJob, *meta.RerunOf)
+
+	// explicit job with overrides
+	postMatrixComment(t, fmt.Sprintf("@bot %s %s --host gpu-2 --ref other-commit", issues.RerunJob, firstJob))
+	awaitComment(t, commentPosted)
+	jobs = scheduled()
+	require.Len(t, jobs, 3)
+	require.Equal(t, "yyy:50051", jobs[2].address)
+
+	overridden, err := worker_report.GetJobSpec(context.Background(), jobs[2].jobId)
+	require.NoError(t, err)
+	require.Equal(t, "gpu-2", overridden.Host)
+	require.Equal(t, "other-commit", overridden.Ref)
+	require.Equal(t, firstJob, overridden.RerunOf)
+}
+
+func TestRerun_UnknownJob(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s", issues.RerunJob))
+	require.Contains(t, awaitComment(t, commentPosted), "no job was started in this issue yet")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s missing-job", issues.RerunJob))
+	require.Contains(t, awaitComment(t, commentPosted), "job missing-job not found")
+	require.Empty(t, scheduled())
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/scheduler"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	from := time.Date(2025, time.January, 31, 10, 30, 0, 0, time.UTC) // a Friday
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 31, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * mon-fri", time.Date(2025, time.February, 3, 3, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 1", time.Date(2025, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		{"5,10 8-9 * * 7", time.Date(2025, time.February, 2, 8, 5, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.January, 31, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		cron, err := scheduler.ParseCron(tc.expr)
+		require.NoError(t, err, tc.expr)
+		require.Equal(t, tc.next, cron.Next(from), tc.expr)
+	}
+	never, err := scheduler.ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, never.Next(from).IsZero())
+
+	for _, invalid := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err = scheduler.ParseCron(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestCron_NextAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// 02:30 does not exist on 2025-03-30, the run is skipped rather than looping
+	cron, err := scheduler.ParseCron("30 2 * * *")
+	require.NoError(t, err)
+	next := cron.Next(time.Date(2025, time.March, 29, 12, 0, 0, 0, berlin))
+	require.True(t, time.Date(2025, time.March, 31, 2, 30, 0, 0, berlin).Equal(next), next)
+}
+
+func schedulerFixture(t *testing.T, schedulesEnv *conf.SchedulesEnvironment) (*scheduler.Scheduler, func() []issues.ScheduledStart) {
+	t.Helper()
+	mocks.StorageFixture(t)
+	var mu sync.Mutex
+	var fired []issues.ScheduledStart
+	original := scheduler.StartFunc
+	t.Cleanup(func() { scheduler.StartFunc = original })
+	scheduler.StartFunc = func(ctx context.Context, run issues.ScheduledStart) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fired = append(fired, run)
+		return "job", nil
+	}
+	s, err := scheduler.New(schedulesEnv, conf.Hosts)
+	require.NoError(t, err)
+	return s, func() []issues.ScheduledStart {
+		mu.Lock()
+		defer mu.Unlock()
+		result := fired
+		fired = nil
+		return result
+	}
+}
+
+func hourlySchedules(catchUp string) *conf.SchedulesEnvironment {
+	return &conf.SchedulesEnvironment{
+		CatchUp:    catchUp,
+		MaxCatchUp: 2,
+		Grace:      time.Minute,
+		Schedules: map[string]conf.Schedule{
+			"nightly": {
+				Cron:          "0 * * * *",
+				Repository:    "owner/repo",
+				Ref:           "main",
+				Workflow:      ".github/workflows/gpu.yml",
+				HostLabel:     "gpu",
+				Env:           map[string]string{"TEST_CASE": "full", "A": "1"},
+				TrackingIssue: 42,
+			},
+		},
+	}
+}
+
+func TestScheduler_CatchUpPolicies(t *testing.T) {
+	setupTestEnv(t)
+	start := time.Date(2025, time.January, 31, 10, 30, 0, 0, time.UTC)
+	// 11:00, 12:00 and 13:00 are missed, 14:00 is on time
+	resume := time.Date(2025, time.January, 31, 14, 0, 30, 0, time.UTC)
+	cases := []struct {
+		policy string
+		fired  int
+	}{
+		{conf.CatchUpSkip, 1},
+		{conf.CatchUpLatest, 1},
+		{conf.CatchUpAll, 3},
+	}
+	for _, tc := range cases {
+		t.Run(
+			tc.policy, func(t *testing.T) {
+				s, fired := schedulerFixture(t, hourlySchedules(tc.policy))
+				s.Tick(context.Background(), start)
+				require.Empty(t, fired(), "a new schedule does not catch up")
+				s.Tick(context.Background(), resume)
+				runs := fired()
+				require.Len(t, runs, tc.fired)
+				require.Equal(
+					t, issues.ScheduledStart{
+						Schedule:      "nightly",
+						Repository:    "owner/repo",
+						Ref:           "main",
+						Workflow:      ".github/workflows/gpu.yml",
+						Host:          "my-vm",
+						ExtraFlags:    []string{"-e", "A=1", "-e", "TEST_CASE=full"},
+						TrackingIssue: 42,
+					}, runs[0],
+				)
+				// evaluated already, nothing fires twice
+				s.Tick(context.Background(), resume.Add(10*time.Second))
+				require.Empty(t, fired())
+			},
+		)
+	}
+}
+
+func TestScheduler_LatestWithoutOnTimeRun(t *testing.T) {
+	setupTestEnv(t)
+	s, fired := schedulerFixture(t, hourlySchedules(conf.CatchUpLatest))
+	s.Tick(context.Background(), time.Date(2025, time.January, 31, 10, 30, 0, 0, time.UTC))
+	s.Tick(context.Background(), time.Date(2025, time.January, 31, 13, 30, 0, 0, time.UTC))
+	require.Len(t, fired(), 1)
+
+	// skip drops everything missed
+	s, fired = schedulerFixture(t, hourlySchedules(conf.CatchUpSkip))
+	s.Tick(context.Background(), time.Date(2025, time.January, 31, 13, 30, 0, 0, time.UTC))
+	s.Tick(context.Background(), time.Date(2025, time.January, 31, 16, 30, 0, 0, time.UTC))
+	require.Empty(t, fired())
+}
+
+func TestScheduler_InvalidConfiguration(t *testing.T) {
+	setupTestEnv(t)
+	schedules := hourlySchedules(conf.CatchUpSkip)
+	schedule := schedules.Schedules["nightly"]
+	schedule.HostLabel = "tpu"
+	schedules.Schedules["nightly"] = schedule
+	_, err := scheduler.New(schedules, conf.Hosts)
+	require.ErrorContains(t, err, "no host labeled tpu")
+
+	schedule.HostLabel, schedule.Cron = "gpu", "0 25 * * *"
+	schedules.Schedules["nightly"] = schedule
+	_, err = scheduler.New(schedules, conf.Hosts)
+	require.ErrorContains(t, err, "hour")
+
+	example, err := conf.NewSchedulesEnvironment("schedules.example.yaml")
+	require.NoError(t, err)
+	_, err = scheduler.New(example, conf.Hosts)
+	require.NoError(t, err)
+}
+
+func TestScheduler_StartScheduledPostsToTrackingIssue(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	jobId, err := issues.StartScheduled(
+		context.Background(), issues.ScheduledStart{
+			Schedule:      "nightly",
+			Repository:    "owner/repo",
+			Ref:           "main",
+			Workflow:      ".github/workflows/gpu.yml",
+			Host:          "gpu-2",
+			ExtraFlags:    []string{"-e", "TEST_CASE=full"},
+			TrackingIssue: 42,
+		},
+	)
+	require.NoError(t, err)
+	require.Contains(t, awaitComment(t, commentPosted), "Scheduled run of nightly")
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	require.Equal(t, jobId, jobs[0].jobId)
+	require.Equal(t, "yyy:50051", jobs[0].address)
+	require.Equal(t, []string{"--container-options", "-e TEST_CASE=full"}, jobs[0].flags)
+
+	var meta worker_report.GithubIssueMeta
+	require.NoError(t, json.Unmarshal(mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+jobId), &meta))
+	require.Equal(t, 42, meta.IssueId)
+	require.Equal(t, issues.ScheduledSender, meta.Sender)
+	require.NotNil(t, meta.AnswerCommentBody)
+
+	// an unknown host is reported on the tracking issue
+	_, err = issues.StartScheduled(
+		context.Background(), issues.ScheduledStart{
+			Schedule: "nightly", Repository: "owner/repo", Ref: "main", Host: "missing", TrackingIssue: 42,
+		},
+	)
+	require.Error(t, err)
+	require.Contains(t, awaitComment(t, commentPosted), "host not found")
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/conf"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/secrets"
+	"ActQABot/tests/mocks"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func secretsFixture(t *testing.T) {
+	t.Helper()
+	mocks.StorageFixture(t)
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	require.NoError(t, secrets.Init(conf.SecretsEnvironment{Key: base64.StdEncoding.EncodeToString(key)}))
+	t.Cleanup(func() { _ = secrets.Init(conf.SecretsEnvironment{}) })
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+}
+
+func putSecretRequest(t *testing.T, target, value string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(admin_api.SecretValue{Value: value})
+	req := httptest.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	admin_api.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestSecrets_AdminAPI(t *testing.T) {
+	setupTestEnv(t)
+	secretsFixture(t)
+
+	w := putSecretRequest(t, "/secrets/HF_TOKEN?repository=owner/repo", "hf_all_hosts")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotContains(t, w.Body.String(), "hf_all_hosts")
+	w = putSecretRequest(t, "/secrets/HF_TOKEN?repository=owner/repo&host=my-vm", "hf_my_vm")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// sealed at rest
+	keys := mocks.StoredKeys(t, secrets.SecretsPrefix)
+	require.Len(t, keys, 2)
+	for _, key := range keys {
+		require.NotContains(t, string(mocks.StoredValue(t, key)), "hf_")
+	}
+
+	w = adminRequest(t, http.MethodGet, "/secrets/?repository=owner/repo")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "hf_")
+	var list admin_api.SecretList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Secrets, 2)
+	require.Equal(t, "HF_TOKEN", list.Secrets[0].Name)
+	require.Equal(t, "github", list.Secrets[0].Forge)
+
+	w = adminRequest(t, http.MethodGet, "/secrets/?host=my-vm")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Secrets, 1)
+
+	for target, status := range map[string]int{
+		"/secrets/HF_TOKEN?repository=repo":                    http.StatusBadRequest,
+		"/secrets/GITHUB_TOKEN?repository=owner/repo":          http.StatusBadRequest,
+		"/secrets/HF-TOKEN?repository=owner/repo":              http.StatusBadRequest,
+		"/secrets/HF_TOKEN?repository=owner/repo&host=missing": http.StatusBadRequest,
+		"/secrets/HF_TOKEN?repository=owner/repo&forge=bitbkt": http.StatusBadRequest,
+	} {
+		require.Equal(t, status, putSecretRequest(t, target, "value").Code, target)
+	}
+
+	w = adminRequest(t, http.MethodDelete, "/secrets/HF_TOKEN?repository=owner/repo&host=my-vm")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequest(t, http.MethodDelete, "/secrets/HF_TOKEN?repository=owner/repo&host=my-vm")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Len(t, mocks.StoredKeys(t, secrets.SecretsPrefix), 1)
+}
+
+func TestSecrets_DisabledWithoutKey(t *testing.T) {
+	setupTestEnv(t)
+	secretsFixture(t)
+	require.NoError(t, secrets.Init(conf.SecretsEnvironment{}))
+	require.False(t, secrets.Enabled())
+
+	w := putSecretRequest(t, "/secrets/HF_TOKEN?repository=owner/repo", "value")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	values, err := secrets.ForJob(context.Background(), "", "owner/repo", "my-vm")
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	require.Error(t, secrets.Init(conf.SecretsEnvironment{Key: base64.StdEncoding.EncodeToString([]byte("short"))}))
+	keyFile := filepath.Join(t.TempDir(), "secrets.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))+"\n"), 0600))
+	require.NoError(t, secrets.Init(conf.SecretsEnvironment{KeyFile: keyFile}))
+	require.True(t, secrets.Enabled())
+}
+
+func TestSecrets_ScopedPerRepositoryAndHost(t *testing.T) {
+	setupTestEnv(t)
+	secretsFixture(t)
+	ctx := context.Background()
+	put := func(scope secrets.Scope, name, value string) {
+		_, err := secrets.Put(ctx, scope, name, value)
+		require.NoError(t, err)
+	}
+	put(secrets.Scope{Repository: "owner/repo"}, "HF_TOKEN", "all")
+	put(secrets.Scope{Repository: "owner/repo"}, "REGISTRY_PASSWORD", "registry")
+	put(secrets.Scope{Repository: "owner/repo", Host: "my-vm"}, "HF_TOKEN", "my-vm")
+	put(secrets.Scope{Repository: "owner/other"}, "OTHER", "other")
+	put(secrets.Scope{Forge: "gitlab", Repository: "owner/repo"}, "GITLAB_ONLY", "gitlab")
+
+	values, err := secrets.ForJob(ctx, "", "owner/repo", "my-vm")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"HF_TOKEN": "my-vm", "REGISTRY_PASSWORD": "registry"}, values)
+
+	values, err = secrets.ForJob(ctx, "github", "owner/repo", "gpu-2")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"HF_TOKEN": "all", "REGISTRY_PASSWORD": "registry"}, values)
+
+	values, err = secrets.ForJob(ctx, "gitlab", "owner/repo", "my-vm")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"GITLAB_ONLY": "gitlab"}, values)
+
+	require.Equal(t, []string{"-s", "A=1", "-s", "B=2"}, secrets.Flags(map[string]string{"B": "2", "A": "1"}))
+
+	// another server key can't open them
+	require.NoError(t, secrets.Init(conf.SecretsEnvironment{Key: base64.StdEncoding.EncodeToString(make([]byte, 32))}))
+	_, err = secrets.ForJob(ctx, "", "owner/repo", "my-vm")
+	require.ErrorContains(t, err, "unable to decrypt")
+}
+
+func TestSecrets_InjectedIntoJobNotComment(t *testing.T) {
+	setupTestEnv(t)
+	secretsFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	_, err := secrets.Put(context.Background(), secrets.Scope{Repository: "owner/repo"}, "HF_TOKEN", "hf_top_secret")
+	require.NoError(t, err)
+
+	start := func() error {
+		_, err := issues.StartScheduled(
+			context.Background(), issues.ScheduledStart{
+				Schedule:      "nightly",
+				Repository:    "owner/repo",
+				Ref:           "main",
+				Workflow:      ".github/workflows/gpu.yml",
+				Host:          "gpu-2",
+				ExtraFlags:    []string{"-e", "TEST_CASE=full"},
+				TrackingIssue: 42,
+			},
+		)
+		return err
+	}
+
+	// the connection to the host isn't encrypted
+	require.ErrorContains(t, start(), "host gpu-2 has no tls_cert, the repository secrets can't be sent to it")
+	require.Empty(t, scheduled())
+
+	gpu2 := conf.Hosts.Hosts["gpu-2"]
+	certPath := "ca.pem"
+	gpu2.TlsCert = &certPath
+	conf.Hosts.Hosts["gpu-2"] = gpu2
+	require.NoError(t, start())
+	reply := awaitComment(t, commentPosted)
+	require.NotContains(t, reply, "hf_top_secret")
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	require.Equal(
+		t, []string{"--container-options", "-e TEST_CASE=full", "-s", "HF_TOKEN=hf_top_secret"}, jobs[0].flags,
+	)
+
+	// the operator accepts plaintext for this host
+	gpu2.TlsCert = nil
+	gpu2.AllowPlaintextSecrets = true
+	conf.Hosts.Hosts["gpu-2"] = gpu2
+	require.NoError(t, start())
+	awaitComment(t, commentPosted)
+	require.Len(t, scheduled(), 2)
+	for _, key := range mocks.StoredKeys(t, "/") {
+		if !strings.HasPrefix(key, secrets.SecretsPrefix) {
+			require.NotContains(t, string(mocks.StoredValue(t, key)), "hf_top_secret", key)
+		}
+	}
+}
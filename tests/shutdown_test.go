@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"ActQABot/api/github_api"
+	"ActQABot/api/gitlab_api"
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/internal/shutdown"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"bufio"
+	"context"
+	"errors"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func drainFixture(t *testing.T) {
+	t.Helper()
+	t.Cleanup(shutdown.Reset)
+}
+
+func TestShutdown_WebhooksRejectedWhileDraining(t *testing.T) {
+	setupTestEnv(t)
+	drainFixture(t)
+	conf.GitlabEnvironment.WebhookToken = "gl-secret"
+	t.Cleanup(func() { conf.GitlabEnvironment.WebhookToken = "" })
+	shutdown.Drain()
+
+	req := httptest.NewRequest(http.MethodPost, "/github/events/", strings.NewReader("{}"))
+	req.Header.Set("X-GitHub-Event", "ping")
+	w := httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	req = httptest.NewRequest(http.MethodPost, "/events/", strings.NewReader("{}"))
+	req.Header.Set("X-Gitlab-Token", "gl-secret")
+	w = httptest.NewRecorder()
+	gitlab_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	shutdown.Reset()
+	req = httptest.NewRequest(http.MethodPost, "/github/events/", strings.NewReader("{}"))
+	req.Header.Set("X-GitHub-Event", "ping")
+	w = httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestShutdown_LogStreamAskedToReconnect(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	drainFixture(t)
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	t.Cleanup(stopStream)
+	original := grpc_utils.NewGRPCConn
+	t.Cleanup(func() { grpc_utils.NewGRPCConn = original })
+	grpc_utils.NewGRPCConn = func(host conf.Host) (grpc.ClientConnInterface, error) {
+		return &mocks.MockClientConn{
+			NewStreamFunc: func(
+				ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption,
+			) (grpc.ClientStream, error) {
+				return mocks.NewRunningJobStream(
+					streamCtx, &actservice.JobLogMessage{Line: "still running", Type: actservice.JobLogMessage_STDOUT},
+				), nil
+			},
+		}, nil
+	}
+
+	require.NoError(
+		t, worker_report.SaveJobSpec(
+			context.Background(), &worker_report.JobSpec{
+				JobId: "running", Owner: "owner", Repository: "repo", IssueNumber: 1, Host: "my-vm", CreatedAt: time.Now(),
+			},
+		),
+	)
+	server := httptest.NewServer(github_api.Router())
+	t.Cleanup(server.Close)
+	resp, err := http.Get(server.URL + "/job/logs/?host=my-vm&job_id=running")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	next := func() string {
+		select {
+		case line, ok := <-lines:
+			require.True(t, ok, "stream ended")
+			return line
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for a line")
+		}
+		return ""
+	}
+	require.Contains(t, next(), "still running")
+
+	shutdown.Drain()
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	require.Contains(t, received, "event: reconnect")
+	require.Contains(t, received, `data: {"reconnect": true}`)
+}
+
+func TestShutdown_JobReportsConsumerDrains(t *testing.T) {
+	setupTestEnv(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	answer := "Answer"
+	release := make(chan struct{})
+	retrieving := make(chan struct{}, 2)
+	original := worker_report.RetrieveGithubJobMetaFunc
+	t.Cleanup(func() { worker_report.RetrieveGithubJobMetaFunc = original })
+	worker_report.RetrieveGithubJobMetaFunc = func(ctx context.Context, jobId string) (*worker_report.GithubIssueMeta, error) {
+		retrieving <- struct{}{}
+		<-release
+		return &worker_report.GithubIssueMeta{
+			Sender: "user", Body: "body", Owner: "user", Repository: "repo", IssueId: 1,
+			AnswerCommentBody: &answer, Host: "my-vm", JobId: &jobId,
+		}, nil
+	}
+
+	var mu sync.Mutex
+	outcomes := make(map[string]string)
+	outcome := func(name string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return outcomes[name]
+	}
+	newEvent := func(name string) *worker_report.JobReportEvent {
+		finish := func(result string) func(context.Context) error {
+			return func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				outcomes[name] = result
+				return nil
+			}
+		}
+		nack := finish("nack")
+		return &worker_report.JobReportEvent{
+			Report: &worker_report.JobReport{
+				JobId: "draining-job", JobReportText: name, Status: worker_report.JobStatusSuccess,
+			},
+			Ack: finish("ack"),
+			Nack: func(ctx context.Context, reason error) error {
+				if !errors.Is(reason, worker_report.ConsumerStoppedError) {
+					return finish("nack: " + reason.Error())(ctx)
+				}
+				return nack(ctx)
+			},
+		}
+	}
+
+	events := make(chan *worker_report.JobReportEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker_report.JobReportsConsumer(ctx, events)
+	}()
+	events <- newEvent("first")
+	select {
+	case <-retrieving:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first report was not picked up")
+	}
+	// queued behind the first report of the same job
+	events <- newEvent("second")
+	cancel()
+
+	require.Eventually(t, func() bool { return outcome("second") == "nack" }, 2*time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("consumer returned with a report in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consumer did not return")
+	}
+	require.Equal(t, "ack", outcome("first"))
+	select {
+	case comment := <-commentPosted:
+		require.Contains(t, comment.Text, "first")
+	case <-time.After(2 * time.Second):
+		t.Fatal("report of the first event was not posted")
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"ActQABot/pkg/storage"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func nextWatchResponse(t *testing.T, watch <-chan storage.WatchResponse) storage.WatchResponse {
+	t.Helper()
+	select {
+	case resp := <-watch:
+		require.NoError(t, resp.Err)
+		return resp
+	case <-time.After(time.Second):
+		t.Fatal("no watch event")
+	}
+	return storage.WatchResponse{}
+}
+
+func TestMemoryStorage_WatchFromRevision(t *testing.T) {
+	store := mocks.StorageFixture(t)
+	ctx := t.Context()
+
+	require.NoError(t, store.Put(ctx, "/queue/a", []byte("a"), storage.NoLease))
+	_, rev, err := store.List(ctx, "/queue/")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "/queue/b", []byte("b"), storage.NoLease))
+	require.NoError(t, store.Put(ctx, "/other/c", []byte("c"), storage.NoLease))
+
+	// the change made before the watch is replayed, other prefixes are ignored
+	watch := store.Watch(ctx, "/queue/", rev+1)
+	resp := nextWatchResponse(t, watch)
+	require.Len(t, resp.Events, 1)
+	require.Equal(t, storage.EventPut, resp.Events[0].Type)
+	require.Equal(t, "/queue/b", resp.Events[0].Key)
+
+	require.NoError(t, store.Delete(ctx, "/queue/a"))
+	resp = nextWatchResponse(t, watch)
+	require.Equal(t, storage.EventDelete, resp.Events[0].Type)
+	require.Equal(t, "/queue/a", resp.Events[0].Key)
+}
+
+func TestMemoryStorage_WatchCompacted(t *testing.T) {
+	store := mocks.StorageFixture(t)
+	ctx := t.Context()
+
+	require.NoError(t, store.Put(ctx, "/queue/a", []byte("a"), storage.NoLease))
+	_, rev, err := store.List(ctx, "/queue/")
+	require.NoError(t, err)
+	for i := range 1100 {
+		require.NoError(t, store.Put(ctx, fmt.Sprintf("/other/%d", i), []byte("x"), storage.NoLease))
+	}
+
+	// the history doesn't reach back that far: the caller has to list again
+	select {
+	case resp := <-store.Watch(ctx, "/queue/", rev+1):
+		require.ErrorIs(t, resp.Err, storage.CompactedError)
+	case <-time.After(time.Second):
+		t.Fatal("no compaction error")
+	}
+	_, rev, err = store.List(ctx, "/queue/")
+	require.NoError(t, err)
+	watch := store.Watch(ctx, "/queue/", rev+1)
+	require.NoError(t, store.Put(ctx, "/queue/b", []byte("b"), storage.NoLease))
+	require.Equal(t, "/queue/b", nextWatchResponse(t, watch).Events[0].Key)
+}
+
+func TestMemoryStorage_MoveIsOneRevision(t *testing.T) {
+	store := mocks.StorageFixture(t)
+	ctx := t.Context()
+
+	require.NoError(t, store.Put(ctx, "/queue/a", []byte("a"), storage.NoLease))
+	_, rev, err := store.List(ctx, "/")
+	require.NoError(t, err)
+	watch := store.Watch(ctx, "/", rev+1)
+	require.NoError(t, store.Move(ctx, "/queue/a", "/dead/a", []byte("a")))
+
+	resp := nextWatchResponse(t, watch)
+	require.Len(t, resp.Events, 2)
+	require.Equal(t, storage.EventDelete, resp.Events[0].Type)
+	require.Equal(t, storage.EventPut, resp.Events[1].Type)
+	require.Equal(t, rev+1, resp.Events[0].ModRevision)
+	require.Equal(t, rev+1, resp.Events[1].ModRevision)
+	_, moved, err := store.List(ctx, "/")
+	require.NoError(t, err)
+	require.Equal(t, rev+1, moved)
+}
+
+func TestMemoryStorage_DeleteAtRevision(t *testing.T) {
+	store := mocks.StorageFixture(t)
+	ctx := t.Context()
+
+	require.NoError(t, store.Put(ctx, "/queue/a", []byte("1"), storage.NoLease))
+	stale, err := store.Get(ctx, "/queue/a")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "/queue/a", []byte("2"), storage.NoLease))
+
+	deleted, err := store.DeleteAt(ctx, "/queue/a", stale.ModRevision)
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	current, err := store.Get(ctx, "/queue/a")
+	require.NoError(t, err)
+	deleted, err = store.DeleteAt(ctx, "/queue/a", current.ModRevision)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	require.Nil(t, mocks.StoredValue(t, "/queue/a"))
+}
+
+func TestMemoryStorage_LeaseExpiry(t *testing.T) {
+	store := mocks.StorageFixture(t)
+	ctx := t.Context()
+
+	lease, err := store.Grant(ctx, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "/meta/a", []byte("a"), lease))
+	require.NoError(t, store.Put(ctx, "/meta/b", []byte("b"), storage.NoLease))
+
+	require.Eventually(
+		t, func() bool { return mocks.StoredValue(t, "/meta/a") == nil }, 3*time.Second, 50*time.Millisecond,
+	)
+	require.Equal(t, []byte("b"), mocks.StoredValue(t, "/meta/b"))
+	require.ErrorIs(t, store.Put(ctx, "/meta/a", []byte("a"), lease), storage.LeaseNotFoundError)
+}
+
+func TestMemoryStorage_FilePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qabot.json")
+	ctx := t.Context()
+
+	store, err := storage.NewMemory(path)
+	require.NoError(t, err)
+	lease, err := store.Grant(ctx, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "/meta/a", []byte("a"), lease))
+	require.NoError(t, store.Put(ctx, "/queue/b", []byte("b"), storage.NoLease))
+	_, rev, err := store.List(ctx, "/")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	reopened, err := storage.NewMemory(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reopened.Close() })
+	kvs, reopenedRev, err := reopened.List(ctx, "/")
+	require.NoError(t, err)
+	require.Equal(t, rev, reopenedRev)
+	require.Len(t, kvs, 2)
+	require.Equal(t, "/meta/a", kvs[0].Key)
+	require.Equal(t, []byte("b"), kvs[1].Value)
+
+	// the history isn't persisted
+	select {
+	case resp := <-reopened.Watch(ctx, "/", rev):
+		require.ErrorIs(t, resp.Err, storage.CompactedError)
+	case <-time.After(time.Second):
+		t.Fatal("no compaction error")
+	}
+
+	// leases survive a restart
+	require.NoError(t, reopened.Revoke(ctx, lease))
+	kv, err := reopened.Get(ctx, "/meta/a")
+	require.NoError(t, err)
+	require.Nil(t, kv)
+}
+
+func TestJobReports_QueuedBeforeSubscribeAreAcked(t *testing.T) {
+	mocks.StorageFixture(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	report := worker_report.JobReport{JobId: "queued-job", JobReportText: "done"}
+	require.NoError(t, report.SendEvent(ctx))
+
+	events, err := worker_report.SubscribeJobReports(ctx)
+	require.NoError(t, err)
+	select {
+	case event := <-events:
+		require.Equal(t, "queued-job", event.Report.JobId)
+		require.NoError(t, event.Ack(ctx))
+	case <-time.After(time.Second):
+		t.Fatal("queued report was not delivered")
+	}
+	require.Empty(t, mocks.StoredKeys(t, string(worker_report.JobReportChannel)))
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"ActQABot/api/github_api"
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func tracingFixture(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(
+		func() {
+			_ = provider.Shutdown(context.Background())
+			otel.SetTracerProvider(original)
+		},
+	)
+	return exporter
+}
+
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracing_WebhookToScheduleAndReply(t *testing.T) {
+	setupTestEnv(t)
+	exporter := tracingFixture(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+
+	traceparents := make(chan string, 1)
+	originalConn := grpc_utils.NewGRPCConn
+	t.Cleanup(func() { grpc_utils.NewGRPCConn = originalConn })
+	grpc_utils.NewGRPCConn = func(host conf.Host) (grpc.ClientConnInterface, error) {
+		return &mocks.MockClientConn{
+			InvokeFunc: func(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				traceparents <- md.Get("traceparent")[0]
+				reply.(*actservice.JobResponse).JobId = "traced-job"
+				return nil
+			},
+		}, nil
+	}
+
+	payload := mocks.IssueCommentPayload{
+		Action:       "created",
+		IssueComment: mocks.MockComment{Body: fmt.Sprintf("@bot %s my-vm some-commit", issues.StartJob)},
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/github/events/", bytes.NewBuffer(body))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+	w := httptest.NewRecorder()
+	github_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case <-commentPosted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("comment posted timeout")
+	}
+	require.Eventually(
+		t, func() bool {
+			_, ok := spansByName(exporter)["outbox.deliver"]
+			return ok
+		}, 2*time.Second, 10*time.Millisecond,
+	)
+
+	spans := spansByName(exporter)
+	root := spans["github.webhook"]
+	require.True(t, root.SpanContext.IsValid())
+	for _, name := range []string{
+		"issues.HandleComment", "command " + issues.StartJob, "createJob", "GithubIssueMeta.Store", "outbox.deliver",
+	} {
+		span, ok := spans[name]
+		require.True(t, ok, "span %s is missing", name)
+		require.Equal(t, root.SpanContext.TraceID(), span.SpanContext.TraceID(), name)
+	}
+
+	createJob := spans["createJob"]
+	require.Equal(
+		t,
+		fmt.Sprintf("00-%s-%s-01", createJob.SpanContext.TraceID(), createJob.SpanContext.SpanID()),
+		<-traceparents,
+	)
+
+	var meta worker_report.GithubIssueMeta
+	require.NoError(t, json.Unmarshal(mocks.StoredValue(t, worker_report.GithubIssueMetaPrefix+"traced-job"), &meta))
+	require.Contains(t, meta.Trace["traceparent"], root.SpanContext.TraceID().String())
+}
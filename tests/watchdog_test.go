@@ -0,0 +1,321 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/internal/grpc_utils"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/storage"
+	"ActQABot/pkg/watchdog"
+	"ActQABot/pkg/webhooks"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	actservice "github.com/D1-3105/ActService/api/gen/ActService"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchdog_Limit(t *testing.T) {
+	hostsEnv := &conf.HostsEnvironment{
+		Hosts: map[string]conf.Host{
+			"h200":  {MaxJobDuration: 4 * time.Hour},
+			"my-vm": {},
+		},
+		MaxJobDuration:         24 * time.Hour,
+		WorkflowMaxJobDuration: map[string]time.Duration{".github/workflows/*-smoke.yml": 30 * time.Minute},
+	}
+	require.Equal(t, 4*time.Hour, watchdog.Limit(hostsEnv, "h200", ".github/workflows/gpu.yml"))
+	require.Equal(t, 24*time.Hour, watchdog.Limit(hostsEnv, "my-vm", ".github/workflows/gpu.yml"))
+	require.Equal(t, 30*time.Minute, watchdog.Limit(hostsEnv, "h200", ".github/workflows/gpu-smoke.yml"))
+	require.Zero(t, watchdog.Limit(&conf.HostsEnvironment{}, "h200", ".github/workflows/gpu.yml"))
+
+	effective, capped := watchdog.Effective(4*time.Hour, 2*time.Hour)
+	require.Equal(t, 2*time.Hour, effective)
+	require.False(t, capped)
+	effective, capped = watchdog.Effective(4*time.Hour, 30*time.Hour)
+	require.Equal(t, 4*time.Hour, effective)
+	require.True(t, capped)
+	effective, capped = watchdog.Effective(0, 30*time.Hour)
+	require.Equal(t, 30*time.Hour, effective)
+	require.False(t, capped)
+
+	require.Equal(t, "2h", watchdog.Format(2*time.Hour))
+	require.Equal(t, "1h30m", watchdog.Format(90*time.Minute))
+	require.Equal(t, "45s", watchdog.Format(45*time.Second))
+
+	require.NoError(t, watchdog.Validate(hostsEnv))
+	hostsEnv.WorkflowMaxJobDuration["[.yml"] = time.Hour
+	require.ErrorContains(t, watchdog.Validate(hostsEnv), "workflow_max_job_duration [.yml")
+	example, err := conf.NewHostsEnvironment("hosts.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, watchdog.Validate(example))
+}
+
+func TestWatchdog_TimeoutFlag(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	conf.Hosts.Hosts["my-vm"] = conf.Host{Address: "xxx:50051", MaxConcurrency: 1, MaxJobDuration: 4 * time.Hour}
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --timeout 30h", issues.StartJob))
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "--timeout 30h exceeds the limit of 4h")
+	require.Contains(t, reply, "Time limit: 4h")
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	require.Empty(t, jobs[0].flags)
+	deadlines, err := worker_report.ListJobDeadlines(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadlines, 1)
+	require.Equal(t, jobs[0].jobId, deadlines[0].JobId)
+	require.Equal(t, 4*time.Hour, deadlines[0].Limit)
+	require.WithinDuration(t, time.Now().Add(4*time.Hour), deadlines[0].Deadline, time.Minute)
+	spec, err := worker_report.GetJobSpec(context.Background(), jobs[0].jobId)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Hour, spec.Timeout)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --timeout 90m", issues.StartJob))
+	reply = awaitComment(t, commentPosted)
+	require.Contains(t, reply, "Time limit: 1h30m")
+	require.NotContains(t, reply, "exceeds the limit")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --timeout soon", issues.StartJob))
+	require.Contains(t, awaitComment(t, commentPosted), `invalid --timeout "soon"`)
+	require.Len(t, scheduled(), 2)
+}
+
+// cancelFixture records the jobs cancelled through ActService, cancelErr is returned when set
+func cancelFixture(t *testing.T, cancelErr error) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var cancelled []string
+	original := grpc_utils.NewGRPCConn
+	t.Cleanup(func() { grpc_utils.NewGRPCConn = original })
+	grpc_utils.NewGRPCConn = func(host conf.Host) (grpc.ClientConnInterface, error) {
+		return &mocks.MockClientConn{
+			InvokeFunc: func(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+				require.True(t, strings.HasSuffix(method, "/CancelActJob"), method)
+				if cancelErr != nil {
+					return cancelErr
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				cancelled = append(cancelled, args.(*actservice.CancelJob).JobId)
+				return nil
+			},
+			NewStreamFunc: func(
+				ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption,
+			) (grpc.ClientStream, error) {
+				return nil, errors.New("no logs")
+			},
+		}, nil
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, cancelled...)
+	}
+}
+
+func saveDeadline(t *testing.T, limit time.Duration, startedAt time.Time) string {
+	t.Helper()
+	jobId := uuid.NewString()
+	require.NoError(
+		t, worker_report.SaveJobDeadline(
+			context.Background(), &worker_report.JobDeadline{
+				JobId: jobId, Host: "my-vm", Limit: limit, StartedAt: startedAt, Deadline: startedAt.Add(limit),
+			},
+		),
+	)
+	return jobId
+}
+
+func TestWatchdog_CancelsOverdueJob(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	cancelled := cancelFixture(t, nil)
+	bg, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribed, err := worker_report.SubscribeJobReports(bg)
+	require.NoError(t, err)
+	go worker_report.JobReportsConsumer(bg, subscribed)
+
+	// stored before a restart: the watchdog only relies on the deadlines kept in the store
+	overdue := saveDeadline(t, 2*time.Hour, time.Now().Add(-3*time.Hour))
+	running := saveDeadline(t, 2*time.Hour, time.Now())
+	answer := "Answer"
+	meta := worker_report.GithubIssueMeta{
+		Sender: "user", Body: "body", Owner: "owner", Repository: "repo", IssueId: 1,
+		AnswerCommentBody: &answer, Host: "my-vm", JobId: &overdue,
+	}
+	require.NoError(t, meta.Store(t.Context(), overdue, 1))
+
+	watchdog.Tick(bg, time.Now())
+	require.Equal(t, []string{overdue}, cancelled())
+	comment := awaitComment(t, commentPosted)
+	require.Contains(t, comment, "The job exceeded its maximum duration of 2h and was cancelled")
+	deadlines, err := worker_report.ListJobDeadlines(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadlines, 1)
+	require.Equal(t, running, deadlines[0].JobId)
+
+	// nothing is cancelled twice
+	watchdog.Tick(bg, time.Now())
+	require.Len(t, cancelled(), 1)
+
+	// the last report of a job stops its watchdog
+	report := worker_report.JobReport{JobId: running, JobReportText: "done", Status: worker_report.JobStatusSuccess}
+	meta.JobId = &running
+	require.NoError(t, meta.Store(t.Context(), running, 1))
+	require.NoError(t, report.SendEvent(bg))
+	awaitComment(t, commentPosted)
+	require.Eventually(
+		t, func() bool {
+			deadlines, err = worker_report.ListJobDeadlines(context.Background())
+			return err == nil && len(deadlines) == 0
+		}, 3*time.Second, 10*time.Millisecond,
+	)
+}
+
+func TestWatchdog_CancelFailures(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+
+	// the host is unreachable: retried on the next tick
+	cancelFixture(t, errors.New("connection refused"))
+	jobId := saveDeadline(t, time.Hour, time.Now().Add(-2*time.Hour))
+	watchdog.Tick(context.Background(), time.Now())
+	deadlines, err := worker_report.ListJobDeadlines(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadlines, 1)
+
+	// another job's or another failure's message doesn't tell this job is gone
+	for _, cancelErr := range []error{
+		status.Errorf(codes.Unknown, "CancelJob: Job %s not found", "other-job"),
+		status.Errorf(codes.Unknown, "job %s not found", jobId),
+		status.Errorf(codes.Unavailable, "CancelJob: Job %s not found", jobId),
+	} {
+		cancelFixture(t, cancelErr)
+		watchdog.Tick(context.Background(), time.Now())
+		deadlines, err = worker_report.ListJobDeadlines(context.Background())
+		require.NoError(t, err)
+		require.Len(t, deadlines, 1, cancelErr)
+	}
+
+	// ActService forgot the job, it ended without a final report: no timeout notice. It answers with a plain
+	// error, received as code Unknown, a later one may answer with codes.NotFound
+	for _, gone := range []func(jobId string) error{
+		func(jobId string) error { return status.Errorf(codes.Unknown, "CancelJob: Job %s not found", jobId) },
+		func(jobId string) error { return status.Errorf(codes.NotFound, "job %s not found", jobId) },
+	} {
+		cancelFixture(t, gone(jobId))
+		watchdog.Tick(context.Background(), time.Now())
+		deadlines, err = worker_report.ListJobDeadlines(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, deadlines)
+		kv, err := storage.Default().Get(context.Background(), string(worker_report.JobReportChannel)+jobId)
+		require.NoError(t, err)
+		require.Nil(t, kv)
+		jobId = saveDeadline(t, time.Hour, time.Now().Add(-2*time.Hour))
+	}
+}
+
+func TestWatchdog_GivesUpAfterGrace(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	cancelFixture(t, errors.New("connection refused"))
+
+	// past the grace already: the entry expires instead of being retried forever
+	saveDeadline(t, time.Hour, time.Now().Add(-time.Hour-worker_report.JobDeadlineGrace))
+	watchdog.Tick(context.Background(), time.Now())
+	require.Eventually(
+		t, func() bool {
+			deadlines, err := worker_report.ListJobDeadlines(context.Background())
+			return err == nil && len(deadlines) == 0
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+
+	// within the grace, the entry is kept
+	saveDeadline(t, time.Hour, time.Now().Add(-2*time.Hour))
+	watchdog.Tick(context.Background(), time.Now())
+	deadlines, err := worker_report.ListJobDeadlines(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadlines, 1)
+}
+
+func TestWatchdog_FinalReportWithoutMeta(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	bg, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribed, err := worker_report.SubscribeJobReports(bg)
+	require.NoError(t, err)
+	go worker_report.JobReportsConsumer(bg, subscribed)
+
+	// the report can't be posted, the job is over all the same
+	jobId := saveDeadline(t, time.Hour, time.Now())
+	report := worker_report.JobReport{JobId: jobId, JobReportText: "done", Status: worker_report.JobStatusFailure}
+	require.NoError(t, report.SendEvent(bg))
+	require.Eventually(
+		t, func() bool {
+			deadlines, err := worker_report.ListJobDeadlines(context.Background())
+			return err == nil && len(deadlines) == 0
+		}, 3*time.Second, 10*time.Millisecond,
+	)
+}
+
+func TestWatchdog_PublishesCancelled(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	cancelFixture(t, nil)
+	events := make(chan webhooks.Event, 4)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var event webhooks.Event
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+				events <- event
+			},
+		),
+	)
+	origWebhooks := conf.Webhooks
+	t.Cleanup(
+		func() {
+			server.Close()
+			conf.Webhooks = origWebhooks
+		},
+	)
+	conf.Webhooks = &conf.WebhooksEnvironment{
+		Timeout: time.Second, MaxAttempts: 1, LogSize: 10,
+		Endpoints: map[string]conf.WebhookEndpoint{
+			"cancelled": {URL: server.URL, Secret: "s3cret", Events: []string{webhooks.EventJobCancelled}},
+		},
+	}
+
+	jobId := saveDeadline(t, time.Hour, time.Now().Add(-2*time.Hour))
+	watchdog.Tick(context.Background(), time.Now())
+	select {
+	case event := <-events:
+		require.Equal(t, webhooks.EventJobCancelled, event.Type)
+		require.Equal(t, jobId, event.Job.Id)
+		require.Equal(t, "my-vm", event.Job.Host)
+		require.NotNil(t, event.Report)
+		require.Equal(t, worker_report.JobStatusTimeout, event.Report.Status)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no job.cancelled event")
+	}
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"ActQABot/api/admin_api"
+	"ActQABot/conf"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/webhooks"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/tests/mocks"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks_SignRetryAndFilter(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+
+	var mu sync.Mutex
+	received := make(map[string][]webhooks.Event)
+	failures := 1
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				mu.Lock()
+				defer mu.Unlock()
+				if r.URL.Path == "/all" && failures > 0 {
+					failures--
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				require.Equal(t, webhooks.Sign("s3cret", body), r.Header.Get(webhooks.SignatureHeader))
+				var event webhooks.Event
+				require.NoError(t, json.Unmarshal(body, &event))
+				require.Equal(t, event.Type, r.Header.Get(webhooks.EventHeader))
+				received[r.URL.Path] = append(received[r.URL.Path], event)
+			},
+		),
+	)
+	origWebhooks := conf.Webhooks
+	t.Cleanup(
+		func() {
+			server.Close()
+			conf.Webhooks = origWebhooks
+		},
+	)
+	conf.Webhooks = &conf.WebhooksEnvironment{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		BaseBackoff: 10 * time.Millisecond,
+		MaxBackoff:  50 * time.Millisecond,
+		LogSize:     10,
+		Endpoints: map[string]conf.WebhookEndpoint{
+			"all":      {URL: server.URL + "/all", Secret: "s3cret"},
+			"finished": {URL: server.URL + "/finished", Secret: "s3cret", Events: []string{webhooks.EventJobFinished}},
+		},
+	}
+
+	meta := worker_report.GithubIssueMeta{Owner: "owner", Repository: "repo", IssueId: 5, Host: "my-vm", Sender: "test-user"}
+	webhooks.Publish(webhooks.NewEvent(webhooks.EventJobScheduled, meta.WebhookJob("job-42")))
+
+	require.Eventually(
+		t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received["/all"]) == 1
+		}, 2*time.Second, 10*time.Millisecond,
+	)
+	finished := webhooks.NewEvent(webhooks.EventJobFinished, meta.WebhookJob("job-42"))
+	finished.Report = &webhooks.Report{Text: "done", Status: worker_report.JobStatusSuccess}
+	webhooks.Publish(finished)
+	require.Eventually(
+		t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received["/all"]) == 2 && len(received["/finished"]) == 1
+		}, 2*time.Second, 10*time.Millisecond,
+	)
+
+	mu.Lock()
+	scheduled := received["/all"][0]
+	require.Equal(t, webhooks.EventJobScheduled, scheduled.Type)
+	require.Equal(t, "job-42", scheduled.Job.Id)
+	require.Equal(t, "owner", scheduled.Job.Owner)
+	require.Equal(t, "done", received["/finished"][0].Report.Text)
+	mu.Unlock()
+
+	attempts := webhooks.Deliveries("all", scheduled.Id)
+	require.Len(t, attempts, 2)
+	require.True(t, attempts[0].Delivered)
+	require.Equal(t, http.StatusServiceUnavailable, attempts[1].StatusCode)
+
+	conf.AdminEnv.Token = "admin-secret"
+	t.Cleanup(func() { conf.AdminEnv.Token = "" })
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/deliveries/?endpoint=finished", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	admin_api.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list admin_api.WebhookDeliveryList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list.Deliveries, 1)
+	require.Equal(t, webhooks.EventJobFinished, list.Deliveries[0].EventType)
+}
+
+func TestWebhooks_LifecycleEventsOnce(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+
+	var mu sync.Mutex
+	var received []webhooks.Event
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var event webhooks.Event
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+				mu.Lock()
+				defer mu.Unlock()
+				received = append(received, event)
+			},
+		),
+	)
+	origWebhooks := conf.Webhooks
+	t.Cleanup(
+		func() {
+			server.Close()
+			conf.Webhooks = origWebhooks
+		},
+	)
+	conf.Webhooks = &conf.WebhooksEnvironment{
+		Timeout: time.Second, MaxAttempts: 1, LogSize: 10,
+		Endpoints: map[string]conf.WebhookEndpoint{"all": {URL: server.URL, Secret: "s3cret"}},
+	}
+	countByType := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		counts := make(map[string]int)
+		for _, event := range received {
+			counts[event.Type]++
+		}
+		return counts
+	}
+
+	// the job meta is stored twice, before and after the reply: each event is sent once
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml", issues.StartJob))
+	awaitComment(t, commentPosted)
+	require.Eventually(
+		t, func() bool {
+			counts := countByType()
+			return counts[webhooks.EventJobScheduled] == 1 && counts[webhooks.EventJobStarted] == 1
+		}, 2*time.Second, 10*time.Millisecond,
+	)
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	mu.Lock()
+	for _, event := range received {
+		require.Equal(t, jobs[0].jobId, event.Job.Id)
+		require.Equal(t, "my-vm", event.Job.Host)
+	}
+	mu.Unlock()
+
+	// a matrix announces each of its jobs
+	postMatrixComment(
+		t, fmt.Sprintf("@bot %s some-commit .github/workflows/gpu.yml --matrix host=my-vm,gpu-2", issues.StartJob),
+	)
+	awaitComment(t, commentPosted)
+	require.Eventually(
+		t, func() bool {
+			counts := countByType()
+			return counts[webhooks.EventJobScheduled] == 3 && counts[webhooks.EventJobStarted] == 3
+		}, 2*time.Second, 10*time.Millisecond,
+	)
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, countByType(), 2)
+	require.Equal(t, 3, countByType()[webhooks.EventJobStarted])
+}
@@ -16,7 +16,7 @@ import (
 
 func Test_WorkerReportCreate(t *testing.T) {
 	setupTestEnv(t)
-	_ = mocks.MockWorkerReportEtcd(nil, nil)
+	mocks.StorageFixture(t)
 	newWorkerReport := worker_report.JobReport{JobId: "123", JobReportText: "Something"}
 	body, err := json.Marshal(newWorkerReport)
 	if err != nil {
@@ -53,3 +53,15 @@ func Test_WorkerReportCreate(t *testing.T) {
 		t.Errorf("timed out waiting for job report")
 	}
 }
+
+func Test_WorkerReportUnknownStatus(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	body, err := json.Marshal(worker_report.JobReport{JobId: "123", JobReportText: "done", Status: "passed"})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	worker_api.Router().ServeHTTP(w, httptest.NewRequest("POST", "/report/", bytes.NewBuffer(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "unknown job status")
+	require.Empty(t, mocks.StoredKeys(t, string(worker_report.JobReportChannel)))
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/forge"
+	"ActQABot/pkg/github/gh_api"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/worker_report"
+	"ActQABot/pkg/workflow"
+	"ActQABot/tests/mocks"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+const dispatchWorkflow = `name: GPU
+on:
+  push:
+  workflow_dispatch:
+    inputs:
+      model:
+        description: Model | checkpoint
+        type: choice
+        required: true
+        options: [llama, mistral]
+      batch_size:
+        type: number
+        default: 16
+      debug:
+        type: boolean
+        default: false
+      note:
+jobs:
+  test:
+    runs-on: ubuntu-latest
+`
+
+func TestWorkflow_ResolveInputs(t *testing.T) {
+	wf, err := workflow.Parse("gpu.yml", []byte(dispatchWorkflow))
+	require.NoError(t, err)
+	require.True(t, wf.Dispatch)
+	require.Equal(
+		t, []workflow.Input{
+			{Name: "batch_size", Type: workflow.InputNumber, Default: "16"},
+			{Name: "debug", Type: workflow.InputBoolean, Default: "false"},
+			{
+				Name: "model", Description: "Model | checkpoint", Type: workflow.InputChoice, Required: true,
+				Options: []string{"llama", "mistral"},
+			},
+			{Name: "note", Type: workflow.InputString},
+		}, wf.Inputs,
+	)
+
+	resolved, errs := wf.ResolveInputs(map[string]string{"model": "llama", "note": "a=b"})
+	require.Empty(t, errs)
+	require.Equal(t, map[string]string{"model": "llama", "note": "a=b", "batch_size": "16", "debug": "false"}, resolved)
+	require.Equal(
+		t, []string{
+			"workflow_dispatch",
+			"--input", "batch_size=16", "--input", "debug=false", "--input", "model=llama", "--input", "note=a=b",
+		},
+		workflow.InputFlags(resolved),
+	)
+	require.Empty(t, workflow.InputFlags(nil))
+
+	_, errs = wf.ResolveInputs(map[string]string{"model": "gpt", "batch_size": "many", "debug": "yes", "seed": "1"})
+	require.Len(t, errs, 4)
+	require.ErrorContains(t, errs[0], "gpu.yml declares no input seed")
+	require.ErrorContains(t, errs[1], `input batch_size must be a number, got "many"`)
+	require.ErrorContains(t, errs[2], `input debug must be true or false, got "yes"`)
+	require.ErrorContains(t, errs[3], `input model must be one of llama, mistral, got "gpt"`)
+
+	_, errs = wf.ResolveInputs(nil)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "input model is required")
+
+	push, err := workflow.Parse("push.yml", []byte(mocks.DefaultWorkflow))
+	require.NoError(t, err)
+	_, errs = push.ResolveInputs(map[string]string{"model": "llama"})
+	require.ErrorContains(t, errs[0], "push.yml has no workflow_dispatch trigger")
+
+	_, err = workflow.Parse("bad.yml", []byte("on:\n  workflow_dispatch:\n    inputs:\n      a:\n        type: choice\njobs:\n  t:\n    runs-on: x\n"))
+	require.ErrorContains(t, err, "choice input a has no options")
+}
+
+func TestStart_WorkflowInputs(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	mocks.WorkflowFilesFixture(
+		t, map[string]string{
+			".github/workflows/gpu.yml": dispatchWorkflow,
+			".github/workflows/ci.yml":  mocks.DefaultWorkflow,
+		},
+	)
+
+	postMatrixComment(
+		t, fmt.Sprintf(
+			"@bot %s my-vm some-commit .github/workflows/gpu.yml -e A=1 --input model=mistral --input debug=true",
+			issues.StartJob,
+		),
+	)
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "Inputs: `batch_size=16` `debug=true` `model=mistral`")
+	jobs := scheduled()
+	require.Len(t, jobs, 1)
+	require.Equal(
+		t, []string{
+			"--container-options", "-e A=1", "workflow_dispatch",
+			"--input", "batch_size=16", "--input", "debug=true", "--input", "model=mistral",
+		}, jobs[0].flags,
+	)
+	spec, err := worker_report.GetJobSpec(context.Background(), jobs[0].jobId)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"batch_size": "16", "debug": "true", "model": "mistral"}, spec.Inputs)
+
+	// a re-run keeps the inputs, --input overrides one
+	postMatrixComment(t, fmt.Sprintf("@bot %s --input debug=false", issues.RerunJob))
+	require.Contains(t, awaitComment(t, commentPosted), "Inputs: `batch_size=16` `debug=false` `model=mistral`")
+	jobs = scheduled()
+	require.Len(t, jobs, 2)
+	require.Contains(t, jobs[1].flags, "debug=false")
+	require.Contains(t, jobs[1].flags, "model=mistral")
+
+	for command, problem := range map[string]string{
+		"my-vm some-commit .github/workflows/gpu.yml --input model=gpt":       `input model must be one of llama, mistral, got "gpt"`,
+		"my-vm some-commit .github/workflows/gpu.yml":                         "input model is required",
+		"my-vm some-commit .github/workflows/ci.yml --input model=llama":      "ci.yml has no workflow_dispatch trigger",
+		"my-vm some-commit --input model=llama":                               "inputs need a single WORKFLOW_PATH file",
+		"my-vm some-commit .github/workflows/gpu.yml --input model":           `invalid input "model", use name=value`,
+		"my-vm some-commit .github/workflows/gpu.yml --input a=1 --input a=2": "input a is given twice",
+	} {
+		postMatrixComment(t, fmt.Sprintf("@bot %s %s", issues.StartJob, command))
+		require.Contains(t, awaitComment(t, commentPosted), problem, command)
+	}
+	require.Len(t, scheduled(), 2)
+
+	// inputs are never passed unchecked: neither when the forge can't be reached nor without validation
+	origGet := gh_api.GetFileFunc
+	gh_api.GetFileFunc = func(ctx context.Context, owner, repo, ref, filePath string) ([]byte, error) {
+		return nil, &forge.APIError{StatusCode: http.StatusBadGateway}
+	}
+	postMatrixComment(
+		t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --input model=llama", issues.StartJob),
+	)
+	require.Contains(t, awaitComment(t, commentPosted), "the inputs can't be checked against the workflow")
+	gh_api.GetFileFunc = origGet
+	conf.GeneralEnvironments.ValidateWorkflows = false
+	postMatrixComment(
+		t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/gpu.yml --input model=llama", issues.StartJob),
+	)
+	require.Contains(t, awaitComment(t, commentPosted), "inputs are only accepted when the workflows are validated")
+	require.Len(t, scheduled(), 2)
+}
+
+func TestHelp_WorkflowInputs(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	refs := mocks.WorkflowFilesFixture(
+		t, map[string]string{
+			".github/workflows/gpu.yml": dispatchWorkflow,
+			".github/workflows/ci.yml":  mocks.DefaultWorkflow,
+		},
+	)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s .github/workflows/gpu.yml main", issues.HelpCommand))
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "inputs of `.github/workflows/gpu.yml` at `main`")
+	require.Contains(t, reply, "| `model` | choice: llama, mistral | yes |  | Model \\| checkpoint |")
+	require.Contains(t, reply, "| `batch_size` | number | no | 16 |  |")
+	require.Contains(t, reply, "--input batch_size=value --input debug=value --input model=value --input note=value")
+	require.NotContains(t, reply, "Supported hosts")
+	require.Equal(t, []string{"main"}, refs())
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s .github/workflows/ci.yml", issues.HelpCommand))
+	require.Contains(t, awaitComment(t, commentPosted), "no workflow_dispatch trigger")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s .github/workflows/missing.yml", issues.HelpCommand))
+	require.Contains(t, awaitComment(t, commentPosted), "missing.yml does not exist at the default branch")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s", issues.HelpCommand))
+	require.Contains(t, awaitComment(t, commentPosted), "Supported hosts")
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"ActQABot/conf"
+	"ActQABot/pkg/github/issues"
+	"ActQABot/pkg/workflow"
+	"ActQABot/tests/mocks"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const needsTypoWorkflow = `name: GPU
+on:
+  workflow_dispatch:
+jobs:
+  build:
+    runs-on: ubuntu-latest
+  test:
+    runs-on: [self-hosted, gpu]
+    needs: [biuld]
+`
+
+const partlyRunnableWorkflow = `name: GPU
+"on": push
+jobs:
+  lint:
+    runs-on:
+      group: any
+      labels: ubuntu-22.04
+  gpu:
+    runs-on: self-hosted
+  matrix:
+    runs-on: ${{ matrix.os }}
+  call:
+    uses: ./.github/workflows/reusable.yml
+    needs: lint
+`
+
+func TestWorkflow_Parse(t *testing.T) {
+	wf, err := workflow.Parse("a.yml", []byte(partlyRunnableWorkflow))
+	require.NoError(t, err)
+	require.Equal(t, "GPU", wf.Name)
+	require.Equal(
+		t, []workflow.Job{
+			{Id: "call", Uses: "./.github/workflows/reusable.yml", Needs: []string{"lint"}},
+			{Id: "gpu", RunsOn: []string{"self-hosted"}},
+			{Id: "lint", RunsOn: []string{"ubuntu-22.04"}},
+			{Id: "matrix"},
+		}, wf.Jobs,
+	)
+
+	for content, problem := range map[string]string{
+		"jobs: [":                              "invalid yaml",
+		"":                                     "empty workflow",
+		"jobs:\n  a:\n    runs-on: x\n":        "no on triggers",
+		"on: push\n":                           "no jobs",
+		"on: push\njobs:\n  a: b\n":            "job a is not a mapping",
+		"on: push\njobs:\n  a:\n    steps: []": "job a has neither runs-on nor uses",
+	} {
+		_, err = workflow.Parse("a.yml", []byte(content))
+		require.ErrorContains(t, err, problem, content)
+	}
+}
+
+func TestWorkflow_Validate(t *testing.T) {
+	wf, err := workflow.Parse("a.yml", []byte(needsTypoWorkflow))
+	require.NoError(t, err)
+	errs, warnings := wf.Validate(workflow.DefaultPlatforms)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "job test needs unknown job biuld")
+	require.Equal(t, []string{"a.yml: job test is skipped, the host has no platform for runs-on self-hosted, gpu"}, warnings)
+
+	errs, warnings = wf.Validate([]string{"gpu"})
+	require.Len(t, errs, 1)
+	require.Len(t, warnings, 1)
+
+	errs, _ = wf.Validate([]string{"macos-latest"})
+	require.Len(t, errs, 2)
+	require.ErrorContains(t, errs[1], "no job can run on the host platforms macos-latest")
+}
+
+func TestWorkflow_HostPlatforms(t *testing.T) {
+	require.Equal(t, workflow.DefaultPlatforms, workflow.HostPlatforms(conf.Host{}))
+	require.Equal(
+		t, []string{"gpu", "self-hosted", "ubuntu-22.04", "ubuntu-latest"}, workflow.HostPlatforms(
+			conf.Host{
+				CustomFlags: []string{
+					"-P", "ubuntu-latest=catthehacker/ubuntu:act-latest",
+					"--platform=self-hosted=-self-hosted",
+					"-P gpu=nvidia/cuda:12.4.0-runtime-ubuntu22.04",
+					"-Pubuntu-22.04=node:16-bullseye",
+					"--container-options", "--gpus all -P",
+				},
+			},
+		),
+	)
+	require.Equal(
+		t, workflow.DefaultPlatforms,
+		workflow.HostPlatforms(conf.Host{CustomFlags: []string{"--container-options=-P -e A=1"}}),
+	)
+}
+
+func TestStart_WorkflowValidation(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	scheduled := matrixFixture(t)
+	refs := mocks.WorkflowFilesFixture(
+		t, map[string]string{
+			".github/workflows/typo.yml":   needsTypoWorkflow,
+			".github/workflows/partly.yml": partlyRunnableWorkflow,
+		},
+	)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/typo.yml", issues.StartJob))
+	require.Contains(t, awaitComment(t, commentPosted), "job test needs unknown job biuld")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/missing.yml", issues.StartJob))
+	require.Contains(t, awaitComment(t, commentPosted), ".github/workflows/missing.yml does not exist at some-commit")
+
+	// the directory holds a broken workflow
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit", issues.StartJob))
+	require.Contains(t, awaitComment(t, commentPosted), "typo.yml: job test needs unknown job biuld")
+	require.Empty(t, scheduled())
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s my-vm some-commit .github/workflows/partly.yml", issues.StartJob))
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "new job started")
+	require.Contains(t, reply, ":warning: .github/workflows/partly.yml: job gpu is skipped")
+	require.Len(t, scheduled(), 1)
+	for _, ref := range refs() {
+		require.Equal(t, "some-commit", ref)
+	}
+}
+
+func TestListWorkflows(t *testing.T) {
+	setupTestEnv(t)
+	mocks.StorageFixture(t)
+	commentPosted := mocks.PostIssueCommentFixture(t)
+	refs := mocks.WorkflowFilesFixture(
+		t, map[string]string{
+			".github/workflows/typo.yml":   needsTypoWorkflow,
+			".github/workflows/partly.yml": partlyRunnableWorkflow,
+			".github/workflows/broken.yml": "jobs: [",
+			".github/workflows/README.md":  "docs",
+		},
+	)
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s release-1.2", issues.ListFlows))
+	reply := awaitComment(t, commentPosted)
+	require.Contains(t, reply, "workflows at `release-1.2`")
+	require.Contains(t, reply, "| `.github/workflows/partly.yml` | GPU | call, gpu, lint, matrix |")
+	require.Contains(t, reply, "| `.github/workflows/typo.yml` | GPU | build, test |")
+	require.Contains(t, reply, ".github/workflows/broken.yml: invalid yaml")
+	require.NotContains(t, reply, "README")
+	require.Contains(t, refs(), "release-1.2")
+
+	postMatrixComment(t, fmt.Sprintf("@bot %s a b", issues.ListFlows))
+	require.Contains(t, awaitComment(t, commentPosted), "usage: /wf_list [REF]")
+}